@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// allowlistMapper refuses SIDs whose domain SID is not explicitly allowed, even if a
+// configured range would map them
+type allowlistMapper struct {
+	mapper  idmap.IDMapper
+	allowed map[string]bool
+}
+
+// newAllowlistMapper wraps mapper so only SIDs from the given domain SIDs are converted
+func newAllowlistMapper(mapper idmap.IDMapper, domainSIDs []string) *allowlistMapper {
+	allowed := make(map[string]bool, len(domainSIDs))
+	for _, sid := range domainSIDs {
+		allowed[strings.ToUpper(sid)] = true
+	}
+	return &allowlistMapper{mapper: mapper, allowed: allowed}
+}
+
+// check rejects sid unless its domain SID is on the allowlist
+func (m *allowlistMapper) check(sid string) error {
+	domainSID, err := idmap.DomainSIDOf(sid)
+	if err != nil {
+		return err
+	}
+	if !m.allowed[strings.ToUpper(domainSID)] {
+		return fmt.Errorf("%w: domain %s of %s is not in the -allow-domain-sid list", idmap.ErrNotFound, domainSID, sid)
+	}
+	return nil
+}
+
+func (m *allowlistMapper) SIDToUnixID(sid string) (uint32, error) {
+	if err := m.check(sid); err != nil {
+		return 0, err
+	}
+	return m.mapper.SIDToUnixID(sid)
+}
+
+func (m *allowlistMapper) BinSIDToUnixID(sid []byte) (uint32, error) {
+	strSID, err := idmap.DecodeSID(sid)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.check(strSID); err != nil {
+		return 0, err
+	}
+	return m.mapper.BinSIDToUnixID(sid)
+}
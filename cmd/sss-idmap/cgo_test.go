@@ -0,0 +1,9 @@
+//go:build !nosssidmap
+
+package main
+
+import "testing"
+
+// requireLibrary skips tests that need libsss_idmap in the nosssidmap stub build; this
+// build links the library, so it does nothing
+func requireLibrary(testing.TB) {}
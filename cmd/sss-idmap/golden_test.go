@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Regenerate the golden files in testdata")
+
+// exampleBatchInput is the fixed batch input every golden batch case reads
+const exampleBatchInput = "S-1-5-21-3623811015-3361044348-30300820-1013\n" +
+	"S-1-5-21-3623811015-3361044348-30300820-500\n" +
+	"S-1-5-21-3623811015-3361044348-30300820-513\n"
+
+// TestGolden locks down the documented output formats for the EXAMPLE domain
+// Run with -update to regenerate testdata/*.golden after an intentional change
+func TestGolden(t *testing.T) {
+	requireLibrary(t)
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+	}{
+		{name: "plain_single", args: []string{"S-1-5-21-3623811015-3361044348-30300820-1013"}},
+		{name: "plain_batch", stdin: exampleBatchInput, args: []string{"-batch"}},
+		{name: "json_single", args: []string{"-json", "S-1-5-21-3623811015-3361044348-30300820-1013"}},
+		{name: "json_batch", stdin: exampleBatchInput, args: []string{"-batch", "-json"}},
+		{name: "env_single", args: []string{"-env", "S-1-5-21-3623811015-3361044348-30300820-1013"}},
+		{name: "env_batch", stdin: exampleBatchInput, args: []string{"-batch", "-env"}},
+		{name: "env_typed", args: []string{"-env", "-typed-id=gid", "S-1-5-21-3623811015-3361044348-30300820-513"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(append([]string{}, exampleDomainArgs...), tt.args...)
+			code, stdout, stderr := runCLI(t, tt.stdin, args...)
+			if code != 0 {
+				t.Fatalf("exit code = %d, want 0 (stderr: %s)", code, stderr)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(stdout), 0o644); err != nil {
+					t.Fatalf("failed to update golden file: %v", err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file: %v", err)
+			}
+			if stdout != string(want) {
+				t.Errorf("output does not match %s\ngot:\n%s\nwant:\n%s", golden, stdout, want)
+			}
+		})
+	}
+}
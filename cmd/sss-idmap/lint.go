@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// lintSSSDConf reports every pair of sssd.conf domains whose slice pools overlap
+// SSSD hashes every domain but the one of ldap_idmap_default_domain_sid to any slice from
+// ldap_idmap_range_min to ldap_idmap_range_max, so two sections can only be proven apart by
+// their whole pools; each conflict is printed as path:line with both sections and any
+// conflict fails the lint
+func lintSSSDConf(path string, stdout io.Writer, logger *slog.Logger) int {
+	f, err := os.Open(path)
+	if err != nil {
+		logger.Error("failed to open sssd.conf", "error", err)
+		return exitInternal
+	}
+	defer f.Close()
+
+	domains, err := idmap.ParseSSSDConf(f)
+	if err != nil {
+		logger.Error("failed to parse sssd.conf", "path", path, "error", err)
+		return exitConfig
+	}
+
+	pools := make([]idmap.DomainConfig, len(domains))
+	sections := make(map[string]idmap.SSSDConfDomain, len(domains))
+	for i, domain := range domains {
+		pools[i] = idmap.DomainConfig{DomainName: domain.DomainName, IDRange: domain.Pool}
+		sections[domain.DomainName] = domain
+	}
+
+	overlaps := idmap.FindOverlaps(pools)
+	for _, overlap := range overlaps {
+		a, b := sections[overlap.A.DomainName], sections[overlap.B.DomainName]
+		fmt.Fprintf(stdout, "%s:%d: [%s] slices %d-%d overlap [%s] (line %d) slices %d-%d\n",
+			path, b.Line, b.Section, b.Pool.Min, b.Pool.Max,
+			a.Section, a.Line, a.Pool.Min, a.Pool.Max)
+	}
+
+	if len(overlaps) > 0 {
+		return exitConfig
+	}
+	return exitOK
+}
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
 )
@@ -15,92 +24,468 @@ var (
 	date    = "unknown"
 )
 
+// Exit codes, so scripts can tell failure classes apart without parsing stderr
+const (
+	exitOK           = 0
+	exitInternal     = 1
+	exitInvalidSID   = 2
+	exitNotFound     = 3
+	exitConfig       = 4
+	exitOutputClosed = 5
+)
+
+// exitCodeFor maps a conversion error to its exit code
+func exitCodeFor(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, idmap.ErrInvalidSID):
+		return exitInvalidSID
+	case errors.Is(err, idmap.ErrNotFound), errors.Is(err, idmap.ErrNotMappable), errors.Is(err, idmap.ErrBuiltinSID):
+		return exitNotFound
+	case errors.Is(err, idmap.ErrInvalidRange), errors.Is(err, idmap.ErrInvalidConfig):
+		return exitConfig
+	default:
+		return exitInternal
+	}
+}
+
 func main() {
+	// Report a closed stdout as ErrOutputClosed rather than dying of SIGPIPE
+	signal.Ignore(syscall.SIGPIPE)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the CLI with the given arguments and streams, returning the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
 	var (
-		showVersion = flag.Bool("version", false, "Show version information")
-		verbose     = flag.Bool("v", false, "Verbose output")
-		domainName  = flag.String("domain-name", "", "Domain name (required for offline mode)")
-		domainSID   = flag.String("domain-sid", "", "Domain SID (required for offline mode)")
-		rangeMin    = flag.Uint("range-min", 0, "Minimum Unix ID in range (required for offline mode)")
-		rangeMax    = flag.Uint("range-max", 0, "Maximum Unix ID in range (required for offline mode)")
+		showVersion = flags.Bool("version", false, "Show version information")
+		verbose     = flags.Bool("v", false, "Verbose output")
+		domainName  = flags.String("domain-name", "", "Domain name (required for offline mode)")
+		domainSID   = flags.String("domain-sid", "", "Domain SID (required for offline mode)")
+		rangeMin    = flags.Uint("range-min", 0, "Minimum Unix ID in range (required for offline mode)")
+		rangeMax    = flags.Uint("range-max", 0, "Maximum Unix ID in range (required for offline mode)")
+		batch       = flags.Bool("batch", false, "Read newline-delimited SIDs from stdin")
+		failFast    = flags.Bool("fail-fast", false, "In batch mode, stop at the first conversion error")
+		jsonOutput  = flags.Bool("json", false, "Output results as JSON")
+		envOutput   = flags.Bool("env", false, "Output results as shell assignments for eval")
+		noNewline   = flags.Bool("n", false, "Print the ID without a trailing newline (single conversions only)")
+		percentDec  = flags.Bool("percent-decode", false, "URL-unescape SIDs before converting them, e.g. S%2D1%2D5%2D21-...")
+		verifyRange = flags.Bool("verify-range", false, "Check that every SID from -rid-start to -rid-end maps to an ID and back, in each domain")
+		ridStart    = flags.Uint("rid-start", 0, "First RID checked by -verify-range")
+		ridEnd      = flags.Uint("rid-end", 0, "Last RID checked by -verify-range")
+		whichDomain = flags.Bool("which-domain", false, "Print the configured domain the SID belongs to instead of mapping it")
+		lintConf    = flags.String("lint-sssd-conf", "", "Check the idmap ranges of an sssd.conf for overlaps and exit")
+		domains     []idmap.DomainConfig
+		allowedSIDs []string
+		files       []string
+		progressSet progressFlag
+		idType      string
 	)
 
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] SID\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Convert Windows SID to Unix UID/GID using SSS idmap.\n\n")
-		fmt.Fprintf(os.Stderr, "This tool works offline without SSSD by using libsss_idmap directly.\n")
-		fmt.Fprintf(os.Stderr, "You must provide domain configuration via command-line flags.\n\n")
-		fmt.Fprintf(os.Stderr, "Options:\n")
-		flag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nExample:\n")
-		fmt.Fprintf(os.Stderr, "  %s -domain-name EXAMPLE -domain-sid S-1-5-21-3623811015-3361044348-30300820 \\\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "    -range-min 10000 -range-max 20000 \\\n")
-		fmt.Fprintf(os.Stderr, "    S-1-5-21-3623811015-3361044348-30300820-1013\n")
+	flags.Func("allow-domain-sid", "Only convert SIDs from this domain SID; repeatable", func(s string) error {
+		if err := idmap.ValidateSID(s); err != nil {
+			return err
+		}
+		allowedSIDs = append(allowedSIDs, s)
+		return nil
+	})
+	flags.Func("file", "Read newline-delimited SIDs from this file like -batch, - for stdin; repeatable", func(s string) error {
+		files = append(files, s)
+		return nil
+	})
+	flags.Func("typed-id", "Print IDs as uid:N or gid:N, or with -env set SSS_IDMAP_TYPE; the value, uid or gid, is the type of the SIDs", func(s string) error {
+		if s != "uid" && s != "gid" {
+			return fmt.Errorf("want uid or gid, got %q", s)
+		}
+		idType = s
+		return nil
+	})
+	flags.Var(&progressSet, "progress", "In batch mode, print progress to stderr when it is a terminal; =always to force")
+	flags.Func("domain", "Domain as NAME:SID:MIN-MAX; repeatable, replaces the other domain flags", func(s string) error {
+		config, err := idmap.ParseDomainSpec(s)
+		if err != nil {
+			return err
+		}
+		domains = append(domains, config)
+		return nil
+	})
+
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [OPTIONS] SID\n", os.Args[0])
+		fmt.Fprintf(stderr, "       %s [OPTIONS] -batch < SIDS\n", os.Args[0])
+		fmt.Fprintf(stderr, "       %s [OPTIONS] -file SIDS [-file SIDS...]\n", os.Args[0])
+		fmt.Fprintf(stderr, "       %s [OPTIONS] -verify-range -rid-start N -rid-end M\n", os.Args[0])
+		fmt.Fprintf(stderr, "       %s -lint-sssd-conf /etc/sssd/sssd.conf\n\n", os.Args[0])
+		fmt.Fprintf(stderr, "In batch mode, stdin holds one SID per line or a JSON array of SIDs.\n\n")
+		fmt.Fprintf(stderr, "Convert Windows SID to Unix UID/GID using SSS idmap.\n\n")
+		fmt.Fprintf(stderr, "This tool works offline without SSSD by using libsss_idmap directly.\n")
+		fmt.Fprintf(stderr, "You must provide domain configuration via command-line flags.\n\n")
+		fmt.Fprintf(stderr, "Options:\n")
+		flags.PrintDefaults()
+		fmt.Fprintf(stderr, "\nExample:\n")
+		fmt.Fprintf(stderr, "  %s -domain-name EXAMPLE -domain-sid S-1-5-21-3623811015-3361044348-30300820 \\\n", os.Args[0])
+		fmt.Fprintf(stderr, "    -range-min 10000 -range-max 20000 \\\n")
+		fmt.Fprintf(stderr, "    S-1-5-21-3623811015-3361044348-30300820-1013\n")
+		fmt.Fprintf(stderr, "  %s -domain EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-20000 \\\n", os.Args[0])
+		fmt.Fprintf(stderr, "    S-1-5-21-3623811015-3361044348-30300820-1013\n")
+		fmt.Fprintf(stderr, "\nExit codes:\n")
+		fmt.Fprintf(stderr, "  %d  success\n", exitOK)
+		fmt.Fprintf(stderr, "  %d  internal or usage error\n", exitInternal)
+		fmt.Fprintf(stderr, "  %d  invalid SID\n", exitInvalidSID)
+		fmt.Fprintf(stderr, "  %d  SID not in a configured domain\n", exitNotFound)
+		fmt.Fprintf(stderr, "  %d  invalid range or domain configuration\n", exitConfig)
+		fmt.Fprintf(stderr, "  %d  output closed before all results were written\n", exitOutputClosed)
+		fmt.Fprintf(stderr, "In batch mode the exit code reflects the first failed SID.\n")
 	}
 
-	flag.Parse()
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 1
+	}
 
 	// Configure logging
 	logLevel := slog.LevelInfo
 	if *verbose {
 		logLevel = slog.LevelDebug
 	}
-	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{
 		Level: logLevel,
 	}))
-	slog.SetDefault(logger)
 
 	if *showVersion {
-		fmt.Printf("sss-idmap version %s (commit: %s, built: %s)\n", version, commit, date)
-		os.Exit(0)
+		fmt.Fprintf(stdout, "sss-idmap version %s (commit: %s, built: %s)\n", version, commit, date)
+		return 0
 	}
 
-	if flag.NArg() != 1 {
-		flag.Usage()
-		os.Exit(1)
+	if *lintConf != "" {
+		return lintSSSDConf(*lintConf, stdout, logger)
 	}
 
-	// Validate required flags
-	if *domainName == "" || *domainSID == "" || *rangeMin == 0 || *rangeMax == 0 {
-		fmt.Fprintf(os.Stderr, "Error: All domain configuration flags are required\n\n")
-		flag.Usage()
-		os.Exit(1)
+	if len(files) > 0 {
+		*batch = true
 	}
 
-	sid := flag.Arg(0)
-	slog.Debug("converting SID", "sid", sid)
+	wantArgs := 1
+	if *batch || *verifyRange {
+		wantArgs = 0
+	}
+	if flags.NArg() != wantArgs || (*jsonOutput && *envOutput) || (*whichDomain && *batch) || (*verifyRange && *batch) ||
+		(*noNewline && (*batch || *jsonOutput || *envOutput || *whichDomain || *verifyRange)) ||
+		(idType != "" && *jsonOutput) {
+		flags.Usage()
+		return 1
+	}
 
-	// Create domain configuration
-	config := idmap.DomainConfig{
-		DomainName: *domainName,
-		DomainSID:  *domainSID,
-		IDRange: idmap.IDRange{
-			Min: uint32(*rangeMin),
-			Max: uint32(*rangeMax),
-		},
+	if *verifyRange {
+		set := make(map[string]bool)
+		flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if !set["rid-start"] || !set["rid-end"] {
+			fmt.Fprintf(stderr, "Error: -verify-range requires both -rid-start and -rid-end\n")
+			return 1
+		}
+		if *ridStart > *ridEnd || *ridEnd > math.MaxUint32 || *ridEnd-*ridStart >= maxVerifyRIDs {
+			fmt.Fprintf(stderr, "Error: -rid-start to -rid-end must be an ascending window of at most %d RIDs\n", maxVerifyRIDs)
+			return 1
+		}
 	}
 
-	slog.Debug("domain configuration",
-		"name", config.DomainName,
-		"sid", config.DomainSID,
-		"range_min", config.IDRange.Min,
-		"range_max", config.IDRange.Max,
-	)
+	if len(domains) == 0 {
+		// Validate required flags
+		if *domainName == "" || *domainSID == "" || *rangeMin == 0 || *rangeMax == 0 {
+			fmt.Fprintf(stderr, "Error: All domain configuration flags are required\n\n")
+			flags.Usage()
+			return exitConfig
+		}
+
+		// Create domain configuration
+		domains = append(domains, idmap.DomainConfig{
+			DomainName: *domainName,
+			DomainSID:  *domainSID,
+			IDRange: idmap.IDRange{
+				Min: uint32(*rangeMin),
+				Max: uint32(*rangeMax),
+			},
+		})
+	}
 
-	// Create context with domain
-	ctx, err := idmap.NewIDMapContextWithDomain(config)
+	for _, config := range domains {
+		logger.Debug("domain configuration",
+			"name", config.DomainName,
+			"sid", config.DomainSID,
+			"range_min", config.IDRange.Min,
+			"range_max", config.IDRange.Max,
+		)
+	}
+
+	// Create context with domains
+	ctx, err := idmap.NewIDMapContext()
+	if errors.Is(err, idmap.ErrLibraryUnavailable) {
+		fmt.Fprintf(stderr, "Error: %v\n", idmap.ErrLibraryUnavailable)
+		return exitInternal
+	}
 	if err != nil {
-		slog.Error("failed to create idmap context", "error", err)
-		os.Exit(1)
+		logger.Error("failed to create idmap context", "error", err)
+		return exitInternal
 	}
 	defer ctx.Close()
 
+	if err := ctx.AddDomainsAtomic(domains); err != nil {
+		logger.Error("failed to configure domains", "error", err)
+		return exitConfig
+	}
+	ctx.SetLogger(logger)
+
+	if *whichDomain {
+		sid, err := inputSID(flags.Arg(0), *percentDec)
+		if err != nil {
+			logger.Error("failed to read SID", "error", err)
+			return exitCodeFor(err)
+		}
+		return printDomain(ctx, sid, stdout)
+	}
+
+	if *verifyRange {
+		return verifyRIDRange(ctx, domains, uint32(*ridStart), uint32(*ridEnd), stdout, logger)
+	}
+
+	var mapper idmap.IDMapper = ctx
+	if len(allowedSIDs) > 0 {
+		mapper = newAllowlistMapper(ctx, allowedSIDs)
+	}
+
+	resultOut := outputWriter{w: stdout}
+	var out resultWriter = &plainWriter{w: resultOut, batch: *batch, noNewline: *noNewline, idType: idType}
+	switch {
+	case *jsonOutput:
+		out = &jsonWriter{w: resultOut, batch: *batch}
+	case *envOutput:
+		out = &envWriter{w: resultOut, batch: *batch, idType: idType}
+	}
+
+	if *batch {
+		read := func(emit func(batchItem) error) error {
+			if len(files) > 0 {
+				return readBatchFiles(files, stdin, emit)
+			}
+			return readBatch(stdin, emit)
+		}
+		return convertBatch(mapper, read, *percentDec, out, logger, progressSet.reporter(stderr), *failFast)
+	}
+
+	sid, err := inputSID(flags.Arg(0), *percentDec)
+	if err != nil {
+		logger.Error("failed to read SID", "error", err)
+		return exitCodeFor(err)
+	}
+	logger.Debug("converting SID", "sid", sid)
+
 	// Convert SID to Unix ID
-	unixID, err := ctx.SIDToUnixID(sid)
+	unixID, err := mapper.SIDToUnixID(sid)
+	if err != nil {
+		logger.Error("failed to convert SID", "sid", sid, "error", err)
+		return exitCodeFor(err)
+	}
+
+	if err := out.Write(result{SID: sid, UnixID: unixID}); err != nil {
+		return writeFailed(logger, err)
+	}
+	if err := out.Close(); err != nil {
+		return writeFailed(logger, err)
+	}
+	return 0
+}
+
+// inputSID returns sid as given on the command line or in batch input, URL-unescaped
+// when percentDecode is set, so the allowlist and -which-domain see the decoded SID
+func inputSID(sid string, percentDecode bool) (string, error) {
+	if !percentDecode {
+		return sid, nil
+	}
+	decoded, err := url.QueryUnescape(sid)
 	if err != nil {
-		slog.Error("failed to convert SID", "sid", sid, "error", err)
-		os.Exit(1)
+		return "", fmt.Errorf("%w: %q is not validly percent-encoded", idmap.ErrInvalidSID, sid)
+	}
+	return decoded, nil
+}
+
+// printDomain prints the name of the configured domain sid belongs to, or "no match"
+// The exit code is exitNotFound when no domain matches
+func printDomain(ctx *idmap.IDMapContext, sid string, stdout io.Writer) int {
+	config, ok := ctx.MatchDomain(sid)
+	if !ok {
+		fmt.Fprintln(stdout, "no match")
+		return exitNotFound
+	}
+	fmt.Fprintln(stdout, config.DomainName)
+	return exitOK
+}
+
+// batchItem is a SID read from batch input along with its 1-based position
+// unit names the position ("line" or "item") and file is the -file it came from, if any
+type batchItem struct {
+	file string
+	unit string
+	pos  int
+	sid  string
+}
+
+// errStopBatch is returned by a batch item callback to stop reading input early
+var errStopBatch = errors.New("batch stopped")
+
+// readBatchFiles reads the SIDs of every path in order, where "-" means stdin, passing
+// each to emit as it is read
+func readBatchFiles(paths []string, stdin io.Reader, emit func(batchItem) error) error {
+	for _, path := range paths {
+		if err := readBatchFile(path, stdin, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBatchFile reads the SIDs of one -file path, closing the file before it returns
+func readBatchFile(path string, stdin io.Reader, emit func(batchItem) error) error {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	err := readBatch(r, func(item batchItem) error {
+		item.file = path
+		return emit(item)
+	})
+	if err != nil && !errors.Is(err, errStopBatch) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return err
+}
+
+// readBatch reads SIDs from newline-delimited input, or from a JSON array when the
+// first non-blank byte is '[', passing each to emit as it is read
+// An error from emit stops reading and is returned as is
+func readBatch(r io.Reader, emit func(batchItem) error) error {
+	br := bufio.NewReader(r)
+
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			break
+		}
+		if _, err := br.ReadByte(); err != nil {
+			return err
+		}
+	}
+
+	if b, _ := br.Peek(1); b[0] == '[' {
+		return readJSONBatch(br, emit)
+	}
+
+	scanner := bufio.NewScanner(br)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		sid := strings.TrimSpace(scanner.Text())
+		if sid == "" {
+			continue
+		}
+		if err := emit(batchItem{unit: "line", pos: lineNum, sid: sid}); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readJSONBatch reads a JSON array of SID strings one element at a time
+// Anything but whitespace after the closing ']' is an error
+func readJSONBatch(r io.Reader, emit func(batchItem) error) error {
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON array: %w", err)
+	}
+
+	for pos := 1; dec.More(); pos++ {
+		var sid string
+		if err := dec.Decode(&sid); err != nil {
+			return fmt.Errorf("invalid JSON array: item %d: %w", pos, err)
+		}
+		if err := emit(batchItem{unit: "item", pos: pos, sid: strings.TrimSpace(sid)}); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON array: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid JSON array: unexpected data after the closing ']'")
+	}
+	return nil
+}
+
+// convertBatch converts the items read by read as they arrive and writes the successes
+// to out, decoding the SIDs as inputSID does
+// Errors are logged with their position and processing continues unless failFast is set;
+// the exit code is that of the first failure, or 1 if the input could not be read
+func convertBatch(mapper idmap.IDMapper, read func(emit func(batchItem) error) error, percentDecode bool, out resultWriter, logger *slog.Logger, prog *progress, failFast bool) int {
+	defer prog.done()
+
+	exitCode := exitOK
+	var writeErr error
+	readErr := read(func(item batchItem) error {
+		sid, err := inputSID(item.sid, percentDecode)
+		var unixID uint32
+		if err == nil {
+			unixID, err = mapper.SIDToUnixID(sid)
+		}
+		prog.record(err)
+		if err != nil {
+			attrs := []any{item.unit, item.pos, "sid", item.sid, "error", err}
+			if item.file != "" {
+				attrs = append([]any{"file", item.file}, attrs...)
+			}
+			logger.Error("failed to convert SID", attrs...)
+			if exitCode == exitOK {
+				exitCode = exitCodeFor(err)
+			}
+			if failFast {
+				return errStopBatch
+			}
+			return nil
+		}
+
+		if err := out.Write(result{SID: sid, UnixID: unixID}); err != nil {
+			writeErr = err
+			return errStopBatch
+		}
+		return nil
+	})
+	if writeErr != nil {
+		return writeFailed(logger, writeErr)
+	}
+	if readErr != nil && !errors.Is(readErr, errStopBatch) {
+		logger.Error("failed to read input", "error", readErr)
+		exitCode = 1
+	}
+
+	if err := out.Close(); err != nil {
+		return writeFailed(logger, err)
 	}
 
-	fmt.Printf("%d\n", unixID)
+	return exitCode
 }
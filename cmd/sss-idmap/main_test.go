@@ -0,0 +1,758 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// exampleDomainArgs configures the EXAMPLE domain used throughout the tests
+var exampleDomainArgs = []string{
+	"-domain-name", "EXAMPLE",
+	"-domain-sid", "S-1-5-21-3623811015-3361044348-30300820",
+	"-range-min", "10000",
+	"-range-max", "20000",
+}
+
+// runCLI invokes run with the given arguments and stdin, returning the exit code and output
+func runCLI(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_SingleSID(t *testing.T) {
+	requireLibrary(t)
+
+	args := append(exampleDomainArgs, "S-1-5-21-3623811015-3361044348-30300820-1013")
+	code, stdout, stderr := runCLI(t, "", args...)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", code, stderr)
+	}
+	if stdout != "11013\n" {
+		t.Errorf("stdout = %q, want %q", stdout, "11013\n")
+	}
+}
+
+func TestRun_Batch(t *testing.T) {
+	requireLibrary(t)
+
+	input := strings.Join([]string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"not-a-sid",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+	}, "\n")
+
+	tests := []struct {
+		name       string
+		flags      []string
+		wantStdout string
+	}{
+		{
+			name:  "continue on error",
+			flags: []string{"-batch"},
+			wantStdout: "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n" +
+				"S-1-5-21-3623811015-3361044348-30300820-500\t10500\n",
+		},
+		{
+			name:       "fail fast",
+			flags:      []string{"-batch", "-fail-fast"},
+			wantStdout: "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, input, append(exampleDomainArgs, tt.flags...)...)
+			if code == 0 {
+				t.Errorf("exit code = 0, want non-zero")
+			}
+			if stdout != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout, tt.wantStdout)
+			}
+			if !strings.Contains(stderr, "line=2") {
+				t.Errorf("stderr does not report the offending line: %s", stderr)
+			}
+		})
+	}
+}
+
+func TestRun_JSON(t *testing.T) {
+	requireLibrary(t)
+
+	t.Run("single", func(t *testing.T) {
+		args := append(exampleDomainArgs, "-json", "S-1-5-21-3623811015-3361044348-30300820-1013")
+		code, stdout, stderr := runCLI(t, "", args...)
+		if code != 0 {
+			t.Fatalf("exit code = %d, want 0 (stderr: %s)", code, stderr)
+		}
+		want := `{"sid":"S-1-5-21-3623811015-3361044348-30300820-1013","unix_id":11013}` + "\n"
+		if stdout != want {
+			t.Errorf("stdout = %q, want %q", stdout, want)
+		}
+	})
+
+	t.Run("batch from JSON array", func(t *testing.T) {
+		input := ` ["S-1-5-21-3623811015-3361044348-30300820-1013", "S-1-5-21-3623811015-3361044348-30300820-513"]`
+		code, stdout, stderr := runCLI(t, input, append(exampleDomainArgs, "-batch", "-json")...)
+		if code != 0 {
+			t.Fatalf("exit code = %d, want 0 (stderr: %s)", code, stderr)
+		}
+
+		var got []result
+		if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+			t.Fatalf("output is not a JSON array: %v\n%s", err, stdout)
+		}
+		want := []result{
+			{SID: "S-1-5-21-3623811015-3361044348-30300820-1013", UnixID: 11013},
+			{SID: "S-1-5-21-3623811015-3361044348-30300820-513", UnixID: 10513},
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("results = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("batch rejects malformed JSON arrays", func(t *testing.T) {
+		// Items before the malformed part are converted as they are read
+		const want = "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n"
+		for _, input := range []string{
+			`["S-1-5-21-3623811015-3361044348-30300820-1013"] trailing`,
+			`["S-1-5-21-3623811015-3361044348-30300820-1013"]]`,
+			`["S-1-5-21-3623811015-3361044348-30300820-1013"] ["S-1-5-21-3623811015-3361044348-30300820-513"]`,
+			`["S-1-5-21-3623811015-3361044348-30300820-1013", 513]`,
+			`["S-1-5-21-3623811015-3361044348-30300820-1013"`,
+		} {
+			code, stdout, stderr := runCLI(t, input, append(slices.Clone(exampleDomainArgs), "-batch")...)
+			if code != 1 {
+				t.Errorf("input %q: exit code = %d, want 1 (stderr: %s)", input, code, stderr)
+			}
+			if !strings.Contains(stderr, "invalid JSON array") {
+				t.Errorf("input %q: stderr does not report the malformed array: %s", input, stderr)
+			}
+			if stdout != want {
+				t.Errorf("input %q: stdout = %q, want %q", input, stdout, want)
+			}
+		}
+	})
+
+	t.Run("batch error reports item", func(t *testing.T) {
+		input := `["S-1-5-21-3623811015-3361044348-30300820-1013", "not-a-sid"]`
+		code, stdout, stderr := runCLI(t, input, append(exampleDomainArgs, "-batch", "-json")...)
+		if code == 0 {
+			t.Error("exit code = 0, want non-zero")
+		}
+		if !strings.Contains(stderr, "item=2") {
+			t.Errorf("stderr does not report the offending item: %s", stderr)
+		}
+		var got []result
+		if err := json.Unmarshal([]byte(stdout), &got); err != nil || len(got) != 1 {
+			t.Errorf("stdout = %q, want a one-element JSON array", stdout)
+		}
+	})
+}
+
+func TestRun_BatchStreams(t *testing.T) {
+	requireLibrary(t)
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	var stderr bytes.Buffer
+	done := make(chan int, 1)
+	go func() {
+		done <- run(append(slices.Clone(exampleDomainArgs), "-batch"), stdinR, stdoutW, &stderr)
+		stdoutW.Close()
+	}()
+
+	// Each result must be written before the next line of input is read
+	out := bufio.NewReader(stdoutR)
+	for _, tt := range []struct{ sid, want string }{
+		{"S-1-5-21-3623811015-3361044348-30300820-1013", "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n"},
+		{"S-1-5-21-3623811015-3361044348-30300820-513", "S-1-5-21-3623811015-3361044348-30300820-513\t10513\n"},
+	} {
+		if _, err := io.WriteString(stdinW, tt.sid+"\n"); err != nil {
+			t.Fatalf("writing %s: %v", tt.sid, err)
+		}
+		got, err := out.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the result of %s: %v", tt.sid, err)
+		}
+		if got != tt.want {
+			t.Errorf("result = %q, want %q", got, tt.want)
+		}
+	}
+	stdinW.Close()
+
+	if rest, _ := io.ReadAll(out); len(rest) != 0 {
+		t.Errorf("trailing output = %q, want none", rest)
+	}
+	if code := <-done; code != exitOK {
+		t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitOK, stderr.String())
+	}
+}
+
+func TestRun_ExitCodes(t *testing.T) {
+	requireLibrary(t)
+
+	tests := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  int
+	}{
+		{
+			name: "success",
+			args: append(slices.Clone(exampleDomainArgs), "S-1-5-21-3623811015-3361044348-30300820-1013"),
+			want: exitOK,
+		},
+		{
+			name: "invalid SID",
+			args: append(slices.Clone(exampleDomainArgs), "not-a-sid"),
+			want: exitInvalidSID,
+		},
+		{
+			name: "not found",
+			args: append(slices.Clone(exampleDomainArgs), "S-1-5-21-1111111111-2222222222-3333333333-1013"),
+			want: exitNotFound,
+		},
+		{
+			name: "invalid range",
+			args: []string{
+				"-domain-name", "EXAMPLE",
+				"-domain-sid", "S-1-5-21-3623811015-3361044348-30300820",
+				"-range-min", "20000",
+				"-range-max", "10000",
+				"S-1-5-21-3623811015-3361044348-30300820-1013",
+			},
+			want: exitConfig,
+		},
+		{
+			name: "missing configuration",
+			args: []string{"S-1-5-21-3623811015-3361044348-30300820-1013"},
+			want: exitConfig,
+		},
+		{
+			name:  "batch reports first failure",
+			stdin: "S-1-5-21-1111111111-2222222222-3333333333-1013\nnot-a-sid\n",
+			args:  append(slices.Clone(exampleDomainArgs), "-batch"),
+			want:  exitNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := runCLI(t, tt.stdin, tt.args...)
+			if code != tt.want {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.want, stderr)
+			}
+		})
+	}
+}
+
+func TestRun_DomainFlag(t *testing.T) {
+	requireLibrary(t)
+
+	args := []string{
+		"-domain", "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-20000",
+		"-domain", "OTHER:S-1-5-21-1111111111-2222222222-3333333333:30000-40000",
+		"-batch",
+	}
+	input := "S-1-5-21-3623811015-3361044348-30300820-1013\nS-1-5-21-1111111111-2222222222-3333333333-1013\n"
+
+	code, stdout, stderr := runCLI(t, input, args...)
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0 (stderr: %s)", code, stderr)
+	}
+	want := "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n" +
+		"S-1-5-21-1111111111-2222222222-3333333333-1013\t31013\n"
+	if stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+
+	t.Run("malformed spec", func(t *testing.T) {
+		code, _, stderr := runCLI(t, "", "-domain", "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:20000-10000", "S-1-5-21-3623811015-3361044348-30300820-1013")
+		if code == 0 {
+			t.Error("exit code = 0, want non-zero")
+		}
+		if !strings.Contains(stderr, "range") {
+			t.Errorf("stderr does not name the bad field: %s", stderr)
+		}
+	})
+
+	t.Run("overlapping domains", func(t *testing.T) {
+		code, _, stderr := runCLI(t, "",
+			"-domain", "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-20000",
+			"-domain", "OTHER:S-1-5-21-1111111111-2222222222-3333333333:15000-25000",
+			"S-1-5-21-3623811015-3361044348-30300820-1013")
+		if code != exitConfig {
+			t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitConfig, stderr)
+		}
+	})
+}
+
+func TestRun_WhichDomain(t *testing.T) {
+	requireLibrary(t)
+
+	domainArgs := []string{
+		"-domain", "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-20000",
+		"-domain", "OTHER:S-1-5-21-1111111111-2222222222-3333333333:30000-40000",
+		"-which-domain",
+	}
+
+	tests := []struct {
+		name       string
+		sid        string
+		wantCode   int
+		wantStdout string
+	}{
+		{name: "first domain", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", wantCode: exitOK, wantStdout: "EXAMPLE\n"},
+		{name: "second domain", sid: "S-1-5-21-1111111111-2222222222-3333333333-1013", wantCode: exitOK, wantStdout: "OTHER\n"},
+		{name: "unknown domain", sid: "S-1-5-21-1234567890-1234567890-1234567890-1013", wantCode: exitNotFound, wantStdout: "no match\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, "", append(domainArgs, tt.sid)...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.wantCode, stderr)
+			}
+			if stdout != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout, tt.wantStdout)
+			}
+		})
+	}
+}
+
+func TestRun_VerifyRange(t *testing.T) {
+	requireLibrary(t)
+
+	domainArgs := []string{
+		"-domain", "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-20000",
+		"-domain", "OTHER:S-1-5-21-1111111111-2222222222-3333333333:30000-40000",
+		"-verify-range",
+	}
+
+	t.Run("round-trips", func(t *testing.T) {
+		code, stdout, stderr := runCLI(t, "", append(domainArgs, "-rid-start", "1000", "-rid-end", "1010")...)
+		if code != exitOK {
+			t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitOK, stderr)
+		}
+		if stdout != "" {
+			t.Errorf("stdout = %q, want no failures", stdout)
+		}
+		if !strings.Contains(stderr, "checked=22") {
+			t.Errorf("stderr does not report 22 checked SIDs: %s", stderr)
+		}
+	})
+
+	t.Run("beyond the range", func(t *testing.T) {
+		code, stdout, _ := runCLI(t, "", append(domainArgs, "-rid-start", "9999", "-rid-end", "10001")...)
+		if code == exitOK {
+			t.Error("exit code = 0, want non-zero")
+		}
+		lines := strings.Split(strings.TrimSpace(stdout), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], "S-1-5-21-3623811015-3361044348-30300820-10001\t") ||
+			!strings.HasPrefix(lines[1], "S-1-5-21-1111111111-2222222222-3333333333-10001\t") {
+			t.Errorf("stdout = %q, want RID 10001 of both domains reported", stdout)
+		}
+	})
+
+	for _, args := range [][]string{
+		{"-rid-start", "1000"},
+		{"-rid-end", "1000"},
+		{"-rid-start", "2000", "-rid-end", "1000"},
+		{"-rid-start", "0", "-rid-end", "4294967295"},
+	} {
+		if code, _, _ := runCLI(t, "", append(domainArgs, args...)...); code != exitInternal {
+			t.Errorf("%v: exit code = %d, want %d", args, code, exitInternal)
+		}
+	}
+}
+
+func TestRun_LintSSSDConf(t *testing.T) {
+	code, stdout, stderr := runCLI(t, "", "-lint-sssd-conf", "testdata/overlap.sssd.conf")
+	if code != exitConfig {
+		t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitConfig, stderr)
+	}
+	want := "testdata/overlap.sssd.conf:14: [domain/lab.example.com] slices 300000-2000199999 overlap [domain/example.com] (line 4) slices 200000-2000199999\n"
+	if stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+
+	t.Run("overlap beyond the first slice", func(t *testing.T) {
+		// The first slices are 200000-399999 and 1000000-1099999, but example.com's trusted
+		// domains can be hashed to slices that cover 1000000
+		code, stdout, stderr := runCLI(t, "", "-lint-sssd-conf", "testdata/later-slice.sssd.conf")
+		if code != exitConfig {
+			t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitConfig, stderr)
+		}
+		want := "testdata/later-slice.sssd.conf:9: [domain/lab.example.com] slices 1000000-1099999 overlap [domain/example.com] (line 4) slices 200000-2000199999\n"
+		if stdout != want {
+			t.Errorf("stdout = %q, want %q", stdout, want)
+		}
+	})
+
+	t.Run("no overlaps", func(t *testing.T) {
+		code, stdout, stderr := runCLI(t, "", "-lint-sssd-conf", "testdata/clean.sssd.conf")
+		if code != 0 {
+			t.Errorf("exit code = %d, want 0 (stderr: %s)", code, stderr)
+		}
+		if stdout != "" {
+			t.Errorf("stdout = %q, want no conflicts reported", stdout)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if code, _, _ := runCLI(t, "", "-lint-sssd-conf", "testdata/missing.sssd.conf"); code == 0 {
+			t.Error("exit code = 0, want non-zero")
+		}
+	})
+}
+
+func TestRun_AllowDomainSID(t *testing.T) {
+	requireLibrary(t)
+
+	args := []string{
+		"-domain", "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-20000",
+		"-domain", "OTHER:S-1-5-21-1111111111-2222222222-3333333333:30000-40000",
+		"-allow-domain-sid", "S-1-5-21-3623811015-3361044348-30300820",
+	}
+
+	code, stdout, stderr := runCLI(t, "", append(args, "S-1-5-21-3623811015-3361044348-30300820-1013")...)
+	if code != 0 || stdout != "11013\n" {
+		t.Errorf("allowed SID: exit code = %d, stdout = %q, want 0 and %q (stderr: %s)", code, stdout, "11013\n", stderr)
+	}
+
+	code, stdout, stderr = runCLI(t, "", append(args, "S-1-5-21-1111111111-2222222222-3333333333-1013")...)
+	if code != exitNotFound {
+		t.Errorf("disallowed SID: exit code = %d, want %d", code, exitNotFound)
+	}
+	if stdout != "" {
+		t.Errorf("disallowed SID: stdout = %q, want no output", stdout)
+	}
+	if !strings.Contains(stderr, "allow-domain-sid") {
+		t.Errorf("disallowed SID: stderr does not explain the rejection: %s", stderr)
+	}
+}
+
+func TestRun_File(t *testing.T) {
+	requireLibrary(t)
+
+	args := append(slices.Clone(exampleDomainArgs), "-file", "testdata/sids1.txt", "-file", "-", "-file", "testdata/sids2.txt")
+	stdin := "S-1-5-21-3623811015-3361044348-30300820-1000\n"
+
+	code, stdout, stderr := runCLI(t, stdin, args...)
+	if code != exitInvalidSID {
+		t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitInvalidSID, stderr)
+	}
+	want := "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n" +
+		"S-1-5-21-3623811015-3361044348-30300820-500\t10500\n" +
+		"S-1-5-21-3623811015-3361044348-30300820-1000\t11000\n" +
+		"S-1-5-21-3623811015-3361044348-30300820-513\t10513\n"
+	if stdout != want {
+		t.Errorf("stdout = %q, want %q", stdout, want)
+	}
+	if !strings.Contains(stderr, "file=testdata/sids2.txt line=3") {
+		t.Errorf("stderr does not report the offending file and line: %s", stderr)
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		args := append(slices.Clone(exampleDomainArgs), "-file", "testdata/missing.txt")
+		if code, _, _ := runCLI(t, "", args...); code == 0 {
+			t.Error("exit code = 0, want non-zero")
+		}
+	})
+}
+
+// failingWriter accepts limit writes and then fails every write with err
+type failingWriter struct {
+	bytes.Buffer
+	limit int
+	err   error
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.limit == 0 {
+		return 0, f.err
+	}
+	f.limit--
+	return f.Buffer.Write(p)
+}
+
+func TestRun_OutputClosed(t *testing.T) {
+	requireLibrary(t)
+
+	input := strings.Join([]string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+		"S-1-5-21-3623811015-3361044348-30300820-513",
+	}, "\n")
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantLogs bool
+	}{
+		{name: "closed pipe", err: io.ErrClosedPipe, wantCode: exitOutputClosed},
+		{name: "broken pipe", err: &os.PathError{Op: "write", Path: "/dev/stdout", Err: syscall.EPIPE}, wantCode: exitOutputClosed},
+		{name: "other error", err: errors.New("disk full"), wantCode: exitInternal, wantLogs: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &failingWriter{limit: 1, err: tt.err}
+			var stderr bytes.Buffer
+			code := run(append(exampleDomainArgs, "-batch"), strings.NewReader(input), stdout, &stderr)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+			}
+			if got := stdout.String(); got != "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n" {
+				t.Errorf("stdout = %q, want only the first result", got)
+			}
+			if logged := strings.Contains(stderr.String(), "level=ERROR"); logged != tt.wantLogs {
+				t.Errorf("error logged = %v, want %v (stderr: %s)", logged, tt.wantLogs, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRun_OutputPipeClosed(t *testing.T) {
+	requireLibrary(t)
+
+	// Writes to a closed pipe fail with EPIPE here as they do in main, which ignores SIGPIPE
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdoutW.Close()
+	var stderr bytes.Buffer
+	done := make(chan int, 1)
+	go func() {
+		done <- run(append(slices.Clone(exampleDomainArgs), "-batch"), stdinR, stdoutW, &stderr)
+	}()
+
+	if _, err := io.WriteString(stdinW, "S-1-5-21-3623811015-3361044348-30300820-1013\n"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := bufio.NewReader(stdoutR).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the first result: %v", err)
+	}
+	if got != "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n" {
+		t.Errorf("first result = %q", got)
+	}
+	stdoutR.Close()
+
+	// The next result hits the closed pipe and stops the batch, so the rest is never read
+	go io.WriteString(stdinW, "S-1-5-21-3623811015-3361044348-30300820-513\nS-1-5-21-3623811015-3361044348-30300820-500\n")
+	if code := <-done; code != exitOutputClosed {
+		t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitOutputClosed, stderr.String())
+	}
+	stdinW.Close()
+	if strings.Contains(stderr.String(), "level=ERROR") {
+		t.Errorf("closed output logged as an error: %s", stderr.String())
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "S-1-5-21-3623811015-3361044348-30300820-1013", want: "S-1-5-21-3623811015-3361044348-30300820-1013"},
+		{in: "well-known", want: "well-known"},
+		{in: "", want: "''"},
+		{in: "a b", want: "'a b'"},
+		{in: "$(reboot)", want: "'$(reboot)'"},
+		{in: "it's", want: `'it'\''s'`},
+	}
+
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRun_NoNewline(t *testing.T) {
+	requireLibrary(t)
+
+	sid := "S-1-5-21-3623811015-3361044348-30300820-1013"
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout string
+	}{
+		{name: "default", args: []string{sid}, wantCode: exitOK, wantStdout: "11013\n"},
+		{name: "-n", args: []string{"-n", sid}, wantCode: exitOK, wantStdout: "11013"},
+		{name: "-n with -batch", args: []string{"-n", "-batch"}, wantCode: exitInternal},
+		{name: "-n with -json", args: []string{"-n", "-json", sid}, wantCode: exitInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(slices.Clone(exampleDomainArgs), tt.args...)
+			code, stdout, stderr := runCLI(t, sid+"\n", args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.wantCode, stderr)
+			}
+			if stdout != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout, tt.wantStdout)
+			}
+		})
+	}
+}
+
+func TestRun_TypedID(t *testing.T) {
+	requireLibrary(t)
+
+	user := "S-1-5-21-3623811015-3361044348-30300820-500"
+	group := "S-1-5-21-3623811015-3361044348-30300820-513"
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantCode   int
+		wantStdout string
+	}{
+		{name: "user", args: []string{"-typed-id=uid", user}, wantCode: exitOK, wantStdout: "uid:10500\n"},
+		{name: "group", args: []string{"-typed-id=gid", group}, wantCode: exitOK, wantStdout: "gid:10513\n"},
+		{name: "ordinary account", args: []string{"-typed-id=uid", "S-1-5-21-3623811015-3361044348-30300820-1013"}, wantCode: exitOK, wantStdout: "uid:11013\n"},
+		{
+			name:       "batch",
+			args:       []string{"-typed-id=gid", "-batch"},
+			stdin:      user + "\n" + group + "\n",
+			wantCode:   exitOK,
+			wantStdout: user + "\tgid:10500\n" + group + "\tgid:10513\n",
+		},
+		{name: "unknown type", args: []string{"-typed-id=sid", user}, wantCode: exitInternal},
+		{name: "without a type", args: []string{"-typed-id", user}, wantCode: exitInternal},
+		{name: "with -json", args: []string{"-typed-id=uid", "-json", user}, wantCode: exitInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(slices.Clone(exampleDomainArgs), tt.args...)
+			code, stdout, stderr := runCLI(t, tt.stdin, args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.wantCode, stderr)
+			}
+			if stdout != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout, tt.wantStdout)
+			}
+		})
+	}
+}
+
+func TestRun_Progress(t *testing.T) {
+	requireLibrary(t)
+
+	stdin := "S-1-5-21-3623811015-3361044348-30300820-1013\nnot-a-sid\nS-1-5-21-3623811015-3361044348-30300820-500\n"
+	wantStdout := "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\nS-1-5-21-3623811015-3361044348-30300820-500\t10500\n"
+
+	tests := []struct {
+		name         string
+		flag         string
+		wantProgress bool
+	}{
+		{name: "forced", flag: "-progress=always", wantProgress: true},
+		// The test's stderr is a buffer, not a terminal
+		{name: "auto without a terminal", flag: "-progress", wantProgress: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(slices.Clone(exampleDomainArgs), "-batch", tt.flag)
+			code, stdout, stderr := runCLI(t, stdin, args...)
+			if code != exitInvalidSID {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitInvalidSID, stderr)
+			}
+			if stdout != wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout, wantStdout)
+			}
+			if got := strings.Contains(stderr, "processed 3 / errors 1\n"); got != tt.wantProgress {
+				t.Errorf("stderr progress line present = %v, want %v (stderr: %s)", got, tt.wantProgress, stderr)
+			}
+		})
+	}
+}
+
+func TestRun_PercentDecode(t *testing.T) {
+	requireLibrary(t)
+
+	const encoded = "S%2D1%2D5%2D21%2D3623811015%2D3361044348%2D30300820%2D1013"
+
+	code, stdout, stderr := runCLI(t, "", append(slices.Clone(exampleDomainArgs), encoded)...)
+	if code != exitInvalidSID {
+		t.Errorf("exit code without -percent-decode = %d, want %d (stderr: %s)", code, exitInvalidSID, stderr)
+	}
+
+	code, stdout, stderr = runCLI(t, "", append(slices.Clone(exampleDomainArgs), "-percent-decode", encoded)...)
+	if code != exitOK {
+		t.Errorf("exit code = %d, want %d (stderr: %s)", code, exitOK, stderr)
+	}
+	if stdout != "11013\n" {
+		t.Errorf("stdout = %q, want %q", stdout, "11013\n")
+	}
+}
+
+func TestRun_PercentDecodeCombined(t *testing.T) {
+	requireLibrary(t)
+
+	const (
+		encoded      = "S%2D1%2D5%2D21%2D3623811015%2D3361044348%2D30300820%2D1013"
+		encodedOther = "S%2D1%2D5%2D21%2D1111111111%2D2222222222%2D3333333333%2D1013"
+	)
+	domainArgs := []string{
+		"-domain", "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-20000",
+		"-domain", "OTHER:S-1-5-21-1111111111-2222222222-3333333333:30000-40000",
+		"-percent-decode",
+	}
+	allowArgs := append(slices.Clone(domainArgs), "-allow-domain-sid", "S-1-5-21-3623811015-3361044348-30300820")
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantCode   int
+		wantStdout string
+	}{
+		{name: "-which-domain", args: append(slices.Clone(domainArgs), "-which-domain", encoded), wantCode: exitOK, wantStdout: "EXAMPLE\n"},
+		{name: "-which-domain other", args: append(slices.Clone(domainArgs), "-which-domain", encodedOther), wantCode: exitOK, wantStdout: "OTHER\n"},
+		{name: "-which-domain malformed", args: append(slices.Clone(domainArgs), "-which-domain", "S-1-5-21%ZZ"), wantCode: exitInvalidSID},
+		{name: "allowed", args: append(slices.Clone(allowArgs), encoded), wantCode: exitOK, wantStdout: "11013\n"},
+		{name: "disallowed", args: append(slices.Clone(allowArgs), encodedOther), wantCode: exitNotFound},
+		{
+			name:       "batch allowlist",
+			args:       append(slices.Clone(allowArgs), "-batch"),
+			stdin:      encoded + "\n" + encodedOther + "\n",
+			wantCode:   exitNotFound,
+			wantStdout: "S-1-5-21-3623811015-3361044348-30300820-1013\t11013\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := runCLI(t, tt.stdin, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.wantCode, stderr)
+			}
+			if stdout != tt.wantStdout {
+				t.Errorf("stdout = %q, want %q", stdout, tt.wantStdout)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// result is a single successful SID conversion
+type result struct {
+	SID    string `json:"sid"`
+	UnixID uint32 `json:"unix_id"`
+}
+
+// ErrOutputClosed reports that the reader of the output went away mid-stream, as when
+// piping a batch into head; main ignores SIGPIPE so such writes fail with EPIPE instead
+// of killing the process
+var ErrOutputClosed = errors.New("output closed")
+
+// outputWriter marks the errors of a closed pipe or broken connection with ErrOutputClosed
+type outputWriter struct {
+	w io.Writer
+}
+
+func (o outputWriter) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	if errors.Is(err, io.ErrClosedPipe) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		err = fmt.Errorf("%w: %w", ErrOutputClosed, err)
+	}
+	return n, err
+}
+
+// writeFailed reports a failure to write results and returns the exit code
+// A closed output is expected when the reader stops early, so it stops the run quietly
+// with exitOutputClosed instead of being logged as an internal error
+func writeFailed(logger *slog.Logger, err error) int {
+	if errors.Is(err, ErrOutputClosed) {
+		logger.Debug("output closed, stopping", "error", err)
+		return exitOutputClosed
+	}
+	logger.Error("failed to write output", "error", err)
+	return exitInternal
+}
+
+// resultWriter renders conversion results in one output format
+type resultWriter interface {
+	Write(r result) error
+	// Close finishes the output, e.g. terminating a JSON array
+	Close() error
+}
+
+// plainWriter prints the bare ID for single conversions and "SID<TAB>ID" lines in batch mode
+// noNewline drops the newline after a single ID, for capturing it in a shell variable, and
+// a non-empty idType ("uid" or "gid") prefixes IDs as in uid:11013
+type plainWriter struct {
+	w         io.Writer
+	batch     bool
+	noNewline bool
+	idType    string
+}
+
+func (p *plainWriter) Write(r result) error {
+	id := strconv.FormatUint(uint64(r.UnixID), 10)
+	if p.idType != "" {
+		id = p.idType + ":" + id
+	}
+
+	if p.batch {
+		_, err := fmt.Fprintf(p.w, "%s\t%s\n", r.SID, id)
+		return err
+	}
+	if p.noNewline {
+		_, err := io.WriteString(p.w, id)
+		return err
+	}
+	_, err := fmt.Fprintln(p.w, id)
+	return err
+}
+
+func (p *plainWriter) Close() error {
+	return nil
+}
+
+// jsonWriter prints a JSON object for single conversions and a JSON array in batch mode
+type jsonWriter struct {
+	w       io.Writer
+	batch   bool
+	written int
+}
+
+func (j *jsonWriter) Write(r result) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if !j.batch {
+		_, err = fmt.Fprintf(j.w, "%s\n", data)
+		return err
+	}
+
+	sep := ",\n  "
+	if j.written == 0 {
+		sep = "[\n  "
+	}
+	j.written++
+	_, err = fmt.Fprintf(j.w, "%s%s", sep, data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	if !j.batch {
+		return nil
+	}
+	if j.written == 0 {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+// envWriter prints shell assignments for eval: SSS_IDMAP_SID, SSS_IDMAP_UID and SSS_IDMAP_TYPE,
+// which is the -typed-id type (uid or gid), or id when none was given since the same number
+// then serves as both; in batch mode the names carry a _N suffix per result
+type envWriter struct {
+	w       io.Writer
+	batch   bool
+	idType  string
+	written int
+}
+
+func (e *envWriter) Write(r result) error {
+	e.written++
+	suffix := ""
+	if e.batch {
+		suffix = fmt.Sprintf("_%d", e.written)
+	}
+	idType := e.idType
+	if idType == "" {
+		idType = "id"
+	}
+
+	_, err := fmt.Fprintf(e.w, "SSS_IDMAP_SID%s=%s\nSSS_IDMAP_UID%s=%d\nSSS_IDMAP_TYPE%s=%s\n",
+		suffix, shellQuote(r.SID),
+		suffix, r.UnixID,
+		suffix, idType)
+	return err
+}
+
+func (e *envWriter) Close() error {
+	return nil
+}
+
+// shellQuote returns s unchanged if it only holds characters that are safe unquoted in
+// POSIX shells, and single-quoted otherwise
+func shellQuote(s string) string {
+	safe := s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_.,:/+=@", r))
+	}) < 0
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
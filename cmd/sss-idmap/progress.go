@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// progressInterval is the number of SIDs between progress lines
+const progressInterval = 1000
+
+// progressFlag is the -progress setting: bare -progress reports only when stderr is a
+// terminal, -progress=always reports regardless
+type progressFlag struct {
+	enabled bool
+	always  bool
+}
+
+func (p *progressFlag) String() string {
+	switch {
+	case p == nil || !p.enabled:
+		return "false"
+	case p.always:
+		return "always"
+	default:
+		return "true"
+	}
+}
+
+func (p *progressFlag) Set(s string) error {
+	switch s {
+	case "true":
+		*p = progressFlag{enabled: true}
+	case "always":
+		*p = progressFlag{enabled: true, always: true}
+	case "false":
+		*p = progressFlag{}
+	default:
+		return fmt.Errorf("want true, false or always, got %q", s)
+	}
+	return nil
+}
+
+func (p *progressFlag) IsBoolFlag() bool {
+	return true
+}
+
+// reporter returns the progress reporter for this setting, or nil when progress is off
+func (p *progressFlag) reporter(stderr io.Writer) *progress {
+	if !p.enabled || (!p.always && !isTerminal(stderr)) {
+		return nil
+	}
+	return &progress{w: stderr}
+}
+
+// isTerminal reports whether w is a character device such as a terminal
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progress prints "processed N / errors M" lines every progressInterval SIDs and when
+// done; a nil *progress reports nothing
+type progress struct {
+	w         io.Writer
+	processed int
+	errors    int
+}
+
+// record counts one converted SID, err being its conversion error
+func (p *progress) record(err error) {
+	if p == nil {
+		return
+	}
+	p.processed++
+	if err != nil {
+		p.errors++
+	}
+	if p.processed%progressInterval == 0 {
+		p.print()
+	}
+}
+
+// done prints the final counts unless the last line already showed them
+func (p *progress) done() {
+	if p == nil || (p.processed > 0 && p.processed%progressInterval == 0) {
+		return
+	}
+	p.print()
+}
+
+func (p *progress) print() {
+	fmt.Fprintf(p.w, "processed %d / errors %d\n", p.processed, p.errors)
+}
@@ -0,0 +1,30 @@
+//go:build nosssidmap
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRun_LibraryUnavailable(t *testing.T) {
+	args := append(slices.Clone(exampleDomainArgs), "S-1-5-21-3623811015-3361044348-30300820-1013")
+	code, stdout, stderr := runCLI(t, "", args...)
+	if code != exitInternal {
+		t.Errorf("exit code = %d, want %d", code, exitInternal)
+	}
+	if stdout != "" {
+		t.Errorf("stdout = %q, want no output", stdout)
+	}
+	want := "Error: built without libsss_idmap"
+	if !strings.HasPrefix(stderr, want) {
+		t.Errorf("stderr = %q, want it to start with %q", stderr, want)
+	}
+}
+
+// requireLibrary skips tests that need libsss_idmap, which this build does not link
+func requireLibrary(tb testing.TB) {
+	tb.Helper()
+	tb.Skip("needs libsss_idmap; built with -tags nosssidmap")
+}
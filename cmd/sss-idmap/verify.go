@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// maxVerifyRIDs caps the RID window of -verify-range so a typo cannot start a
+// multi-billion iteration run
+const maxVerifyRIDs = 1 << 20
+
+// verifyRIDRange builds the SID of every RID from start to end in each domain, maps it to
+// its Unix ID and back, and prints each SID that fails to round-trip with the reason
+// The exit code is that of the first failure
+func verifyRIDRange(ctx *idmap.IDMapContext, domains []idmap.DomainConfig, start, end uint32, stdout io.Writer, logger *slog.Logger) int {
+	exitCode := exitOK
+	checked, failed := 0, 0
+	for _, domain := range domains {
+		for rid := uint64(start); rid <= uint64(end); rid++ {
+			sid, err := idmap.BuildSID(domain.DomainSID, uint32(rid))
+			if err == nil {
+				err = ctx.VerifyRoundTrip(sid)
+			}
+			checked++
+			if err == nil {
+				continue
+			}
+
+			failed++
+			fmt.Fprintf(stdout, "%s\t%v\n", sid, err)
+			if exitCode == exitOK {
+				exitCode = exitCodeFor(err)
+			}
+		}
+	}
+
+	logger.Info("verified RID range", "start", start, "end", end, "checked", checked, "failed", failed)
+	return exitCode
+}
@@ -0,0 +1,41 @@
+package idmap
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// SIDsToUnixIDs converts sids concurrently with mapper and returns one result per SID
+// Results are guaranteed to be in input order: the result at index i is always that of
+// sids[i], since every worker writes into the pre-allocated slot of the SID it converted
+// WithWorkers bounds the concurrency; WithBufferSize has no effect here
+func SIDsToUnixIDs(mapper IDMapper, sids []string, opts ...StreamOption) []StreamResult {
+	cfg := streamConfig{workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	results := make([]StreamResult, len(sids))
+	var (
+		next atomic.Int64
+		wg   sync.WaitGroup
+	)
+	for range min(cfg.workers, len(sids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(sids) {
+					return
+				}
+				unixID, err := mapper.SIDToUnixID(sids[i])
+				results[i] = StreamResult{SID: sids[i], UnixID: unixID, Err: err}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,65 @@
+package idmap_test
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestSIDsToUnixIDs(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	sids := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"not-a-sid",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+	}
+	results := idmap.SIDsToUnixIDs(ctx, sids)
+	if len(results) != len(sids) {
+		t.Fatalf("SIDsToUnixIDs() returned %d results, want %d", len(results), len(sids))
+	}
+	if r := results[0]; r.Err != nil || r.UnixID != 11013 {
+		t.Errorf("results[0] = %+v, want 11013", r)
+	}
+	if r := results[1]; !errors.Is(r.Err, idmap.ErrInvalidSID) {
+		t.Errorf("results[1] = %+v, want ErrInvalidSID", r)
+	}
+	if r := results[2]; r.Err != nil || r.UnixID != 10500 {
+		t.Errorf("results[2] = %+v, want 10500", r)
+	}
+
+	if got := idmap.SIDsToUnixIDs(ctx, nil); len(got) != 0 {
+		t.Errorf("SIDsToUnixIDs(nil) = %v, want no results", got)
+	}
+}
+
+func TestSIDsToUnixIDs_Order(t *testing.T) {
+	const n = 10000
+
+	rids := make([]uint32, n)
+	for i := range rids {
+		rids[i] = uint32(i)
+	}
+	rand.New(rand.NewPCG(1, 2)).Shuffle(n, func(i, j int) { rids[i], rids[j] = rids[j], rids[i] })
+
+	sids := make([]string, n)
+	for i, rid := range rids {
+		sids[i] = fmt.Sprintf("S-1-5-21-1-2-3-%d", rid)
+	}
+
+	for _, workers := range []int{1, 8, 64} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			results := idmap.SIDsToUnixIDs(ridMapper{}, sids, idmap.WithWorkers(workers))
+			for i, r := range results {
+				if r.SID != sids[i] || r.Err != nil || r.UnixID != rids[i] {
+					t.Fatalf("results[%d] = %+v, want %s mapped to %d", i, r, sids[i], rids[i])
+				}
+			}
+		})
+	}
+}
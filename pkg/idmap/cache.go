@@ -0,0 +1,109 @@
+package idmap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// cacheEntry is a memoized conversion result
+type cacheEntry struct {
+	id  uint32
+	err error
+}
+
+// CachingIDMap is an IDMapper decorator that memoizes conversion results
+// String SIDs and binary SIDs are cached separately, the latter keyed on the raw
+// bytes so repeated lookups skip both decoding and the cgo call
+// Invalid, not-found and unmappable SIDs are cached as negatives; other errors are not
+// The lock is only held around map accesses, never across a conversion, so a miss does
+// not hold up lookups of other SIDs
+type CachingIDMap struct {
+	mapper IDMapper
+
+	mu      sync.Mutex
+	sids    map[string]cacheEntry
+	binSIDs map[string]cacheEntry
+
+	// hits and misses are atomic so Stats does not take mu; lookups still do
+	hits, misses atomic.Uint64
+}
+
+// NewCachingIDMap wraps mapper with a result cache
+func NewCachingIDMap(mapper IDMapper) *CachingIDMap {
+	return &CachingIDMap{
+		mapper:  mapper,
+		sids:    make(map[string]cacheEntry),
+		binSIDs: make(map[string]cacheEntry),
+	}
+}
+
+// SIDToUnixID converts a string SID, consulting the cache first
+func (m *CachingIDMap) SIDToUnixID(sid string) (uint32, error) {
+	return m.lookup(m.sids, sid, func() (uint32, error) {
+		return m.mapper.SIDToUnixID(sid)
+	})
+}
+
+// BinSIDToUnixID converts a binary SID, consulting the cache keyed on its raw bytes first
+func (m *CachingIDMap) BinSIDToUnixID(sid []byte) (uint32, error) {
+	return m.lookup(m.binSIDs, string(sid), func() (uint32, error) {
+		return m.mapper.BinSIDToUnixID(sid)
+	})
+}
+
+// lookup returns the entry of key in cache, or calls convert without holding the lock
+// and stores its result if it is cacheable
+// Concurrent misses of one key may each call convert; they store the same result
+func (m *CachingIDMap) lookup(cache map[string]cacheEntry, key string, convert func() (uint32, error)) (uint32, error) {
+	m.mu.Lock()
+	e, ok := cache[key]
+	m.mu.Unlock()
+	if ok {
+		m.hits.Add(1)
+		return e.id, e.err
+	}
+	m.misses.Add(1)
+
+	id, err := convert()
+	if cacheable(err) {
+		m.mu.Lock()
+		cache[key] = cacheEntry{id: id, err: err}
+		m.mu.Unlock()
+	}
+	return id, err
+}
+
+// Warm converts sids up front, concurrently through SIDsToUnixIDs, and caches the results so
+// that later lookups of them are hits; it does not count towards Stats
+// Negatives are cached as by any other lookup; the errors that are never cached are
+// returned, joined
+func (m *CachingIDMap) Warm(sids []string) error {
+	results := SIDsToUnixIDs(m.mapper, sids)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, r := range results {
+		if !cacheable(r.Err) {
+			errs = append(errs, fmt.Errorf("%s: %w", r.SID, r.Err))
+			continue
+		}
+		m.sids[r.SID] = cacheEntry{id: r.UnixID, err: r.Err}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the cache hits and misses accumulated so far
+func (m *CachingIDMap) Stats() CacheStats {
+	return CacheStats{Hits: m.hits.Load(), Misses: m.misses.Load()}
+}
+
+// cacheable reports whether a conversion result is stable enough to memoize
+// Only errors that depend on the SID alone are; ErrLibraryUnavailable, internal errors and
+// whatever an ErrorHook returns may differ on the next call
+func cacheable(err error) bool {
+	return err == nil || errors.Is(err, ErrInvalidSID) || errors.Is(err, ErrNotFound) || errors.Is(err, ErrNotMappable)
+}
@@ -0,0 +1,240 @@
+package idmap_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// countingMapper records how many conversions reach the wrapped mapper
+type countingMapper struct {
+	idmap.IDMapper
+	mu       sync.Mutex
+	calls    int
+	binCalls map[string]int
+}
+
+func (m *countingMapper) SIDToUnixID(sid string) (uint32, error) {
+	m.mu.Lock()
+	m.calls++
+	m.mu.Unlock()
+	return m.IDMapper.SIDToUnixID(sid)
+}
+
+func (m *countingMapper) BinSIDToUnixID(sid []byte) (uint32, error) {
+	if m.binCalls == nil {
+		m.binCalls = make(map[string]int)
+	}
+	m.binCalls[string(sid)]++
+	return m.IDMapper.BinSIDToUnixID(sid)
+}
+
+func newExampleContext(t *testing.T) *idmap.IDMapContext {
+	t.Helper()
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	})
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	t.Cleanup(func() { ctx.Close() })
+
+	return ctx
+}
+
+func TestCachingIDMap_BinSIDToUnixID(t *testing.T) {
+	requireLibrary(t)
+
+	counter := &countingMapper{IDMapper: newExampleContext(t)}
+	cache := idmap.NewCachingIDMap(counter)
+
+	tests := []struct {
+		hexSID     string
+		wantUnixID uint32
+	}{
+		{hexSID: "010500000000000515000000c7f7fed77c7755c8945ace01f5030000", wantUnixID: 11013},
+		{hexSID: "010500000000000515000000c7f7fed77c7755c8945ace01f4010000", wantUnixID: 10500},
+	}
+
+	for round := 0; round < 3; round++ {
+		for _, tt := range tests {
+			sid, _ := hex.DecodeString(tt.hexSID)
+			got, err := cache.BinSIDToUnixID(sid)
+			if err != nil {
+				t.Fatalf("BinSIDToUnixID(%s) failed: %v", tt.hexSID, err)
+			}
+			if got != tt.wantUnixID {
+				t.Errorf("BinSIDToUnixID(%s) = %d, want %d", tt.hexSID, got, tt.wantUnixID)
+			}
+		}
+	}
+
+	if len(counter.binCalls) != len(tests) {
+		t.Errorf("underlying mapper saw %d distinct SIDs, want %d", len(counter.binCalls), len(tests))
+	}
+	for key, n := range counter.binCalls {
+		if n != 1 {
+			t.Errorf("underlying BinSIDToUnixID called %d times for %x, want 1", n, key)
+		}
+	}
+}
+
+func TestCachingIDMap_SIDToUnixID(t *testing.T) {
+	requireLibrary(t)
+
+	counter := &countingMapper{IDMapper: newExampleContext(t)}
+	cache := idmap.NewCachingIDMap(counter)
+
+	for i := 0; i < 3; i++ {
+		got, err := cache.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013")
+		if err != nil || got != 11013 {
+			t.Fatalf("SIDToUnixID() = %d, %v, want 11013", got, err)
+		}
+
+		// Not-found results are cached too
+		if _, err := cache.SIDToUnixID("S-1-5-21-1111111111-2222222222-3333333333-1001"); !errors.Is(err, idmap.ErrNotFound) {
+			t.Fatalf("SIDToUnixID() = %v, want ErrNotFound", err)
+		}
+	}
+
+	if counter.calls != 2 {
+		t.Errorf("underlying SIDToUnixID called %d times, want 2", counter.calls)
+	}
+}
+
+func TestCachingIDMap_Warm(t *testing.T) {
+	requireLibrary(t)
+
+	counter := &countingMapper{IDMapper: newExampleContext(t)}
+	cache := idmap.NewCachingIDMap(counter)
+
+	sids := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+		"S-1-5-21-1111111111-2222222222-3333333333-1001",
+		"not-a-sid",
+	}
+	if err := cache.Warm(sids); err != nil {
+		t.Fatalf("Warm() error = %v", err)
+	}
+	if counter.calls != len(sids) {
+		t.Fatalf("Warm() made %d underlying calls, want %d", counter.calls, len(sids))
+	}
+
+	if got, err := cache.SIDToUnixID(sids[0]); err != nil || got != 11013 {
+		t.Errorf("SIDToUnixID(%s) = %d, %v, want 11013", sids[0], got, err)
+	}
+	if got, err := cache.SIDToUnixID(sids[1]); err != nil || got != 10500 {
+		t.Errorf("SIDToUnixID(%s) = %d, %v, want 10500", sids[1], got, err)
+	}
+	if _, err := cache.SIDToUnixID(sids[2]); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("SIDToUnixID(%s) = %v, want ErrNotFound", sids[2], err)
+	}
+	if _, err := cache.SIDToUnixID(sids[3]); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("SIDToUnixID(%s) = %v, want ErrInvalidSID", sids[3], err)
+	}
+
+	if counter.calls != len(sids) {
+		t.Errorf("lookups after Warm() made %d underlying calls, want none", counter.calls-len(sids))
+	}
+	if stats := cache.Stats(); stats.Hits != 4 || stats.Misses != 0 {
+		t.Errorf("Stats() = %+v, want 4 hits and no misses", stats)
+	}
+}
+
+// funcMapper converts string SIDs with convert and counts the calls that reach it
+type funcMapper struct {
+	idmap.IDMapper
+	convert func(sid string) (uint32, error)
+	calls   atomic.Int64
+}
+
+func (m *funcMapper) SIDToUnixID(sid string) (uint32, error) {
+	m.calls.Add(1)
+	return m.convert(sid)
+}
+
+func TestCachingIDMap_NegativeCaching(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCached bool
+	}{
+		{name: "invalid SID", err: fmt.Errorf("%w: bad", idmap.ErrInvalidSID), wantCached: true},
+		{name: "not found", err: fmt.Errorf("%w: unknown domain", idmap.ErrNotFound), wantCached: true},
+		{name: "not mappable", err: fmt.Errorf("%w: integrity label", idmap.ErrNotMappable), wantCached: true},
+		{name: "internal", err: fmt.Errorf("%w: boom", idmap.ErrInternal)},
+		{name: "library unavailable", err: idmap.ErrLibraryUnavailable},
+		{name: "error hook", err: errors.New("directory unreachable")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := &funcMapper{convert: func(string) (uint32, error) { return 0, tt.err }}
+			cache := idmap.NewCachingIDMap(mapper)
+
+			for range 2 {
+				if _, err := cache.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013"); !errors.Is(err, tt.err) {
+					t.Fatalf("SIDToUnixID() error = %v, want %v", err, tt.err)
+				}
+			}
+			wantCalls := int64(2)
+			if tt.wantCached {
+				wantCalls = 1
+			}
+			if got := mapper.calls.Load(); got != wantCalls {
+				t.Errorf("underlying SIDToUnixID called %d times, want %d", got, wantCalls)
+			}
+		})
+	}
+}
+
+func TestCachingIDMap_MissDoesNotBlockHits(t *testing.T) {
+	const (
+		cached = "S-1-5-21-3623811015-3361044348-30300820-1013"
+		slow   = "S-1-5-21-3623811015-3361044348-30300820-500"
+	)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	mapper := &funcMapper{convert: func(sid string) (uint32, error) {
+		if sid == slow {
+			close(started)
+			<-release
+			return 10500, nil
+		}
+		return 11013, nil
+	}}
+	cache := idmap.NewCachingIDMap(mapper)
+	if _, err := cache.SIDToUnixID(cached); err != nil {
+		t.Fatalf("SIDToUnixID() error = %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.SIDToUnixID(slow)
+	}()
+	<-started
+
+	// The slow miss is still inside the mapper; a hit must not wait for it
+	if got, err := cache.SIDToUnixID(cached); err != nil || got != 11013 {
+		t.Errorf("SIDToUnixID(%s) = %d, %v, want 11013", cached, got, err)
+	}
+	close(release)
+	<-done
+
+	if got, err := cache.SIDToUnixID(slow); err != nil || got != 10500 {
+		t.Errorf("SIDToUnixID(%s) = %d, %v, want 10500", slow, got, err)
+	}
+	if got := mapper.calls.Load(); got != 2 {
+		t.Errorf("underlying SIDToUnixID called %d times, want 2", got)
+	}
+}
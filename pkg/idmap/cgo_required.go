@@ -0,0 +1,8 @@
+//go:build !cgo && !nosssidmap
+
+// This file turns a CGO_ENABLED=0 build into a readable compile error: the package links
+// libsss_idmap through cgo, and only the opt-in nosssidmap stub build works without it
+
+package idmap
+
+var _ = requires_cgo__set_CGO_ENABLED_1_or_build_with_tags_nosssidmap
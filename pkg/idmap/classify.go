@@ -0,0 +1,97 @@
+package idmap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AccountClass is the kind of principal a SID identifies
+type AccountClass int
+
+const (
+	// Unknown means the SID structure does not reveal the account kind
+	Unknown AccountClass = iota
+	// User is a user account
+	User
+	// Group is a security group or alias
+	Group
+	// Computer is a machine account; SID structure alone cannot identify one, so ClassifySID
+	// never returns it, but callers enriching results from directory data can
+	Computer
+	// WellKnown is one of the universal or NT AUTHORITY principals from WellKnownSIDs
+	WellKnown
+)
+
+func (a AccountClass) String() string {
+	switch a {
+	case Unknown:
+		return "unknown"
+	case User:
+		return "user"
+	case Group:
+		return "group"
+	case Computer:
+		return "computer"
+	case WellKnown:
+		return "well-known"
+	default:
+		return fmt.Sprintf("AccountClass(%d)", int(a))
+	}
+}
+
+// Well-known RIDs of domain accounts created by AD
+// https://learn.microsoft.com/en-us/windows-server/identity/ad-ds/manage/understand-security-identifiers
+var domainRIDClasses = map[uint32]AccountClass{
+	500: User,  // Administrator
+	501: User,  // Guest
+	502: User,  // krbtgt
+	503: User,  // DefaultAccount
+	504: User,  // WDAGUtilityAccount
+	512: Group, // Domain Admins
+	513: Group, // Domain Users
+	514: Group, // Domain Guests
+	515: Group, // Domain Computers
+	516: Group, // Domain Controllers
+	517: Group, // Cert Publishers
+	518: Group, // Schema Admins
+	519: Group, // Enterprise Admins
+	520: Group, // Group Policy Creator Owners
+	521: Group, // Read-only Domain Controllers
+	522: Group, // Cloneable Domain Controllers
+	525: Group, // Protected Users
+	526: Group, // Key Admins
+	527: Group, // Enterprise Key Admins
+	553: Group, // RAS and IAS Servers
+	571: Group, // Allowed RODC Password Replication Group
+	572: Group, // Denied RODC Password Replication Group
+}
+
+// ClassifySID infers the account class of a SID from its structure and RID
+// Only well-known SIDs, BUILTIN aliases (S-1-5-32-*) and the fixed domain RIDs below 1000
+// can be classified; accounts created by administrators (RID >= 1000) share one RID pool
+// for users, groups and computers and are reported as Unknown
+func ClassifySID(sid string) AccountClass {
+	if IsWellKnownSID(sid) {
+		return WellKnown
+	}
+
+	if ValidateSID(sid) != nil {
+		return Unknown
+	}
+
+	if strings.HasPrefix(sid, "S-1-5-32-") {
+		return Group
+	}
+
+	if !strings.HasPrefix(sid, "S-1-5-21-") {
+		return Unknown
+	}
+
+	rid, err := strconv.ParseUint(sid[strings.LastIndex(sid, "-")+1:], 10, 32)
+	if err != nil {
+		return Unknown
+	}
+
+	return domainRIDClasses[uint32(rid)]
+}
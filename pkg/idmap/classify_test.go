@@ -0,0 +1,39 @@
+package idmap_test
+
+import (
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestClassifySID(t *testing.T) {
+	const domain = "S-1-5-21-3623811015-3361044348-30300820"
+
+	tests := []struct {
+		name string
+		sid  string
+		want idmap.AccountClass
+	}{
+		{name: "administrator", sid: domain + "-500", want: idmap.User},
+		{name: "guest", sid: domain + "-501", want: idmap.User},
+		{name: "krbtgt", sid: domain + "-502", want: idmap.User},
+		{name: "domain admins", sid: domain + "-512", want: idmap.Group},
+		{name: "domain users", sid: domain + "-513", want: idmap.Group},
+		{name: "domain computers", sid: domain + "-515", want: idmap.Group},
+		{name: "builtin administrators", sid: "S-1-5-32-544", want: idmap.WellKnown},
+		{name: "builtin alias not in catalog", sid: "S-1-5-32-578", want: idmap.Group},
+		{name: "everyone", sid: "S-1-1-0", want: idmap.WellKnown},
+		{name: "local system", sid: "S-1-5-18", want: idmap.WellKnown},
+		{name: "regular account", sid: domain + "-1013", want: idmap.Unknown},
+		{name: "unassigned low RID", sid: domain + "-600", want: idmap.Unknown},
+		{name: "invalid", sid: "not-a-sid", want: idmap.Unknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idmap.ClassifySID(tt.sid); got != tt.want {
+				t.Errorf("ClassifySID(%q) = %v, want %v", tt.sid, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package idmap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// UnmarshalJSON accepts a range either as {"min": 10000, "max": 20000} or as "10000-20000"
+func (r *IDRange) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		parsed, err := ParseIDRange(s)
+		if err != nil {
+			return err
+		}
+		*r = parsed
+		return nil
+	}
+
+	// rawRange has IDRange's fields but not its methods, avoiding recursion
+	type rawRange IDRange
+	var raw rawRange
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*r = IDRange(raw)
+	return nil
+}
+
+// UnmarshalJSON decodes a domain configuration and validates it as AddDomainsAtomic would
+func (d *DomainConfig) UnmarshalJSON(data []byte) error {
+	// rawConfig has DomainConfig's fields but not its methods, avoiding recursion
+	type rawConfig DomainConfig
+	var raw rawConfig
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	config := DomainConfig(raw)
+	if err := validateDomainConfig(config, false); err != nil {
+		return err
+	}
+
+	*d = config
+	return nil
+}
+
+// LoadDomainsFromFile reads a JSON array of domain configurations
+// Every entry is validated and all failures are reported together, each naming its index
+func LoadDomainsFromFile(path string) ([]DomainConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	configs := make([]DomainConfig, 0, len(entries))
+	var errs []error
+	for i, entry := range entries {
+		var config DomainConfig
+		if err := json.Unmarshal(entry, &config); err != nil {
+			errs = append(errs, fmt.Errorf("%s: domain %d: %w", path, i, err))
+			continue
+		}
+		configs = append(configs, config)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return configs, nil
+}
+
+// LoadDomainsFromRangesFile reads whitespace-delimited "name sid min max" lines, one domain
+// per line; blank lines and everything after a '#' are ignored
+// Every line is validated and all failures are reported together, each naming its line
+func LoadDomainsFromRangesFile(path string) ([]DomainConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		configs []DomainConfig
+		errs    []error
+	)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		config, err := parseRangesLine(fields)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", path, lineNum, err))
+			continue
+		}
+		configs = append(configs, config)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return configs, nil
+}
+
+// parseRangesLine builds a validated domain configuration from the fields of a ranges file line
+func parseRangesLine(fields []string) (DomainConfig, error) {
+	if len(fields) != 4 {
+		return DomainConfig{}, fmt.Errorf("want 4 fields (name sid min max), got %d", len(fields))
+	}
+
+	minID, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return DomainConfig{}, fmt.Errorf("%w: invalid min %q", ErrInvalidRange, fields[2])
+	}
+	maxID, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return DomainConfig{}, fmt.Errorf("%w: invalid max %q", ErrInvalidRange, fields[3])
+	}
+
+	config := DomainConfig{
+		DomainName: fields[0],
+		DomainSID:  fields[1],
+		IDRange:    IDRange{Min: uint32(minID), Max: uint32(maxID)},
+	}
+	if err := validateDomainConfig(config, false); err != nil {
+		return DomainConfig{}, err
+	}
+
+	return config, nil
+}
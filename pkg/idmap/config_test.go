@@ -0,0 +1,191 @@
+package idmap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestDomainConfig_UnmarshalJSON(t *testing.T) {
+	want := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+
+	tests := []struct {
+		name string
+		json string
+	}{
+		{
+			name: "range object",
+			json: `{"domain_name": "EXAMPLE", "domain_sid": "S-1-5-21-3623811015-3361044348-30300820", "range": {"min": 10000, "max": 20000}}`,
+		},
+		{
+			name: "range string",
+			json: `{"domain_name": "EXAMPLE", "domain_sid": "S-1-5-21-3623811015-3361044348-30300820", "range": "10000-20000"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got idmap.DomainConfig
+			if err := json.Unmarshal([]byte(tt.json), &got); err != nil {
+				t.Fatalf("json.Unmarshal() failed: %v", err)
+			}
+			if got != want {
+				t.Errorf("json.Unmarshal() = %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		data, err := json.Marshal(want)
+		if err != nil {
+			t.Fatalf("json.Marshal() failed: %v", err)
+		}
+		var got idmap.DomainConfig
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("json.Unmarshal(%s) failed: %v", data, err)
+		}
+		if got != want {
+			t.Errorf("round trip = %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestDomainConfig_UnmarshalJSON_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr error
+	}{
+		{
+			name:    "inverted range string",
+			json:    `{"domain_name": "EXAMPLE", "domain_sid": "S-1-5-21-3623811015-3361044348-30300820", "range": "20000-10000"}`,
+			wantErr: idmap.ErrInvalidRange,
+		},
+		{
+			name:    "inverted range object",
+			json:    `{"domain_name": "EXAMPLE", "domain_sid": "S-1-5-21-3623811015-3361044348-30300820", "range": {"min": 20000, "max": 10000}}`,
+			wantErr: idmap.ErrInvalidRange,
+		},
+		{
+			name:    "missing range",
+			json:    `{"domain_name": "EXAMPLE", "domain_sid": "S-1-5-21-3623811015-3361044348-30300820"}`,
+			wantErr: idmap.ErrInvalidRange,
+		},
+		{
+			name:    "invalid SID",
+			json:    `{"domain_name": "EXAMPLE", "domain_sid": "S-1-x", "range": "10000-20000"}`,
+			wantErr: idmap.ErrInvalidSID,
+		},
+		{
+			name:    "missing name",
+			json:    `{"domain_sid": "S-1-5-21-3623811015-3361044348-30300820", "range": "10000-20000"}`,
+			wantErr: idmap.ErrInvalidConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got idmap.DomainConfig
+			if err := json.Unmarshal([]byte(tt.json), &got); !errors.Is(err, tt.wantErr) {
+				t.Errorf("json.Unmarshal() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadDomainsFromFile(t *testing.T) {
+	got, err := idmap.LoadDomainsFromFile("testdata/domains.json")
+	if err != nil {
+		t.Fatalf("LoadDomainsFromFile() failed: %v", err)
+	}
+
+	want := []idmap.DomainConfig{
+		{
+			DomainName: "EXAMPLE",
+			DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+			IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+		},
+		{
+			DomainName: "OTHER",
+			DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+			IDRange:    idmap.IDRange{Min: 30000, Max: 40000},
+		},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("LoadDomainsFromFile() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadDomainsFromFile_AggregatesErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.json")
+	data := `[
+		{"domain_name": "A", "domain_sid": "S-1-x", "range": "10000-20000"},
+		{"domain_name": "B", "domain_sid": "S-1-5-21-1111111111-2222222222-3333333333", "range": "30000-40000"},
+		{"domain_name": "C", "domain_sid": "S-1-5-21-1444444444-1555555555-1666666666", "range": "50000-40000"}
+	]`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := idmap.LoadDomainsFromFile(path)
+	if !errors.Is(err, idmap.ErrInvalidSID) || !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Fatalf("LoadDomainsFromFile() = %v, want both ErrInvalidSID and ErrInvalidRange", err)
+	}
+	if !strings.Contains(err.Error(), "domain 0") || !strings.Contains(err.Error(), "domain 2") {
+		t.Errorf("LoadDomainsFromFile() error %q does not name the failing entries", err)
+	}
+}
+
+func TestLoadDomainsFromRangesFile(t *testing.T) {
+	got, err := idmap.LoadDomainsFromRangesFile("testdata/domains.ranges")
+	if err != nil {
+		t.Fatalf("LoadDomainsFromRangesFile() failed: %v", err)
+	}
+
+	want := []idmap.DomainConfig{
+		{
+			DomainName: "EXAMPLE",
+			DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+			IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+		},
+		{
+			DomainName: "OTHER",
+			DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+			IDRange:    idmap.IDRange{Min: 30000, Max: 40000},
+		},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("LoadDomainsFromRangesFile() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadDomainsFromRangesFile_AggregatesErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.ranges")
+	data := "A S-1-x 10000 20000\n" +
+		"B S-1-5-21-1111111111-2222222222-3333333333 30000 40000\n" +
+		"C S-1-5-21-1444444444-1555555555-1666666666 50000 40000\n" +
+		"D S-1-5-21-1444444444-1555555555-1666666666 50000\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := idmap.LoadDomainsFromRangesFile(path)
+	if !errors.Is(err, idmap.ErrInvalidSID) || !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Fatalf("LoadDomainsFromRangesFile() = %v, want both ErrInvalidSID and ErrInvalidRange", err)
+	}
+	for _, line := range []string{":1:", ":3:", ":4:"} {
+		if !strings.Contains(err.Error(), line) {
+			t.Errorf("LoadDomainsFromRangesFile() error %q does not name line %s", err, line)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package idmap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// This file holds a small, dependency-free reader for the subset of TOML that domain
+// files use; it can be dropped from a build without affecting the other loaders
+
+// tomlDomain is a [[domain]] table being read, with the line it started on
+type tomlDomain struct {
+	config DomainConfig
+	line   int
+	seen   map[string]bool
+}
+
+// LoadDomainsFromTOML reads domains from [[domain]] array-of-tables entries with the keys
+// name, sid, range_min, range_max and optionally external_mapping, e.g.
+//
+//	[[domain]]
+//	name = "EXAMPLE"
+//	sid = "S-1-5-21-3623811015-3361044348-30300820"
+//	range_min = 10_000
+//	range_max = 20_000
+//
+// Only that subset of TOML is understood: other tables, inline tables and arrays are errors
+// Every entry is validated like the JSON loader's and all failures are reported together
+func LoadDomainsFromTOML(path string) ([]DomainConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		domains []*tomlDomain
+		errs    []error
+	)
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(stripTOMLComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if line != "[[domain]]" {
+				errs = append(errs, fmt.Errorf("%s:%d: unsupported table %s, want [[domain]]", path, lineNum, line))
+				continue
+			}
+			domains = append(domains, &tomlDomain{line: lineNum, seen: make(map[string]bool)})
+			continue
+		}
+
+		if len(domains) == 0 {
+			errs = append(errs, fmt.Errorf("%s:%d: key outside a [[domain]] table", path, lineNum))
+			continue
+		}
+		if err := domains[len(domains)-1].set(line); err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", path, lineNum, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	configs := make([]DomainConfig, 0, len(domains))
+	for i, d := range domains {
+		if err := validateDomainConfig(d.config, false); err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: domain %d: %w", path, d.line, i, err))
+			continue
+		}
+		configs = append(configs, d.config)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return configs, nil
+}
+
+// set assigns one key = value line to the domain
+func (d *tomlDomain) set(line string) error {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return fmt.Errorf("want key = value, got %q", line)
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+	if d.seen[key] {
+		return fmt.Errorf("duplicate key %s", key)
+	}
+	d.seen[key] = true
+
+	var err error
+	switch key {
+	case "name":
+		d.config.DomainName, err = parseTOMLString(value)
+	case "sid":
+		d.config.DomainSID, err = parseTOMLString(value)
+	case "range_min":
+		d.config.IDRange.Min, err = parseTOMLUint32(value)
+	case "range_max":
+		d.config.IDRange.Max, err = parseTOMLUint32(value)
+	case "external_mapping":
+		d.config.ExternalMapping, err = parseTOMLBool(value)
+	default:
+		return fmt.Errorf("unknown key %s", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// stripTOMLComment removes a '#' comment that is not inside a string
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseTOMLString parses a basic ("...") or literal ('...') single-line string
+func parseTOMLString(value string) (string, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' && !strings.Contains(value[1:len(value)-1], "'") {
+		return value[1 : len(value)-1], nil
+	}
+	if len(value) >= 2 && value[0] == '"' {
+		s, err := strconv.Unquote(value)
+		if err == nil {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("invalid string %s", value)
+}
+
+// parseTOMLBool parses TOML's lowercase true and false
+func parseTOMLBool(value string) (bool, error) {
+	switch value {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %s", value)
+}
+
+// parseTOMLUint32 parses a decimal integer, allowing TOML's underscore digit separators
+func parseTOMLUint32(value string) (uint32, error) {
+	if strings.HasPrefix(value, "_") || strings.HasSuffix(value, "_") || strings.Contains(value, "__") {
+		return 0, fmt.Errorf("%w: invalid integer %s", ErrInvalidRange, value)
+	}
+	n, err := strconv.ParseUint(strings.ReplaceAll(value, "_", ""), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid integer %s", ErrInvalidRange, value)
+	}
+	return uint32(n), nil
+}
@@ -0,0 +1,72 @@
+package idmap_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestLoadDomainsFromTOML(t *testing.T) {
+	got, err := idmap.LoadDomainsFromTOML("testdata/domains.toml")
+	if err != nil {
+		t.Fatalf("LoadDomainsFromTOML() failed: %v", err)
+	}
+
+	want := []idmap.DomainConfig{
+		{
+			DomainName: "EXAMPLE",
+			DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+			IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+		},
+		{
+			DomainName:      "OTHER",
+			DomainSID:       "S-1-5-21-1111111111-2222222222-3333333333",
+			IDRange:         idmap.IDRange{Min: 30000, Max: 40000},
+			ExternalMapping: true,
+		},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("LoadDomainsFromTOML() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadDomainsFromTOML_AggregatesErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains.toml")
+	data := `range_min = 1
+[[domain]]
+name = "A"
+sid = "S-1-x"
+range_min = 10000
+range_max = 20000
+
+[[domain]]
+name = "B"
+sid = "S-1-5-21-1111111111-2222222222-3333333333"
+range_min = 50000
+range_max = 40000
+
+[servers]
+[[domain]]
+name = "C"
+name = "D"
+color = "blue"
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := idmap.LoadDomainsFromTOML(path)
+	if !errors.Is(err, idmap.ErrInvalidSID) || !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Fatalf("LoadDomainsFromTOML() = %v, want both ErrInvalidSID and ErrInvalidRange", err)
+	}
+	for _, want := range []string{":1: key outside", ":2: domain 0", ":8: domain 1", ":14: unsupported table", ":17: duplicate key name", ":18: unknown key color"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadDomainsFromTOML() error %q does not contain %q", err, want)
+		}
+	}
+}
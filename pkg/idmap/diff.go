@@ -0,0 +1,55 @@
+package idmap
+
+import "strings"
+
+// DomainChange is a domain present in both configurations with a different SID or range
+type DomainChange struct {
+	Old DomainConfig
+	New DomainConfig
+}
+
+// DomainDiff is the difference between two domain configurations
+type DomainDiff struct {
+	Added   []DomainConfig
+	Removed []DomainConfig
+	Changed []DomainChange
+}
+
+// Empty reports whether the configurations hold the same domains
+func (d DomainDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffDomains compares two domain configurations, such as the domains of a context
+// before and after a Reconfigure
+// Domains are matched by name, case-insensitively, and changed if their SID or range
+// differs; Added and Changed follow the order of newConfigs, Removed that of oldConfigs
+func DiffDomains(oldConfigs, newConfigs []DomainConfig) DomainDiff {
+	oldByName := make(map[string]DomainConfig, len(oldConfigs))
+	for _, d := range oldConfigs {
+		oldByName[strings.ToUpper(d.DomainName)] = d
+	}
+	newNames := make(map[string]bool, len(newConfigs))
+
+	var diff DomainDiff
+	for _, d := range newConfigs {
+		name := strings.ToUpper(d.DomainName)
+		newNames[name] = true
+
+		old, ok := oldByName[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, d)
+		case old.DomainSID != d.DomainSID || old.IDRange != d.IDRange:
+			diff.Changed = append(diff.Changed, DomainChange{Old: old, New: d})
+		}
+	}
+
+	for _, d := range oldConfigs {
+		if !newNames[strings.ToUpper(d.DomainName)] {
+			diff.Removed = append(diff.Removed, d)
+		}
+	}
+
+	return diff
+}
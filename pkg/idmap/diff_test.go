@@ -0,0 +1,89 @@
+package idmap_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestDiffDomains(t *testing.T) {
+	example := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+	other := idmap.DomainConfig{
+		DomainName: "OTHER",
+		DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:    idmap.IDRange{Min: 20001, Max: 30000},
+	}
+	widened := example
+	widened.IDRange.Max = 25000
+	renamed := other
+	renamed.DomainName = "other"
+
+	tests := []struct {
+		name     string
+		old, new []idmap.DomainConfig
+		want     idmap.DomainDiff
+	}{
+		{
+			name: "unchanged",
+			old:  []idmap.DomainConfig{example, other},
+			new:  []idmap.DomainConfig{other, example},
+			want: idmap.DomainDiff{},
+		},
+		{
+			name: "added",
+			old:  []idmap.DomainConfig{example},
+			new:  []idmap.DomainConfig{example, other},
+			want: idmap.DomainDiff{Added: []idmap.DomainConfig{other}},
+		},
+		{
+			name: "removed",
+			old:  []idmap.DomainConfig{example, other},
+			new:  []idmap.DomainConfig{example},
+			want: idmap.DomainDiff{Removed: []idmap.DomainConfig{other}},
+		},
+		{
+			name: "range changed",
+			old:  []idmap.DomainConfig{example, other},
+			new:  []idmap.DomainConfig{widened, other},
+			want: idmap.DomainDiff{Changed: []idmap.DomainChange{{Old: example, New: widened}}},
+		},
+		{
+			name: "names match case-insensitively",
+			old:  []idmap.DomainConfig{other},
+			new:  []idmap.DomainConfig{renamed},
+			want: idmap.DomainDiff{},
+		},
+		{
+			name: "replaced",
+			old:  []idmap.DomainConfig{example},
+			new:  []idmap.DomainConfig{other},
+			want: idmap.DomainDiff{
+				Added:   []idmap.DomainConfig{other},
+				Removed: []idmap.DomainConfig{example},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idmap.DiffDomains(tt.old, tt.new)
+			if !slices.Equal(got.Added, tt.want.Added) {
+				t.Errorf("DiffDomains() Added = %+v, want %+v", got.Added, tt.want.Added)
+			}
+			if !slices.Equal(got.Removed, tt.want.Removed) {
+				t.Errorf("DiffDomains() Removed = %+v, want %+v", got.Removed, tt.want.Removed)
+			}
+			if !slices.Equal(got.Changed, tt.want.Changed) {
+				t.Errorf("DiffDomains() Changed = %+v, want %+v", got.Changed, tt.want.Changed)
+			}
+			if got.Empty() != tt.want.Empty() {
+				t.Errorf("DiffDomains().Empty() = %v, want %v", got.Empty(), tt.want.Empty())
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package idmap
+
+import "fmt"
+
+// ErrorCode is a libsss_idmap return code (enum idmap_error_code)
+// The IDMAP* constants are defined alongside the cgo and stub backends
+type ErrorCode int
+
+var errorCodeNames = map[ErrorCode]string{
+	IDMAPSuccess:        "IDMAP_SUCCESS",
+	IDMAPNotImplemented: "IDMAP_NOT_IMPLEMENTED",
+	IDMAPError:          "IDMAP_ERROR",
+	IDMAPOutOfMemory:    "IDMAP_OUT_OF_MEMORY",
+	IDMAPNoDomain:       "IDMAP_NO_DOMAIN",
+	IDMAPContextInvalid: "IDMAP_CONTEXT_INVALID",
+	IDMAPSIDInvalid:     "IDMAP_SID_INVALID",
+	IDMAPSIDUnknown:     "IDMAP_SID_UNKNOWN",
+	IDMAPNoRange:        "IDMAP_NO_RANGE",
+	IDMAPBuiltinSID:     "IDMAP_BUILTIN_SID",
+	IDMAPOutOfSlices:    "IDMAP_OUT_OF_SLICES",
+	IDMAPCollision:      "IDMAP_COLLISION",
+	IDMAPExternal:       "IDMAP_EXTERNAL",
+	IDMAPNameUnknown:    "IDMAP_NAME_UNKNOWN",
+}
+
+// String returns the C macro name of the code
+func (e ErrorCode) String() string {
+	if name, ok := errorCodeNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(e))
+}
+
+// IDMapError is returned when libsss_idmap reports a failure
+// It unwraps to the matching sentinel error (ErrNotFound, ErrInvalidSID, ...)
+type IDMapError struct {
+	Op   string
+	Code ErrorCode
+	Err  error
+}
+
+func (e *IDMapError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *IDMapError) Unwrap() error {
+	return e.Err
+}
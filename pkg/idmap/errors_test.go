@@ -0,0 +1,93 @@
+package idmap_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestErrorCode_Values(t *testing.T) {
+	// Values from enum idmap_error_code in sss_idmap.h
+	tests := []struct {
+		code     idmap.ErrorCode
+		wantInt  int
+		wantName string
+	}{
+		{idmap.IDMAPSuccess, 0, "IDMAP_SUCCESS"},
+		{idmap.IDMAPNotImplemented, 1, "IDMAP_NOT_IMPLEMENTED"},
+		{idmap.IDMAPError, 2, "IDMAP_ERROR"},
+		{idmap.IDMAPOutOfMemory, 3, "IDMAP_OUT_OF_MEMORY"},
+		{idmap.IDMAPNoDomain, 4, "IDMAP_NO_DOMAIN"},
+		{idmap.IDMAPContextInvalid, 5, "IDMAP_CONTEXT_INVALID"},
+		{idmap.IDMAPSIDInvalid, 6, "IDMAP_SID_INVALID"},
+		{idmap.IDMAPSIDUnknown, 7, "IDMAP_SID_UNKNOWN"},
+		{idmap.IDMAPNoRange, 8, "IDMAP_NO_RANGE"},
+		{idmap.IDMAPBuiltinSID, 9, "IDMAP_BUILTIN_SID"},
+		{idmap.IDMAPOutOfSlices, 10, "IDMAP_OUT_OF_SLICES"},
+		{idmap.IDMAPCollision, 11, "IDMAP_COLLISION"},
+		{idmap.IDMAPExternal, 12, "IDMAP_EXTERNAL"},
+		{idmap.IDMAPNameUnknown, 13, "IDMAP_NAME_UNKNOWN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantName, func(t *testing.T) {
+			if int(tt.code) != tt.wantInt {
+				t.Errorf("%s = %d, want %d", tt.wantName, int(tt.code), tt.wantInt)
+			}
+			if got := tt.code.String(); got != tt.wantName {
+				t.Errorf("String() = %q, want %q", got, tt.wantName)
+			}
+		})
+	}
+
+	if got := idmap.ErrorCode(999).String(); got != "ErrorCode(999)" {
+		t.Errorf("String() for unknown code = %q, want %q", got, "ErrorCode(999)")
+	}
+}
+
+func TestIDMapError(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	_, err := ctx.SIDToUnixID("S-1-5-21-1111111111-2222222222-3333333333-1001")
+
+	var idmapErr *idmap.IDMapError
+	if !errors.As(err, &idmapErr) {
+		t.Fatalf("SIDToUnixID() error %v is not an *IDMapError", err)
+	}
+	if idmapErr.Code != idmap.IDMAPNoDomain {
+		t.Errorf("Code = %v, want %v", idmapErr.Code, idmap.IDMAPNoDomain)
+	}
+	if idmapErr.Op != "SIDToUnixID" {
+		t.Errorf("Op = %q, want %q", idmapErr.Op, "SIDToUnixID")
+	}
+	if !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("errors.Is(%v, ErrNotFound) = false, want true", err)
+	}
+}
+
+func TestErrOutOfMemory(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	for _, op := range []string{"NewIDMapContext", "AddDomain", "SIDToUnixID", "BinSIDToUnixID"} {
+		t.Run(op, func(t *testing.T) {
+			err := ctx.Fail(op, idmap.IDMAPOutOfMemory, "", fmt.Errorf("%w: failed (code: 3)", idmap.ErrInternal))
+			if !errors.Is(err, idmap.ErrOutOfMemory) {
+				t.Errorf("error %v does not match ErrOutOfMemory", err)
+			}
+			if !errors.Is(err, idmap.ErrInternal) {
+				t.Errorf("error %v no longer matches ErrInternal", err)
+			}
+		})
+	}
+
+	err := ctx.Fail("SIDToUnixID", idmap.IDMAPError, "", fmt.Errorf("%w: failed (code: 2)", idmap.ErrInternal))
+	if errors.Is(err, idmap.ErrOutOfMemory) {
+		t.Errorf("IDMAP_ERROR reported as ErrOutOfMemory: %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+package idmap
+
+// Fail exposes fail so tests can exercise return codes the library cannot be made to produce
+func (c *IDMapContext) Fail(op string, code ErrorCode, sid string, err error) error {
+	return c.fail(op, code, sid, err)
+}
+
+// SDDLAliases exposes the SDDL alias table so tests can check it against wellKnownSIDs
+var SDDLAliases = sddlAliases
@@ -0,0 +1,100 @@
+package idmap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// domainAccountSIDPattern matches a complete domain account SID such as S-1-5-21-x-y-z-rid
+var domainAccountSIDPattern = regexp.MustCompile(`^S-1-5-21(-\d+)+$`)
+
+// LoadSIDsFromRegExport returns the de-duplicated S-1-5-21 SIDs found in
+// registry key names of a .reg export (e.g. the ProfileList hive)
+// Both UTF-8 and regedit's default UTF-16LE encoding are accepted
+func LoadSIDsFromRegExport(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry export: %w", err)
+	}
+
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) {
+		data = decodeUTF16LE(data[2:])
+	}
+
+	var sids []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+
+		key := strings.TrimPrefix(strings.Trim(line, "[]"), "-")
+		for _, component := range strings.Split(key, `\`) {
+			// Windows renames broken profiles to <SID>.bak
+			sid := strings.TrimSuffix(component, ".bak")
+			if !domainAccountSIDPattern.MatchString(sid) || seen[sid] {
+				continue
+			}
+			seen[sid] = true
+			sids = append(sids, sid)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan registry export: %w", err)
+	}
+
+	return sids, nil
+}
+
+// decodeUTF16LE converts little-endian UTF-16 bytes to UTF-8
+func decodeUTF16LE(b []byte) []byte {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = uint16(b[2*i]) | uint16(b[2*i+1])<<8
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// LoadSIDsFromNFS4ACL returns the de-duplicated SIDs used as ACE principals in
+// nfs4_getfacl output, whose ACEs read type:flags:principal:permissions
+// A principal may be a bare SID or one qualified as SID@domain; names such as
+// OWNER@ or alice@example.com are skipped
+func LoadSIDsFromNFS4ACL(r io.Reader) ([]string, error) {
+	var sids []string
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: malformed ACE %q", lineNum, line)
+		}
+
+		sid, _, _ := strings.Cut(fields[2], "@")
+		if !strings.HasPrefix(sid, "S-1-") || ValidateSID(sid) != nil || seen[sid] {
+			continue
+		}
+		seen[sid] = true
+		sids = append(sids, sid)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan nfs4_getfacl output: %w", err)
+	}
+
+	return sids, nil
+}
@@ -0,0 +1,87 @@
+package idmap_test
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestLoadSIDsFromRegExport(t *testing.T) {
+	f, err := os.Open("testdata/profilelist.reg")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	sids, err := idmap.LoadSIDsFromRegExport(f)
+	if err != nil {
+		t.Fatalf("LoadSIDsFromRegExport() unexpected error: %v", err)
+	}
+
+	want := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+		"S-1-5-21-1111111111-2222222222-3333333333-1104",
+	}
+	if !slices.Equal(sids, want) {
+		t.Errorf("LoadSIDsFromRegExport() = %v, want %v", sids, want)
+	}
+}
+
+func TestLoadSIDsFromRegExport_UTF16(t *testing.T) {
+	data, err := os.ReadFile("testdata/profilelist.reg")
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	// regedit writes exports as UTF-16LE with a byte order mark
+	encoded := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(string(data))) {
+		encoded = append(encoded, byte(u), byte(u>>8))
+	}
+
+	sids, err := idmap.LoadSIDsFromRegExport(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("LoadSIDsFromRegExport() unexpected error: %v", err)
+	}
+
+	if len(sids) != 3 {
+		t.Errorf("LoadSIDsFromRegExport() returned %d SIDs, want 3: %v", len(sids), sids)
+	}
+}
+
+func TestLoadSIDsFromNFS4ACL(t *testing.T) {
+	f, err := os.Open("testdata/nfs4_getfacl.txt")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	sids, err := idmap.LoadSIDsFromNFS4ACL(f)
+	if err != nil {
+		t.Fatalf("LoadSIDsFromNFS4ACL() unexpected error: %v", err)
+	}
+
+	want := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-3623811015-3361044348-30300820-513",
+		"S-1-5-21-1111111111-2222222222-3333333333-1104",
+	}
+	if !slices.Equal(sids, want) {
+		t.Errorf("LoadSIDsFromNFS4ACL() = %v, want %v", sids, want)
+	}
+}
+
+func TestLoadSIDsFromNFS4ACL_Malformed(t *testing.T) {
+	input := "A::OWNER@:rwatTcCy\nnot an ace\n"
+
+	_, err := idmap.LoadSIDsFromNFS4ACL(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("LoadSIDsFromNFS4ACL() error = %v, want a line 2 error", err)
+	}
+}
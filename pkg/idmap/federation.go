@@ -0,0 +1,51 @@
+package idmap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Federation maps SIDs against several contexts, typically one per forest, without merging
+// their ranges into one context
+// It implements IDMapper; the contexts stay owned by the caller, who closes them
+type Federation struct {
+	contexts []*IDMapContext
+}
+
+// NewFederation returns a Federation that consults contexts in the given order
+func NewFederation(contexts ...*IDMapContext) *Federation {
+	return &Federation{contexts: contexts}
+}
+
+// SIDToUnixID returns the mapping of the first context that converts sid
+// If none does, the error joins every context's error, so errors.Is matches ErrNotFound
+// when sid is in none of the forests
+func (f *Federation) SIDToUnixID(sid string) (uint32, error) {
+	return f.try(func(c *IDMapContext) (uint32, error) {
+		return c.SIDToUnixID(sid)
+	})
+}
+
+// BinSIDToUnixID is SIDToUnixID for a binary SID
+func (f *Federation) BinSIDToUnixID(sid []byte) (uint32, error) {
+	return f.try(func(c *IDMapContext) (uint32, error) {
+		return c.BinSIDToUnixID(sid)
+	})
+}
+
+// try runs convert against each context until one succeeds
+func (f *Federation) try(convert func(*IDMapContext) (uint32, error)) (uint32, error) {
+	if len(f.contexts) == 0 {
+		return 0, fmt.Errorf("%w: federation has no contexts", ErrNotFound)
+	}
+
+	errs := make([]error, 0, len(f.contexts))
+	for i, c := range f.contexts {
+		unixID, err := convert(c)
+		if err == nil {
+			return unixID, nil
+		}
+		errs = append(errs, fmt.Errorf("context %d: %w", i, err))
+	}
+	return 0, errors.Join(errs...)
+}
@@ -0,0 +1,61 @@
+package idmap_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestFederation(t *testing.T) {
+	requireLibrary(t)
+
+	// Both forests use the same range, which one context would reject as a collision
+	other, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "OTHER",
+		DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	})
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer other.Close()
+
+	var fed idmap.IDMapper = idmap.NewFederation(newExampleContext(t), other)
+
+	tests := []struct {
+		name    string
+		sid     string
+		want    uint32
+		wantErr error
+	}{
+		{name: "first context", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", want: 11013},
+		{name: "second context only", sid: "S-1-5-21-1111111111-2222222222-3333333333-1500", want: 11500},
+		{name: "no context", sid: "S-1-5-21-1234567890-1234567890-1234567890-1013", wantErr: idmap.ErrNotFound},
+		{name: "invalid", sid: "not-a-sid", wantErr: idmap.ErrInvalidSID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fed.SIDToUnixID(tt.sid)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("SIDToUnixID() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("SIDToUnixID() = %d, %v, want %d", got, err, tt.want)
+			}
+
+			bin, _ := idmap.EncodeSID(tt.sid)
+			if got, err := fed.BinSIDToUnixID(bin); err != nil || got != tt.want {
+				t.Errorf("BinSIDToUnixID() = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := idmap.NewFederation().SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("SIDToUnixID() on an empty federation = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,41 @@
+package idmap
+
+import "fmt"
+
+// GroupMapping is a group's GID together with the Unix IDs of its members
+type GroupMapping struct {
+	GroupSID string
+	GID      uint32
+	Members  []MemberMapping
+}
+
+// MemberMapping is one member of a GroupMapping; Err is set if the member could not be mapped
+type MemberMapping struct {
+	SID    string
+	Class  AccountClass
+	UnixID uint32
+	Err    error
+}
+
+// MapGroupMembers maps a group and its member SIDs at once, as needed to build a getent
+// group entry; members are returned in input order along with their ClassifySID class
+// Only a failure to map the group itself, or a groupSID that is recognisably a user, fails
+// the call; unmapped members carry their own error
+func (c *IDMapContext) MapGroupMembers(groupSID string, memberSIDs []string) (GroupMapping, error) {
+	if ClassifySID(groupSID) == User {
+		return GroupMapping{}, fmt.Errorf("%w: %s is a user, not a group", ErrInvalidSID, groupSID)
+	}
+
+	gid, err := c.SIDToUnixID(groupSID)
+	if err != nil {
+		return GroupMapping{}, err
+	}
+
+	members := make([]MemberMapping, len(memberSIDs))
+	for i, sid := range memberSIDs {
+		members[i] = MemberMapping{SID: sid, Class: ClassifySID(sid)}
+		members[i].UnixID, members[i].Err = c.SIDToUnixID(sid)
+	}
+
+	return GroupMapping{GroupSID: groupSID, GID: gid, Members: members}, nil
+}
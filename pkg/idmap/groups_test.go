@@ -0,0 +1,86 @@
+package idmap_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestMapGroupMembers(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	const domainSID = "S-1-5-21-3623811015-3361044348-30300820"
+	members := []string{
+		domainSID + "-500",
+		domainSID + "-1013",
+		"S-1-5-21-1234567890-1234567890-1234567890-1013",
+		domainSID + "-1014",
+	}
+
+	got, err := ctx.MapGroupMembers(domainSID+"-513", members)
+	if err != nil {
+		t.Fatalf("MapGroupMembers() error = %v", err)
+	}
+	if got.GroupSID != domainSID+"-513" || got.GID != 10513 {
+		t.Errorf("MapGroupMembers() group = %s/%d, want %s/%d", got.GroupSID, got.GID, domainSID+"-513", 10513)
+	}
+
+	want := []struct {
+		class  idmap.AccountClass
+		unixID uint32
+		err    error
+	}{
+		{class: idmap.User, unixID: 10500},
+		{class: idmap.Unknown, unixID: 11013},
+		{class: idmap.Unknown, err: idmap.ErrNotFound},
+		{class: idmap.Unknown, unixID: 11014},
+	}
+	if len(got.Members) != len(want) {
+		t.Fatalf("MapGroupMembers() returned %d members, want %d", len(got.Members), len(want))
+	}
+	for i, w := range want {
+		m := got.Members[i]
+		if m.SID != members[i] {
+			t.Errorf("Members[%d].SID = %s, want %s", i, m.SID, members[i])
+		}
+		if m.Class != w.class {
+			t.Errorf("Members[%d].Class = %v, want %v", i, m.Class, w.class)
+		}
+		if w.err != nil {
+			if !errors.Is(m.Err, w.err) {
+				t.Errorf("Members[%d].Err = %v, want %v", i, m.Err, w.err)
+			}
+			continue
+		}
+		if m.Err != nil || m.UnixID != w.unixID {
+			t.Errorf("Members[%d] = %d, %v, want %d", i, m.UnixID, m.Err, w.unixID)
+		}
+	}
+}
+
+func TestMapGroupMembers_GroupErrors(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	tests := []struct {
+		name     string
+		groupSID string
+		wantErr  error
+	}{
+		{name: "unknown domain", groupSID: "S-1-5-21-1234567890-1234567890-1234567890-513", wantErr: idmap.ErrNotFound},
+		{name: "invalid", groupSID: "not-a-sid", wantErr: idmap.ErrInvalidSID},
+		{name: "user", groupSID: "S-1-5-21-3623811015-3361044348-30300820-500", wantErr: idmap.ErrInvalidSID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ctx.MapGroupMembers(tt.groupSID, nil); !errors.Is(err, tt.wantErr) {
+				t.Errorf("MapGroupMembers() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
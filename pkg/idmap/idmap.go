@@ -1,15 +1,17 @@
 package idmap
 
-/*
-#cgo pkg-config: sss_idmap
-#include <stdlib.h>
-#include <sss_idmap.h>
-*/
-import "C"
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"unsafe"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 var (
@@ -21,41 +23,118 @@ var (
 	ErrInternal = errors.New("internal SSS idmap error")
 	// ErrInvalidRange indicates that the provided ID range is invalid
 	ErrInvalidRange = errors.New("invalid ID range")
+	// ErrInvalidConfig indicates a domain configuration that is invalid on its own or
+	// conflicts with another domain, such as an empty or duplicate name
+	ErrInvalidConfig = errors.New("invalid domain configuration")
+	// ErrOutOfMemory indicates that the SSS library ran out of memory; callers may back off
+	// It also matches ErrInternal, under which it used to be reported
+	ErrOutOfMemory = errors.New("SSS idmap out of memory")
+	// ErrLibraryUnavailable is returned by every context constructor in the stub build
+	// (the nosssidmap build tag), which does not link libsss_idmap
+	ErrLibraryUnavailable = errors.New("built without libsss_idmap (nosssidmap build tag); rebuild with cgo and libsss_idmap to map SIDs")
+	// ErrNotMappable indicates a SID that never has a Unix ID, such as a mandatory
+	// integrity label; callers walking ACLs can skip these
+	ErrNotMappable = errors.New("SID is not mappable to a Unix ID")
+	// ErrRoundTrip indicates a SID whose Unix ID maps back to a different SID
+	ErrRoundTrip = errors.New("SID does not round-trip")
+	// ErrBuiltinSID indicates a SID of the BUILTIN domain (S-1-5-32), which libsss_idmap
+	// refuses to map algorithmically; map these with WithWellKnownMapping
+	ErrBuiltinSID = errors.New("SID is from the BUILTIN domain")
 )
 
 // IDRange represents a Unix ID range for SID mapping
 type IDRange struct {
-	Min uint32
-	Max uint32
+	Min uint32 `json:"min"`
+	Max uint32 `json:"max"`
 }
 
 // DomainConfig holds the configuration for a domain's ID mapping
 type DomainConfig struct {
-	DomainName string
-	DomainSID  string
-	IDRange    IDRange
+	// DomainName is matched case-insensitively but kept as given for display
+	DomainName string  `json:"domain_name"`
+	DomainSID  string  `json:"domain_sid"`
+	IDRange    IDRange `json:"range"`
+	// ExternalMapping marks domains whose IDs are managed outside libsss_idmap
+	// (e.g. POSIX attributes in AD); SIDs in them are not mapped algorithmically
+	ExternalMapping bool `json:"external_mapping,omitempty"`
+	// AutoSlices registers the domain as AddAutoDomain does, with the extra slices of
+	// WithExtraSliceInit; AddAutoDomain and AddDomainAuto set it, so passing ListDomains
+	// to Reconfigure or ScopeToDomain keeps those slices
+	AutoSlices bool `json:"auto_slices,omitempty"`
+}
+
+// ContextConfig reports the settings of the underlying libsss_idmap context
+type ContextConfig struct {
+	Autorid   bool
+	Lower     uint32
+	Upper     uint32
+	RangeSize uint32
+}
+
+// IDMapper converts Windows SIDs to Unix IDs
+// IDMapContext implements it; decorators such as CachingIDMap wrap it
+type IDMapper interface {
+	SIDToUnixID(sid string) (uint32, error)
+	BinSIDToUnixID(sid []byte) (uint32, error)
 }
 
 // IDMapContext wraps the sss_idmap_ctx C structure
+// It is safe for concurrent use; lookups run in parallel and block only while the
+// domain configuration changes
 type IDMapContext struct {
-	ctx *C.struct_sss_idmap_ctx
+	// mu guards ctx and domains; lookups hold it for reading
+	mu        sync.RWMutex
+	ctx       *cContext
+	logger    *slog.Logger
+	domains   []DomainConfig
+	errorHook ErrorHook
+
+	fallbackID   uint32
+	hasFallback  bool
+	autorid      bool
+	wellKnownIDs map[string]uint32
+	// relaxedRanges leaves range checks to the C library
+	relaxedRanges bool
+	unmapped      func(sid string)
+	// stripAnnotations removes "#..." and " (...)" suffixes from string SIDs
+	stripAnnotations bool
+	// percentDecoding URL-unescapes string SIDs, set by WithPercentDecoding
+	percentDecoding bool
+	// recoverPanics turns panics in wrapped calls into ErrInternal
+	recoverPanics bool
+	// extraSliceInit is the number of slices AddAutoDomain pre-allocates beyond the first
+	extraSliceInit uint32
+	// defaultDomainSID is the domain MapRIDAgainstDefault uses, set by WithDefaultDomain
+	defaultDomainSID string
+	// debugCodes logs every libsss_idmap return code, set by WithDebugCodes
+	debugCodes bool
+	// algorithmic memoizes DomainHasAlgorithmicMapping answers by domain SID until Reconfigure
+	algorithmic sync.Map
+	// opts are the construction options, reapplied by ScopeToDomain
+	opts []Option
+
+	stats conversionStats
 }
 
 // NewIDMapContext creates a new ID mapping context
-func NewIDMapContext() (*IDMapContext, error) {
-	var ctx *C.struct_sss_idmap_ctx
+func NewIDMapContext(opts ...Option) (*IDMapContext, error) {
+	c := &IDMapContext{opts: slices.Clone(opts)}
+	for _, opt := range opts {
+		opt(c)
+	}
 
-	err := C.sss_idmap_init(nil, nil, nil, &ctx)
-	if err != C.IDMAP_SUCCESS {
-		return nil, fmt.Errorf("%w: failed to initialize idmap context (code: %d)", ErrInternal, err)
+	ctx, err := c.newCContext("NewIDMapContext")
+	if err != nil {
+		return nil, err
 	}
+	c.ctx = ctx
 
-	return &IDMapContext{ctx: ctx}, nil
+	return c, nil
 }
 
 // NewIDMapContextWithDomain creates a new ID mapping context with a preconfigured domain
-func NewIDMapContextWithDomain(config DomainConfig) (*IDMapContext, error) {
-	ctx, err := NewIDMapContext()
+func NewIDMapContextWithDomain(config DomainConfig, opts ...Option) (*IDMapContext, error) {
+	ctx, err := NewIDMapContext(opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -68,49 +147,398 @@ func NewIDMapContextWithDomain(config DomainConfig) (*IDMapContext, error) {
 	return ctx, nil
 }
 
+// NewIDMapContextFromAccountSID creates a context for a domain known by name and range only
+// libsss_idmap cannot resolve a domain name to its SID offline, so the domain SID is
+// discovered from accountSID, any user or group SID of that domain
+func NewIDMapContextFromAccountSID(domainName, accountSID string, idRange IDRange, opts ...Option) (*IDMapContext, error) {
+	domainSID, err := DomainSIDOf(accountSID)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewIDMapContextWithDomain(DomainConfig{
+		DomainName: domainName,
+		DomainSID:  domainSID,
+		IDRange:    idRange,
+	}, opts...)
+}
+
+// SetLogger sets the logger used for debug output; nil restores slog.Default()
+func (c *IDMapContext) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
+// log returns the logger to use for debug output
+func (c *IDMapContext) log() *slog.Logger {
+	if c.logger != nil {
+		return c.logger
+	}
+	return slog.Default()
+}
+
+// debugCode logs the return code of a libsss_idmap call made for op, success included,
+// when WithDebugCodes is set
+func (c *IDMapContext) debugCode(op string, code ErrorCode) {
+	if c.debugCodes {
+		c.log().Debug("libsss_idmap returned", "op", op, "code", int(code), "name", code.String())
+	}
+}
+
+// fail builds the error returned for a non-success return code of op
+// The error hook, if any, is consulted first; otherwise err is wrapped in an IDMapError
+// IDMAP_OUT_OF_MEMORY is reported as ErrOutOfMemory whatever op mapped it to
+func (c *IDMapContext) fail(op string, code ErrorCode, sid string, err error) error {
+	if c.errorHook != nil {
+		if hookErr := c.errorHook(int(code), op, sid); hookErr != nil {
+			return hookErr
+		}
+	}
+	if code == IDMAPOutOfMemory && !errors.Is(err, ErrOutOfMemory) {
+		err = fmt.Errorf("%w: %w", ErrOutOfMemory, err)
+	}
+	return &IDMapError{Op: op, Code: code, Err: err}
+}
+
+// recoverPanic converts a panic in op into ErrInternal when WithPanicRecovery is set
+// It must be deferred directly so that recover sees the panic
+func (c *IDMapContext) recoverPanic(op string, retErr *error) {
+	if !c.recoverPanics {
+		return
+	}
+	if r := recover(); r != nil {
+		c.log().Error("recovered panic", "op", op, "panic", r)
+		*retErr = fmt.Errorf("%w: %s panicked: %v", ErrInternal, op, r)
+	}
+}
+
 // AddDomain adds a domain configuration to the ID mapping context
-func (c *IDMapContext) AddDomain(config DomainConfig) error {
+// With config.AutoSlices set it behaves like AddAutoDomain
+func (c *IDMapContext) AddDomain(config DomainConfig) (retErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.recoverPanic("AddDomain", &retErr)
+
+	if c.ctx == nil {
+		return fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	if err := c.addDomain(c.ctx, config); err != nil {
+		return err
+	}
+
+	c.domains = append(c.domains, config)
+
+	return nil
+}
+
+// AddAutoDomain adds a domain the way SSSD does for autorid-style setups: config.IDRange
+// is the domain's first slice, and with WithExtraSliceInit(n) libsss_idmap also allocates
+// n further slices of rangesize IDs for the RIDs that follow, so SIDs with RIDs beyond
+// the first slice map without further configuration
+// Only the first slice is tracked by ListDomains and MatchDomain
+func (c *IDMapContext) AddAutoDomain(config DomainConfig) (retErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.recoverPanic("AddAutoDomain", &retErr)
+
 	if c.ctx == nil {
 		return fmt.Errorf("%w: context is nil", ErrInternal)
 	}
 
-	if config.IDRange.Min >= config.IDRange.Max {
-		return fmt.Errorf("%w: min (%d) must be less than max (%d)", ErrInvalidRange, config.IDRange.Min, config.IDRange.Max)
+	config.AutoSlices = true
+	if err := c.addDomain(c.ctx, config); err != nil {
+		return err
 	}
 
-	cDomainName := C.CString(config.DomainName)
-	defer C.free(unsafe.Pointer(cDomainName))
+	c.domains = append(c.domains, config)
+
+	return nil
+}
 
-	cDomainSID := C.CString(config.DomainSID)
-	defer C.free(unsafe.Pointer(cDomainSID))
+// CalculateRange returns the slice of rangesize IDs SSSD would assign to rangeID, usually a
+// domain SID: the slice rangeID hashes to, or the next free one if registered domains use it
+func (c *IDMapContext) CalculateRange(rangeID string) (IDRange, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	cRange := C.struct_sss_idmap_range{
-		min: C.uint32_t(config.IDRange.Min),
-		max: C.uint32_t(config.IDRange.Max),
+	if c.ctx == nil {
+		return IDRange{}, fmt.Errorf("%w: context is nil", ErrInternal)
 	}
 
-	err := C.sss_idmap_add_domain(c.ctx, cDomainName, cDomainSID, &cRange)
-	if err != C.IDMAP_SUCCESS {
-		switch err {
-		case C.IDMAP_SID_INVALID:
-			return fmt.Errorf("%w: invalid domain SID %s", ErrInvalidSID, config.DomainSID)
-		case C.IDMAP_COLLISION:
-			return fmt.Errorf("%w: domain %s already exists or range conflicts", ErrInternal, config.DomainName)
+	return c.calculateRange(rangeID)
+}
+
+// calculateRange implements CalculateRange; the caller must hold mu
+func (c *IDMapContext) calculateRange(rangeID string) (IDRange, error) {
+	idRange, code := calculateRange(c.ctx, rangeID)
+	c.debugCode("CalculateRange", code)
+	if code != IDMAPSuccess {
+		switch code {
+		case IDMAPOutOfSlices:
+			return IDRange{}, c.fail("CalculateRange", code, "", fmt.Errorf("%w: no free slice for %s", ErrInvalidRange, rangeID))
 		default:
-			return fmt.Errorf("%w: failed to add domain %s (code: %d)", ErrInternal, config.DomainName, err)
+			return IDRange{}, c.fail("CalculateRange", code, "", fmt.Errorf("%w: failed to calculate range for %s (code: %d)", ErrInternal, rangeID, code))
 		}
 	}
 
+	return idRange, nil
+}
+
+// AddDomainAuto adds a domain through AddAutoDomain with the range CalculateRange assigns
+// to domainSID, so operators relying on SSSD's slicing need not pick one; ListDomains
+// reports the chosen range
+func (c *IDMapContext) AddDomainAuto(name, domainSID string) (retErr error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.recoverPanic("AddDomainAuto", &retErr)
+
+	if c.ctx == nil {
+		return fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	if err := ValidateSID(domainSID); err != nil {
+		return err
+	}
+
+	idRange, err := c.calculateRange(domainSID)
+	if err != nil {
+		return err
+	}
+
+	config := DomainConfig{DomainName: name, DomainSID: domainSID, IDRange: idRange, AutoSlices: true}
+	if err := c.addDomain(c.ctx, config); err != nil {
+		return err
+	}
+
+	c.domains = append(c.domains, config)
+
 	return nil
 }
 
+// AddDomainsAtomic validates all configurations in Go (ranges, SIDs, overlaps with each
+// other and with registered domains) and only registers them if every check passes
+// A validation failure registers none of them; the SSS library has no remove API,
+// so a failure it reports after validation still leaves earlier domains registered
+func (c *IDMapContext) AddDomainsAtomic(configs []DomainConfig) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ctx == nil {
+		return fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	for i, config := range configs {
+		if err := validateDomainConfig(config, c.relaxedRanges); err != nil {
+			return err
+		}
+
+		for _, existing := range c.domains {
+			if err := checkDomainConflict(config, existing); err != nil {
+				return err
+			}
+		}
+
+		for _, other := range configs[:i] {
+			if err := checkDomainConflict(config, other); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, config := range configs {
+		if err := c.addDomain(c.ctx, config); err != nil {
+			return err
+		}
+		c.domains = append(c.domains, config)
+	}
+
+	return nil
+}
+
+// Reset drops every registered domain, leaving the context as freshly constructed
+func (c *IDMapContext) Reset() error {
+	return c.Reconfigure(nil)
+}
+
+// Reconfigure replaces the registered domains with configs
+// The new configuration is validated and built in a fresh libsss_idmap context, then
+// swapped in under the write lock, so concurrent lookups see either the old or the new
+// domains and never a partial state; on error the old configuration stays in place
+func (c *IDMapContext) Reconfigure(configs []DomainConfig) error {
+	for i, config := range configs {
+		if err := validateDomainConfig(config, c.relaxedRanges); err != nil {
+			return err
+		}
+		for _, other := range configs[:i] {
+			if err := checkDomainConflict(config, other); err != nil {
+				return err
+			}
+		}
+	}
+
+	ctx, err := c.newCContext("Reconfigure")
+	if err != nil {
+		return err
+	}
+	for _, config := range configs {
+		if err := c.addDomain(ctx, config); err != nil {
+			freeCContext(ctx)
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	if c.ctx == nil {
+		c.mu.Unlock()
+		freeCContext(ctx)
+		return fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+	old := c.ctx
+	c.ctx = ctx
+	c.domains = append([]DomainConfig(nil), configs...)
+	c.algorithmic.Clear()
+	c.mu.Unlock()
+
+	code := freeCContext(old)
+	c.debugCode("Reconfigure", code)
+	if code != IDMAPSuccess {
+		return c.fail("Reconfigure", code, "", fmt.Errorf("%w: failed to free previous idmap context (code: %d)", ErrInternal, code))
+	}
+
+	return nil
+}
+
+// ScopeToDomain returns a new context holding only the registered domain domainSID, built
+// with the same options and logger as c, e.g. to give each tenant its own context
+// The scoped context shares no state with c and must be closed separately
+func (c *IDMapContext) ScopeToDomain(domainSID string) (*IDMapContext, error) {
+	c.mu.RLock()
+	i := slices.IndexFunc(c.domains, func(d DomainConfig) bool { return d.DomainSID == domainSID })
+	var config DomainConfig
+	if i >= 0 {
+		config = c.domains[i]
+	}
+	c.mu.RUnlock()
+
+	if i < 0 {
+		return nil, fmt.Errorf("%w: domain %s", ErrNotFound, domainSID)
+	}
+
+	scoped, err := NewIDMapContextWithDomain(config, c.opts...)
+	if err != nil {
+		return nil, err
+	}
+	scoped.logger = c.logger
+
+	return scoped, nil
+}
+
+// MatchDomain returns the registered domain whose SID is a prefix of sid, without converting it
+// When several domain SIDs match, the longest (most specific) one wins
+func (c *IDMapContext) MatchDomain(sid string) (DomainConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.matchDomain(sid)
+}
+
+// matchDomain implements MatchDomain; the caller must hold mu
+func (c *IDMapContext) matchDomain(sid string) (DomainConfig, bool) {
+	var (
+		match DomainConfig
+		found bool
+	)
+	for _, d := range c.domains {
+		if !strings.HasPrefix(sid, d.DomainSID+"-") {
+			continue
+		}
+		if !found || len(d.DomainSID) > len(match.DomainSID) {
+			match, found = d, true
+		}
+	}
+	return match, found
+}
+
+// ListDomains returns the registered domains
+// libsss_idmap has no API to enumerate its ranges, so this Go-side mirror is authoritative;
+// it is cross-checked against the C context by converting RID 0 of every algorithmically
+// mapped domain, which must land on the range minimum, and drift fails with ErrInternal
+func (c *IDMapContext) ListDomains() ([]DomainConfig, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ctx == nil {
+		return nil, fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	for _, d := range c.domains {
+		if d.ExternalMapping {
+			continue
+		}
+
+		unixID, code := sidToUnix(c.ctx, d.DomainSID+"-0")
+		c.debugCode("ListDomains", code)
+		if code != IDMAPSuccess {
+			return nil, c.fail("ListDomains", code, d.DomainSID, fmt.Errorf("%w: domain %s is not registered in the C context (code: %d)", ErrInternal, d.DomainName, code))
+		}
+		if unixID != d.IDRange.Min {
+			return nil, fmt.Errorf("%w: domain %s starts at %d in the C context, want %d", ErrInternal, d.DomainName, unixID, d.IDRange.Min)
+		}
+	}
+
+	return append([]DomainConfig(nil), c.domains...), nil
+}
+
+// logResolved emits the domain, slice and offset a successful conversion landed in
+// The caller must hold mu
+func (c *IDMapContext) logResolved(sid string, unixID uint32) {
+	logger := c.log()
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	domain, ok := c.matchDomain(sid)
+	if !ok {
+		logger.Debug("resolved SID", "sid", sid, "unix_id", unixID)
+		return
+	}
+
+	// An ID in the domain's own range is in its first slice, which starts at RID 0 and is as
+	// long as that range; the extra slices of auto domains hold rangesize IDs each, aligned
+	// on multiples of rangesize RIDs
+	var slice, offset uint64
+	if r := domain.IDRange; unixID >= r.Min && unixID <= r.Max {
+		offset = uint64(unixID - r.Min)
+	} else {
+		config, _, code := contextConfig(c.ctx)
+		rid, err := strconv.ParseUint(sid[strings.LastIndexByte(sid, '-')+1:], 10, 32)
+		if code != IDMAPSuccess || config.RangeSize == 0 || err != nil {
+			logger.Debug("resolved SID", "sid", sid, "unix_id", unixID, "domain", domain.DomainName)
+			return
+		}
+		slice, offset = rid/uint64(config.RangeSize), rid%uint64(config.RangeSize)
+	}
+
+	logger.Debug("resolved SID",
+		"sid", sid,
+		"unix_id", unixID,
+		"domain", domain.DomainName,
+		"slice", slice,
+		"offset", offset,
+	)
+}
+
 // Close frees the ID mapping context
 func (c *IDMapContext) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	if c.ctx != nil {
-		err := C.sss_idmap_free(c.ctx)
+		code := freeCContext(c.ctx)
+		c.debugCode("Close", code)
 		c.ctx = nil
-		if err != C.IDMAP_SUCCESS {
-			return fmt.Errorf("%w: failed to free idmap context (code: %d)", ErrInternal, err)
+		if code != IDMAPSuccess {
+			return c.fail("Close", code, "", fmt.Errorf("%w: failed to free idmap context (code: %d)", ErrInternal, code))
 		}
 	}
 	return nil
@@ -119,28 +547,419 @@ func (c *IDMapContext) Close() error {
 // SIDToUnixID converts a Windows SID to a Unix UID or GID
 // Returns the Unix ID and an error if the conversion fails
 func (c *IDMapContext) SIDToUnixID(sid string) (uint32, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.sidToUnixID(sid)
+}
+
+// sidToUnixID implements SIDToUnixID; the caller must hold mu
+func (c *IDMapContext) sidToUnixID(sid string) (_ uint32, retErr error) {
+	defer func() { c.stats.record(retErr) }()
+	defer c.recoverPanic("SIDToUnixID", &retErr)
+
 	if c.ctx == nil {
 		return 0, fmt.Errorf("%w: context is nil", ErrInternal)
 	}
 
-	cSID := C.CString(sid)
-	defer C.free(unsafe.Pointer(cSID))
+	if c.percentDecoding {
+		decoded, err := url.QueryUnescape(sid)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q is not validly percent-encoded", ErrInvalidSID, sid)
+		}
+		sid = decoded
+	}
+
+	if c.stripAnnotations {
+		sid, _ = StripSIDAnnotation(sid)
+	}
 
-	var unixID C.uint32_t
+	// The library reports empty components as a bare IDMAP_SID_INVALID
+	if err := checkSIDComponents(sid); err != nil {
+		return 0, err
+	}
+
+	if id, ok := c.wellKnownIDs[sid]; ok {
+		return id, nil
+	}
+
+	if IsMandatoryLabelSID(sid) {
+		return 0, fmt.Errorf("%w: %s is an integrity label", ErrNotMappable, sid)
+	}
 
-	err := C.sss_idmap_sid_to_unix(c.ctx, cSID, &unixID)
-	if err != C.IDMAP_SUCCESS {
-		switch err {
-		case C.IDMAP_SID_INVALID:
-			return 0, fmt.Errorf("%w: %s", ErrInvalidSID, sid)
-		case C.IDMAP_NO_DOMAIN:
-			return 0, fmt.Errorf("%w: %s", ErrNotFound, sid)
+	unixID, code := sidToUnix(c.ctx, sid)
+	c.debugCode("SIDToUnixID", code)
+	if code != IDMAPSuccess {
+		switch code {
+		case IDMAPSIDInvalid:
+			return 0, c.fail("SIDToUnixID", code, sid, fmt.Errorf("%w: %s", ErrInvalidSID, sid))
+		case IDMAPNoDomain:
+			if c.hasFallback {
+				c.stats.fallbacks.Add(1)
+				return c.fallbackID, nil
+			}
+			if c.unmapped != nil {
+				c.unmapped(sid)
+			}
+			return 0, c.fail("SIDToUnixID", code, sid, fmt.Errorf("%w: %s", ErrNotFound, sid))
+		case IDMAPBuiltinSID:
+			return 0, c.fail("SIDToUnixID", code, sid, fmt.Errorf("%w: %s", ErrBuiltinSID, sid))
 		default:
-			return 0, fmt.Errorf("%w: failed to convert SID %s (code: %d)", ErrInternal, sid, err)
+			return 0, c.fail("SIDToUnixID", code, sid, fmt.Errorf("%w: failed to convert SID %s (code: %d)", ErrInternal, sid, code))
 		}
 	}
 
-	return uint32(unixID), nil
+	c.logResolved(sid, unixID)
+
+	return unixID, nil
+}
+
+// CheckSIDUnix reports whether id lies within a range of the registered domain sid belongs to
+// It returns ErrNotFound if sid is in no registered domain and ErrInvalidRange if id is
+// outside the domain's ranges
+func (c *IDMapContext) CheckSIDUnix(sid string, id uint32) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.checkSIDUnix(sid, id)
+}
+
+// checkSIDUnix implements CheckSIDUnix; the caller must hold mu
+func (c *IDMapContext) checkSIDUnix(sid string, id uint32) error {
+	if c.ctx == nil {
+		return fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	if err := checkSIDComponents(sid); err != nil {
+		return err
+	}
+
+	code := checkSIDUnixC(c.ctx, sid, id)
+	c.debugCode("CheckSIDUnix", code)
+	if code != IDMAPSuccess {
+		switch code {
+		case IDMAPSIDUnknown:
+			return c.fail("CheckSIDUnix", code, sid, fmt.Errorf("%w: %s", ErrNotFound, sid))
+		case IDMAPNoRange:
+			return c.fail("CheckSIDUnix", code, sid, fmt.Errorf("%w: %d is outside the ranges of the domain of %s", ErrInvalidRange, id, sid))
+		default:
+			return c.fail("CheckSIDUnix", code, sid, fmt.Errorf("%w: failed to check SID %s (code: %d)", ErrInternal, sid, code))
+		}
+	}
+
+	return nil
+}
+
+// FilterMappable splits sids into those that map into a registered domain's range and
+// the rest, preserving input order in both
+// SIDs that only resolve through WithFallbackID are skipped
+func (c *IDMapContext) FilterMappable(sids []string) (mappable, skipped []string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, sid := range sids {
+		id, err := c.sidToUnixID(sid)
+		if err == nil {
+			err = c.checkSIDUnix(sid, id)
+		}
+		if err != nil {
+			skipped = append(skipped, sid)
+			continue
+		}
+		mappable = append(mappable, sid)
+	}
+
+	return mappable, skipped
+}
+
+// SIDToOffset returns how far sid's Unix ID lies above the minimum of its domain's range
+// For SIDs mapped into the first slice this is the RID; it helps verify the mapping math
+// SIDs outside the registered domains fail with ErrNotFound even when WithFallbackID is set
+func (c *IDMapContext) SIDToOffset(sid string) (uint32, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	domain, ok := c.matchDomain(sid)
+	if !ok {
+		if err := ValidateSID(sid); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, sid)
+	}
+
+	unixID, err := c.sidToUnixID(sid)
+	if err != nil {
+		return 0, err
+	}
+
+	return unixID - domain.IDRange.Min, nil
+}
+
+// MaxMappableRID returns the highest RID of domainSID that still maps into its range,
+// i.e. range max minus range min, since RIDs are mapped starting from the range minimum
+// Domains with external mapping have no algorithmic RID limit and fail with ErrNotFound
+func (c *IDMapContext) MaxMappableRID(domainSID string) (uint32, error) {
+	if err := ValidateSID(domainSID); err != nil {
+		return 0, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, d := range c.domains {
+		if d.DomainSID != domainSID {
+			continue
+		}
+		if d.ExternalMapping {
+			return 0, fmt.Errorf("%w: domain %s uses external mapping", ErrNotFound, d.DomainName)
+		}
+		return d.IDRange.Max - d.IDRange.Min, nil
+	}
+
+	return 0, fmt.Errorf("%w: domain %s", ErrNotFound, domainSID)
+}
+
+// RIDForUnixID returns the RID of domainSID that maps to id, i.e. id minus range min, the
+// inverse of the algorithmic mapping for diagnostics
+// It returns ErrNotFound if id is outside the domain's range or the domain is unregistered
+// or uses external mapping
+func (c *IDMapContext) RIDForUnixID(domainSID string, id uint32) (uint32, error) {
+	if err := ValidateSID(domainSID); err != nil {
+		return 0, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, d := range c.domains {
+		if d.DomainSID != domainSID {
+			continue
+		}
+		if d.ExternalMapping {
+			return 0, fmt.Errorf("%w: domain %s uses external mapping", ErrNotFound, d.DomainName)
+		}
+		if id < d.IDRange.Min || id > d.IDRange.Max {
+			return 0, fmt.Errorf("%w: %d is outside the range %d-%d of domain %s", ErrNotFound, id, d.IDRange.Min, d.IDRange.Max, d.DomainName)
+		}
+		return id - d.IDRange.Min, nil
+	}
+
+	return 0, fmt.Errorf("%w: domain %s", ErrNotFound, domainSID)
+}
+
+// domainUsersRID is the RID of the Domain Users group, the default primary group of AD users
+const domainUsersRID = 513
+
+// Config returns the autorid flag and slice settings of the underlying context
+func (c *IDMapContext) Config() (ContextConfig, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ctx == nil {
+		return ContextConfig{}, fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	config, setting, code := contextConfig(c.ctx)
+	c.debugCode("Config", code)
+	if code != IDMAPSuccess {
+		return ContextConfig{}, c.fail("Config", code, "", fmt.Errorf("%w: failed to read %s (code: %d)", ErrInternal, setting, code))
+	}
+
+	return config, nil
+}
+
+// DomainHasAlgorithmicMapping reports whether IDs of the given registered domain are
+// computed by libsss_idmap rather than managed externally
+// The answer cannot change while the domain stays registered, so the library is asked
+// only once per domain until Reset or Reconfigure; failures are not remembered
+func (c *IDMapContext) DomainHasAlgorithmicMapping(domainSID string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ctx == nil {
+		return false, fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	if algorithmic, ok := c.algorithmic.Load(domainSID); ok {
+		return algorithmic.(bool), nil
+	}
+
+	algorithmic, code := domainHasAlgorithmicMapping(c.ctx, domainSID)
+	c.debugCode("DomainHasAlgorithmicMapping", code)
+	if code != IDMAPSuccess {
+		switch code {
+		case IDMAPSIDInvalid:
+			return false, c.fail("DomainHasAlgorithmicMapping", code, domainSID, fmt.Errorf("%w: %s", ErrInvalidSID, domainSID))
+		case IDMAPNoDomain, IDMAPSIDUnknown:
+			return false, c.fail("DomainHasAlgorithmicMapping", code, domainSID, fmt.Errorf("%w: %s", ErrNotFound, domainSID))
+		default:
+			return false, c.fail("DomainHasAlgorithmicMapping", code, domainSID, fmt.Errorf("%w: failed to check domain %s (code: %d)", ErrInternal, domainSID, code))
+		}
+	}
+
+	c.algorithmic.Store(domainSID, algorithmic)
+	return algorithmic, nil
+}
+
+// DomainByNameHasAlgorithmicMapping reports whether IDs of the registered domain with the
+// given name are computed by libsss_idmap rather than managed externally
+// Names are matched case-insensitively
+func (c *IDMapContext) DomainByNameHasAlgorithmicMapping(domainName string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.ctx == nil {
+		return false, fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	algorithmic, code := domainByNameHasAlgorithmicMapping(c.ctx, strings.ToUpper(domainName))
+	c.debugCode("DomainByNameHasAlgorithmicMapping", code)
+	if code != IDMAPSuccess {
+		switch code {
+		case IDMAPNoDomain, IDMAPNameUnknown:
+			return false, c.fail("DomainByNameHasAlgorithmicMapping", code, "", fmt.Errorf("%w: domain %s", ErrNotFound, domainName))
+		default:
+			return false, c.fail("DomainByNameHasAlgorithmicMapping", code, "", fmt.Errorf("%w: failed to check domain %s (code: %d)", ErrInternal, domainName, code))
+		}
+	}
+
+	return algorithmic, nil
+}
+
+// SIDToUnixIDByDomainName converts sid after checking that it belongs to the registered
+// domain with the given name (matched case-insensitively) and that the domain is mapped
+// algorithmically
+func (c *IDMapContext) SIDToUnixIDByDomainName(domainName, sid string) (uint32, error) {
+	algorithmic, err := c.DomainByNameHasAlgorithmicMapping(domainName)
+	if err != nil {
+		return 0, err
+	}
+	if !algorithmic {
+		return 0, fmt.Errorf("%w: domain %s is not mapped algorithmically", ErrInternal, domainName)
+	}
+
+	if domain, ok := c.MatchDomain(sid); !ok || !strings.EqualFold(domain.DomainName, domainName) {
+		return 0, fmt.Errorf("%w: %s is not in domain %s", ErrNotFound, sid, domainName)
+	}
+
+	return c.SIDToUnixID(sid)
+}
+
+// PrimaryGroupGID maps the Domain Users group (RID 513) of the user's domain
+// This assumes the user's primaryGroupID has not been changed from the AD default
+func (c *IDMapContext) PrimaryGroupGID(userSID string) (uint32, error) {
+	return c.PrimaryGroupGIDFromRID(userSID, domainUsersRID)
+}
+
+// PrimaryGroupGIDFromRID maps the group with primaryGroupRID in the user's domain, for
+// callers that read the user's primaryGroupID attribute from AD
+func (c *IDMapContext) PrimaryGroupGIDFromRID(userSID string, primaryGroupRID uint32) (uint32, error) {
+	domainSID, err := DomainSIDOf(userSID)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.RIDToUnixID(domainSID, primaryGroupRID)
+}
+
+// RIDToUnixID maps the account with the given RID in the domain identified by domainSID
+func (c *IDMapContext) RIDToUnixID(domainSID string, rid uint32) (uint32, error) {
+	sid, err := BuildSID(domainSID, rid)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.SIDToUnixID(sid)
+}
+
+// MapRIDAgainstDefault maps the account with the given RID in the domain set by
+// WithDefaultDomain, returning ErrNotFound if no default domain was set
+func (c *IDMapContext) MapRIDAgainstDefault(rid uint32) (uint32, error) {
+	if c.defaultDomainSID == "" {
+		return 0, fmt.Errorf("%w: no default domain configured", ErrNotFound)
+	}
+
+	return c.RIDToUnixID(c.defaultDomainSID, rid)
+}
+
+// RIDToUnixIDTyped is RIDToUnixID for a parsed domain SID; the account SID is built in
+// binary form and converted without formatting or parsing a string
+func (c *IDMapContext) RIDToUnixIDTyped(domain *SID, rid uint32) (uint32, error) {
+	if domain == nil {
+		return 0, fmt.Errorf("%w: nil domain SID", ErrInvalidSID)
+	}
+	if domain.Revision == 0 || domain.Authority > maxAuthority || len(domain.SubAuthorities) >= maxSubAuthorities {
+		return 0, fmt.Errorf("%w: %s cannot take a RID", ErrInvalidSID, domain)
+	}
+	// The typed form of BuildSID's check for account SIDs passed as domain SIDs
+	if domain.Revision == 1 && domain.Authority == 5 && len(domain.SubAuthorities) > 0 && domain.SubAuthorities[0] == 21 && len(domain.SubAuthorities) != 4 {
+		return 0, fmt.Errorf("%w: %q is not a domain SID of the form S-1-5-21-X-Y-Z", ErrInvalidSID, domain)
+	}
+
+	var buf [binSIDHeaderLen + 4*maxSubAuthorities]byte
+	sid := domain.appendBinary(buf[:0])
+	sid[1]++
+	sid = binary.LittleEndian.AppendUint32(sid, rid)
+
+	return c.BinSIDToUnixID(sid)
+}
+
+// BinSIDToUnixID converts a binary (objectSid) Windows SID to a Unix UID or GID
+// Returns the Unix ID and an error if the conversion fails
+func (c *IDMapContext) BinSIDToUnixID(sid []byte) (_ uint32, retErr error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	defer func() { c.stats.record(retErr) }()
+	defer c.recoverPanic("BinSIDToUnixID", &retErr)
+
+	if c.ctx == nil {
+		return 0, fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	// Reject truncated input in Go rather than handing it to the C library
+	if err := checkBinSID(sid); err != nil {
+		return 0, err
+	}
+
+	if len(c.wellKnownIDs) > 0 {
+		if strSID, err := DecodeSID(sid); err == nil {
+			if id, ok := c.wellKnownIDs[strSID]; ok {
+				return id, nil
+			}
+		}
+	}
+
+	if bytes.Equal(sid[2:binSIDHeaderLen], mandatoryLabelAuthority) {
+		return 0, fmt.Errorf("%w: %x is an integrity label", ErrNotMappable, sid)
+	}
+
+	unixID, code := binSIDToUnix(c.ctx, sid)
+	c.debugCode("BinSIDToUnixID", code)
+	if code != IDMAPSuccess {
+		hexSID := fmt.Sprintf("%x", sid)
+		switch code {
+		case IDMAPSIDInvalid:
+			return 0, c.fail("BinSIDToUnixID", code, hexSID, fmt.Errorf("%w: %s", ErrInvalidSID, hexSID))
+		case IDMAPNoDomain:
+			if c.hasFallback {
+				c.stats.fallbacks.Add(1)
+				return c.fallbackID, nil
+			}
+			if c.unmapped != nil {
+				if strSID, err := DecodeSID(sid); err == nil {
+					c.unmapped(strSID)
+				}
+			}
+			return 0, c.fail("BinSIDToUnixID", code, hexSID, fmt.Errorf("%w: %s", ErrNotFound, hexSID))
+		case IDMAPBuiltinSID:
+			return 0, c.fail("BinSIDToUnixID", code, hexSID, fmt.Errorf("%w: %s", ErrBuiltinSID, hexSID))
+		default:
+			return 0, c.fail("BinSIDToUnixID", code, hexSID, fmt.Errorf("%w: failed to convert binary SID %s (code: %d)", ErrInternal, hexSID, code))
+		}
+	}
+
+	return unixID, nil
 }
 
 // SIDToUnixID is a convenience function that creates a context, performs the conversion, and cleans up
@@ -154,46 +973,42 @@ func SIDToUnixID(sid string) (uint32, error) {
 	return ctx.SIDToUnixID(sid)
 }
 
-// DecodeSID converts a binary SID to string format
-// https://ldapwiki.com/wiki/Wiki.jsp?page=ObjectSID
-func DecodeSID(sid []byte) (string, error) {
-	if len(sid) < 8 {
-		return "", fmt.Errorf("SID too short: %d bytes", len(sid))
+// MapSIDWithRange maps sid as if domainSID were configured with idRange, without any
+// long-lived context; a throwaway context is created and freed for the one conversion
+func MapSIDWithRange(sid string, domainSID string, idRange IDRange) (uint32, error) {
+	ctx, err := NewIDMapContextWithDomain(DomainConfig{
+		DomainName: domainSID,
+		DomainSID:  domainSID,
+		IDRange:    idRange,
+	})
+	if err != nil {
+		return 0, err
 	}
+	defer ctx.Close()
 
-	// Get revision level
-	revision := sid[0]
-
-	// Get count of sub-authorities
-	subAuthCount := int(sid[1])
+	return ctx.SIDToUnixID(sid)
+}
 
-	// Validate length
-	expectedLen := 8 + (subAuthCount * 4)
-	if len(sid) != expectedLen {
-		return "", fmt.Errorf("invalid SID length: expected %d, got %d", expectedLen, len(sid))
-	}
+// DecodeSID converts a binary SID to string format
+// https://ldapwiki.com/wiki/Wiki.jsp?page=ObjectSID
+func DecodeSID(sid []byte, opts ...SIDOption) (string, error) {
+	return DecodeSIDWithOrder(sid, SubAuthLittleEndian, opts...)
+}
 
-	// Build the SID string
-	var result string
-	result = fmt.Sprintf("S-%d", revision)
+// DecodeSIDWithOrder converts a binary SID whose sub-authorities are stored in the given
+// byte order; use SubAuthBigEndian for blobs byte-swapped by a faulty exporter
+func DecodeSIDWithOrder(sid []byte, order SubAuthOrder, opts ...SIDOption) (string, error) {
+	o := newSIDOptions(opts)
 
-	// Process 48-bit authority (Big-Endian)
-	var authority uint64
-	for i := 2; i <= 7; i++ {
-		authority |= uint64(sid[i]) << (8 * uint(5-(i-2)))
+	if err := checkBinSID(sid); err != nil {
+		return "", err
 	}
-	result += fmt.Sprintf("-%d", authority)
-
-	// Process sub-authorities (Little-Endian)
-	offset := 8
-	for j := 0; j < subAuthCount; j++ {
-		var subAuth uint32
-		for k := 0; k < 4; k++ {
-			subAuth |= uint32(sid[offset+k]) << (8 * uint(k))
-		}
-		result += fmt.Sprintf("-%d", subAuth)
-		offset += 4
+	if o.strictRevision && sid[0] != sidRevision {
+		return "", fmt.Errorf("%w: unsupported binary SID revision %d, want %d", ErrInvalidSID, sid[0], sidRevision)
+	}
+	if int(sid[1]) > o.maxSubAuthorities {
+		return "", fmt.Errorf("%w: %d sub-authorities exceeds maximum of %d", ErrInvalidSID, sid[1], o.maxSubAuthorities)
 	}
 
-	return result, nil
+	return string(appendSID(make([]byte, 0, maxSIDStringLen), sid, int(sid[1]), order, o)), nil
 }
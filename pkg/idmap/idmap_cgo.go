@@ -0,0 +1,213 @@
+//go:build !nosssidmap
+
+package idmap
+
+/*
+#cgo pkg-config: sss_idmap
+#include <stdlib.h>
+#include <sss_idmap.h>
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Return codes defined by libsss_idmap
+const (
+	IDMAPSuccess        ErrorCode = C.IDMAP_SUCCESS
+	IDMAPNotImplemented ErrorCode = C.IDMAP_NOT_IMPLEMENTED
+	IDMAPError          ErrorCode = C.IDMAP_ERROR
+	IDMAPOutOfMemory    ErrorCode = C.IDMAP_OUT_OF_MEMORY
+	IDMAPNoDomain       ErrorCode = C.IDMAP_NO_DOMAIN
+	IDMAPContextInvalid ErrorCode = C.IDMAP_CONTEXT_INVALID
+	IDMAPSIDInvalid     ErrorCode = C.IDMAP_SID_INVALID
+	IDMAPSIDUnknown     ErrorCode = C.IDMAP_SID_UNKNOWN
+	IDMAPNoRange        ErrorCode = C.IDMAP_NO_RANGE
+	IDMAPBuiltinSID     ErrorCode = C.IDMAP_BUILTIN_SID
+	IDMAPOutOfSlices    ErrorCode = C.IDMAP_OUT_OF_SLICES
+	IDMAPCollision      ErrorCode = C.IDMAP_COLLISION
+	IDMAPExternal       ErrorCode = C.IDMAP_EXTERNAL
+	IDMAPNameUnknown    ErrorCode = C.IDMAP_NAME_UNKNOWN
+)
+
+// cContext is the libsss_idmap context handle
+type cContext = C.struct_sss_idmap_ctx
+
+// newCContext initializes an sss_idmap_ctx with the settings from the context's options
+func (c *IDMapContext) newCContext(op string) (*cContext, error) {
+	var ctx *cContext
+
+	err := C.sss_idmap_init(nil, nil, nil, &ctx)
+	c.debugCode(op, ErrorCode(err))
+	if code := ErrorCode(err); code != IDMAPSuccess {
+		return nil, c.fail(op, code, "", fmt.Errorf("%w: failed to initialize idmap context (code: %d)", ErrInternal, err))
+	}
+
+	if c.autorid {
+		err = C.sss_idmap_ctx_set_autorid(ctx, C.bool(true))
+		c.debugCode(op, ErrorCode(err))
+		if code := ErrorCode(err); code != IDMAPSuccess {
+			C.sss_idmap_free(ctx)
+			return nil, c.fail(op, code, "", fmt.Errorf("%w: failed to enable autorid (code: %d)", ErrInternal, err))
+		}
+	}
+
+	if c.extraSliceInit > 0 {
+		err = C.sss_idmap_ctx_set_extra_slice_init(ctx, C.int(c.extraSliceInit))
+		c.debugCode(op, ErrorCode(err))
+		if code := ErrorCode(err); code != IDMAPSuccess {
+			C.sss_idmap_free(ctx)
+			return nil, c.fail(op, code, "", fmt.Errorf("%w: failed to set extra_slice_init (code: %d)", ErrInternal, err))
+		}
+	}
+
+	return ctx, nil
+}
+
+// freeCContext releases ctx
+func freeCContext(ctx *cContext) ErrorCode {
+	return ErrorCode(C.sss_idmap_free(ctx))
+}
+
+// addDomain registers config with ctx, which need not be the context's current one
+// With config.AutoSlices set the domain is added through sss_idmap_add_auto_domain_ex,
+// which also pre-allocates the extra slices requested with WithExtraSliceInit
+func (c *IDMapContext) addDomain(ctx *cContext, config DomainConfig) error {
+	if !c.relaxedRanges && config.IDRange.Min >= config.IDRange.Max {
+		return fmt.Errorf("%w: min (%d) must be less than max (%d)", ErrInvalidRange, config.IDRange.Min, config.IDRange.Max)
+	}
+
+	// AD domain names are case-insensitive; the library compares them exactly
+	cDomainName := C.CString(strings.ToUpper(config.DomainName))
+	defer C.free(unsafe.Pointer(cDomainName))
+
+	cDomainSID := C.CString(config.DomainSID)
+	defer C.free(unsafe.Pointer(cDomainSID))
+
+	cRange := C.struct_sss_idmap_range{
+		min: C.uint32_t(config.IDRange.Min),
+		max: C.uint32_t(config.IDRange.Max),
+	}
+
+	op := "AddDomain"
+	var err C.enum_idmap_error_code
+	if config.AutoSlices {
+		op = "AddAutoDomain"
+		err = C.sss_idmap_add_auto_domain_ex(ctx, cDomainName, cDomainSID, &cRange, nil, 0, C.bool(config.ExternalMapping), nil, nil)
+	} else {
+		err = C.sss_idmap_add_domain_ex(ctx, cDomainName, cDomainSID, &cRange, nil, 0, C.bool(config.ExternalMapping))
+	}
+	c.debugCode(op, ErrorCode(err))
+	if code := ErrorCode(err); code != IDMAPSuccess {
+		switch code {
+		case IDMAPSIDInvalid:
+			return c.fail(op, code, config.DomainSID, fmt.Errorf("%w: invalid domain SID %s", ErrInvalidSID, config.DomainSID))
+		case IDMAPCollision:
+			return c.fail(op, code, config.DomainSID, fmt.Errorf("%w: domain %s already exists or range conflicts", ErrInternal, config.DomainName))
+		default:
+			return c.fail(op, code, config.DomainSID, fmt.Errorf("%w: failed to add domain %s (code: %d)", ErrInternal, config.DomainName, err))
+		}
+	}
+
+	return nil
+}
+
+// calculateRange asks ctx for the first free slice of rangesize IDs, starting at the slice
+// rangeID hashes to as SSSD does
+func calculateRange(ctx *cContext, rangeID string) (IDRange, ErrorCode) {
+	cRangeID := C.CString(rangeID)
+	defer C.free(unsafe.Pointer(cRangeID))
+
+	// An all-ones slice number requests the hashed slice
+	sliceNum := ^C.id_t(0)
+	var cRange C.struct_sss_idmap_range
+	err := C.sss_idmap_calculate_range(ctx, cRangeID, &sliceNum, &cRange)
+	return IDRange{Min: uint32(cRange.min), Max: uint32(cRange.max)}, ErrorCode(err)
+}
+
+// sidToUnix converts a string SID with ctx
+func sidToUnix(ctx *cContext, sid string) (uint32, ErrorCode) {
+	cSID := C.CString(sid)
+	defer C.free(unsafe.Pointer(cSID))
+
+	var unixID C.uint32_t
+	err := C.sss_idmap_sid_to_unix(ctx, cSID, &unixID)
+	return uint32(unixID), ErrorCode(err)
+}
+
+// binSIDToUnix converts a binary SID with ctx; sid must not be empty
+func binSIDToUnix(ctx *cContext, sid []byte) (uint32, ErrorCode) {
+	var unixID C.uint32_t
+	err := C.sss_idmap_bin_sid_to_unix(ctx, (*C.uint8_t)(unsafe.Pointer(&sid[0])), C.size_t(len(sid)), &unixID)
+	return uint32(unixID), ErrorCode(err)
+}
+
+// unixToSID converts a Unix ID back to a string SID with ctx
+func unixToSID(ctx *cContext, id uint32) (string, ErrorCode) {
+	var cSID *C.char
+	err := C.sss_idmap_unix_to_sid(ctx, C.uint32_t(id), &cSID)
+	if code := ErrorCode(err); code != IDMAPSuccess {
+		return "", code
+	}
+	defer C.sss_idmap_free_sid(ctx, cSID)
+
+	return C.GoString(cSID), IDMAPSuccess
+}
+
+// checkSIDUnixC checks with ctx that id lies in a range of sid's domain
+func checkSIDUnixC(ctx *cContext, sid string, id uint32) ErrorCode {
+	cSID := C.CString(sid)
+	defer C.free(unsafe.Pointer(cSID))
+
+	return ErrorCode(C.sss_idmap_check_sid_unix(ctx, cSID, C.uint32_t(id)))
+}
+
+// contextConfig reads the settings of ctx; on failure it names the setting it could not read
+func contextConfig(ctx *cContext) (ContextConfig, string, ErrorCode) {
+	var (
+		autorid                 C.bool
+		lower, upper, rangeSize C.id_t
+	)
+
+	if err := C.sss_idmap_ctx_get_autorid(ctx, &autorid); ErrorCode(err) != IDMAPSuccess {
+		return ContextConfig{}, "autorid", ErrorCode(err)
+	}
+	if err := C.sss_idmap_ctx_get_lower(ctx, &lower); ErrorCode(err) != IDMAPSuccess {
+		return ContextConfig{}, "lower bound", ErrorCode(err)
+	}
+	if err := C.sss_idmap_ctx_get_upper(ctx, &upper); ErrorCode(err) != IDMAPSuccess {
+		return ContextConfig{}, "upper bound", ErrorCode(err)
+	}
+	if err := C.sss_idmap_ctx_get_rangesize(ctx, &rangeSize); ErrorCode(err) != IDMAPSuccess {
+		return ContextConfig{}, "range size", ErrorCode(err)
+	}
+
+	return ContextConfig{
+		Autorid:   bool(autorid),
+		Lower:     uint32(lower),
+		Upper:     uint32(upper),
+		RangeSize: uint32(rangeSize),
+	}, "", IDMAPSuccess
+}
+
+// domainHasAlgorithmicMapping asks ctx whether the domain with the given SID is mapped algorithmically
+func domainHasAlgorithmicMapping(ctx *cContext, domainSID string) (bool, ErrorCode) {
+	cDomainSID := C.CString(domainSID)
+	defer C.free(unsafe.Pointer(cDomainSID))
+
+	var algorithmic C.bool
+	err := C.sss_idmap_domain_has_algorithmic_mapping(ctx, cDomainSID, &algorithmic)
+	return bool(algorithmic), ErrorCode(err)
+}
+
+// domainByNameHasAlgorithmicMapping asks ctx whether the named domain is mapped algorithmically
+func domainByNameHasAlgorithmicMapping(ctx *cContext, domainName string) (bool, ErrorCode) {
+	cDomainName := C.CString(domainName)
+	defer C.free(unsafe.Pointer(cDomainName))
+
+	var algorithmic C.bool
+	err := C.sss_idmap_domain_by_name_has_algorithmic_mapping(ctx, cDomainName, &algorithmic)
+	return bool(algorithmic), ErrorCode(err)
+}
@@ -0,0 +1,79 @@
+//go:build nosssidmap
+
+// This file replaces idmap_cgo.go in the opt-in stub build (-tags nosssidmap), which
+// links no libsss_idmap: it compiles without cgo or the library's headers, and every
+// context constructor reports ErrLibraryUnavailable whether or not the host has the library
+
+package idmap
+
+import "fmt"
+
+// Return codes defined by libsss_idmap, with the values of enum idmap_error_code
+const (
+	IDMAPSuccess        ErrorCode = 0
+	IDMAPNotImplemented ErrorCode = 1
+	IDMAPError          ErrorCode = 2
+	IDMAPOutOfMemory    ErrorCode = 3
+	IDMAPNoDomain       ErrorCode = 4
+	IDMAPContextInvalid ErrorCode = 5
+	IDMAPSIDInvalid     ErrorCode = 6
+	IDMAPSIDUnknown     ErrorCode = 7
+	IDMAPNoRange        ErrorCode = 8
+	IDMAPBuiltinSID     ErrorCode = 9
+	IDMAPOutOfSlices    ErrorCode = 10
+	IDMAPCollision      ErrorCode = 11
+	IDMAPExternal       ErrorCode = 12
+	IDMAPNameUnknown    ErrorCode = 13
+)
+
+// cContext stands in for the libsss_idmap context handle, which this build never creates
+type cContext struct{}
+
+// newCContext fails: this build has no libsss_idmap, so every context constructor
+// reports ErrLibraryUnavailable
+func (c *IDMapContext) newCContext(op string) (*cContext, error) {
+	return nil, fmt.Errorf("%s: %w", op, ErrLibraryUnavailable)
+}
+
+// The remaining primitives are unreachable since no context can be created; they only
+// satisfy the shared code
+
+func freeCContext(*cContext) ErrorCode {
+	return IDMAPSuccess
+}
+
+func (c *IDMapContext) addDomain(*cContext, DomainConfig) error {
+	return ErrLibraryUnavailable
+}
+
+func calculateRange(*cContext, string) (IDRange, ErrorCode) {
+	return IDRange{}, IDMAPNotImplemented
+}
+
+func sidToUnix(*cContext, string) (uint32, ErrorCode) {
+	return 0, IDMAPNotImplemented
+}
+
+func binSIDToUnix(*cContext, []byte) (uint32, ErrorCode) {
+	return 0, IDMAPNotImplemented
+}
+
+func unixToSID(*cContext, uint32) (string, ErrorCode) {
+	return "", IDMAPNotImplemented
+}
+
+func checkSIDUnixC(*cContext, string, uint32) ErrorCode {
+	return IDMAPNotImplemented
+}
+
+func contextConfig(*cContext) (ContextConfig, string, ErrorCode) {
+	return ContextConfig{}, "autorid", IDMAPNotImplemented
+}
+
+func domainHasAlgorithmicMapping(*cContext, string) (bool, ErrorCode) {
+	return false, IDMAPNotImplemented
+}
+
+func domainByNameHasAlgorithmicMapping(*cContext, string) (bool, ErrorCode) {
+	return false, IDMAPNotImplemented
+}
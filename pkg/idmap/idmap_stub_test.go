@@ -0,0 +1,25 @@
+//go:build nosssidmap
+
+package idmap_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestNewIDMapContext_LibraryUnavailable(t *testing.T) {
+	if _, err := idmap.NewIDMapContext(); !errors.Is(err, idmap.ErrLibraryUnavailable) {
+		t.Errorf("NewIDMapContext() = %v, want ErrLibraryUnavailable", err)
+	}
+	if _, err := idmap.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013"); !errors.Is(err, idmap.ErrLibraryUnavailable) {
+		t.Errorf("SIDToUnixID() = %v, want ErrLibraryUnavailable", err)
+	}
+}
+
+// requireLibrary skips tests that need libsss_idmap, which this build does not link
+func requireLibrary(tb testing.TB) {
+	tb.Helper()
+	tb.Skip("needs libsss_idmap; built with -tags nosssidmap")
+}
@@ -1,14 +1,23 @@
 package idmap_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
 )
 
 func TestNewIDMapContext(t *testing.T) {
+	requireLibrary(t)
+
 	ctx, err := idmap.NewIDMapContext()
 	if err != nil {
 		t.Fatalf("NewIDMapContext() failed: %v", err)
@@ -24,124 +33,1676 @@ func TestNewIDMapContext(t *testing.T) {
 	}
 }
 
-func TestNewIDMapContextWithDomain(t *testing.T) {
-	config := idmap.DomainConfig{
+func TestNewIDMapContextWithDomain(t *testing.T) {
+	requireLibrary(t)
+
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange: idmap.IDRange{
+			Min: 10000,
+			Max: 20000,
+		},
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(config)
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	if ctx == nil {
+		t.Fatal("NewIDMapContextWithDomain() returned nil context")
+	}
+}
+
+func TestAddDomain(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext()
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	config := idmap.DomainConfig{
+		DomainName: "TESTDOMAIN",
+		DomainSID:  "S-1-5-21-1234567890-1234567890-1234567890",
+		IDRange: idmap.IDRange{
+			Min: 10000,
+			Max: 20000,
+		},
+	}
+
+	err = ctx.AddDomain(config)
+	if err != nil {
+		t.Errorf("AddDomain() failed: %v", err)
+	}
+}
+
+func TestAddDomain_InvalidRange(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext()
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	tests := []struct {
+		name   string
+		config idmap.DomainConfig
+	}{
+		{
+			name: "min equals max",
+			config: idmap.DomainConfig{
+				DomainName: "INVALID1",
+				DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+				IDRange:    idmap.IDRange{Min: 10000, Max: 10000},
+			},
+		},
+		{
+			name: "min greater than max",
+			config: idmap.DomainConfig{
+				DomainName: "INVALID2",
+				DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+				IDRange:    idmap.IDRange{Min: 20000, Max: 10000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ctx.AddDomain(tt.config)
+			if err == nil {
+				t.Error("AddDomain() expected error for invalid range, got nil")
+			}
+			if !errors.Is(err, idmap.ErrInvalidRange) {
+				t.Errorf("AddDomain() expected ErrInvalidRange, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestSIDToUnixID_WithDomain(t *testing.T) {
+	requireLibrary(t)
+
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange: idmap.IDRange{
+			Min: 10000,
+			Max: 20000,
+		},
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(config)
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	// Test converting a SID from the configured domain
+	sid := "S-1-5-21-3623811015-3361044348-30300820-1013"
+	unixID, err := ctx.SIDToUnixID(sid)
+	if err != nil {
+		t.Fatalf("SIDToUnixID(%q) failed: %v", sid, err)
+	}
+
+	// Verify the ID is within the configured range
+	if unixID < config.IDRange.Min || unixID > config.IDRange.Max {
+		t.Errorf("SIDToUnixID(%q) = %d, want ID in range [%d, %d]",
+			sid, unixID, config.IDRange.Min, config.IDRange.Max)
+	}
+
+	t.Logf("SID %s mapped to Unix ID %d", sid, unixID)
+}
+
+// captureHandler is a slog.Handler that records every log record it receives
+type captureHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+// attrs returns the attributes of the first record with the given message
+func (h *captureHandler) attrs(msg string) map[string]slog.Value {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return attrs
+	}
+	return nil
+}
+
+// countOp returns how many records with the given message carry op as their "op" attribute
+func (h *captureHandler) countOp(msg, op string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := 0
+	for _, r := range h.records {
+		r.Attrs(func(a slog.Attr) bool {
+			if r.Message == msg && a.Key == "op" && a.Value.String() == op {
+				n++
+			}
+			return true
+		})
+	}
+	return n
+}
+
+func TestSIDToUnixID_DebugLogging(t *testing.T) {
+	requireLibrary(t)
+
+	tests := []struct {
+		name       string
+		idRange    idmap.IDRange
+		rid        string
+		wantOffset uint64
+	}{
+		{name: "default-sized range", idRange: idmap.IDRange{Min: 10000, Max: 20000}, rid: "1013", wantOffset: 1013},
+		// The range is longer than the context's 200000-ID slices, yet holds a single slice
+		{name: "range longer than rangesize", idRange: idmap.IDRange{Min: 10000, Max: 409999}, rid: "250013", wantOffset: 250013},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+				DomainName: "EXAMPLE",
+				DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+				IDRange:    tt.idRange,
+			})
+			if err != nil {
+				t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+			}
+			defer ctx.Close()
+
+			handler := &captureHandler{}
+			ctx.SetLogger(slog.New(handler))
+
+			sid := "S-1-5-21-3623811015-3361044348-30300820-" + tt.rid
+			if _, err := ctx.SIDToUnixID(sid); err != nil {
+				t.Fatalf("SIDToUnixID(%q) failed: %v", sid, err)
+			}
+
+			attrs := handler.attrs("resolved SID")
+			if attrs == nil {
+				t.Fatal("no \"resolved SID\" debug record logged")
+			}
+
+			if got := attrs["domain"].String(); got != "EXAMPLE" {
+				t.Errorf("domain = %q, want %q", got, "EXAMPLE")
+			}
+			if got := attrs["slice"].Uint64(); got != 0 {
+				t.Errorf("slice = %d, want 0", got)
+			}
+			if got := attrs["offset"].Uint64(); got != tt.wantOffset {
+				t.Errorf("offset = %d, want %d", got, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestSIDToUnixID_DebugLoggingExtraSlice(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext(idmap.WithExtraSliceInit(1))
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	if err := ctx.AddAutoDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 200000, Max: 399999},
+	}); err != nil {
+		t.Fatalf("AddAutoDomain() failed: %v", err)
+	}
+
+	handler := &captureHandler{}
+	ctx.SetLogger(slog.New(handler))
+
+	// RID 250013 is offset 50013 into the second slice of 200000 IDs
+	sid := "S-1-5-21-3623811015-3361044348-30300820-250013"
+	if _, err := ctx.SIDToUnixID(sid); err != nil {
+		t.Fatalf("SIDToUnixID(%q) failed: %v", sid, err)
+	}
+
+	attrs := handler.attrs("resolved SID")
+	if attrs == nil {
+		t.Fatal("no \"resolved SID\" debug record logged")
+	}
+	if got := attrs["slice"].Uint64(); got != 1 {
+		t.Errorf("slice = %d, want 1", got)
+	}
+	if got := attrs["offset"].Uint64(); got != 50013 {
+		t.Errorf("offset = %d, want 50013", got)
+	}
+}
+
+func TestWithDebugCodes(t *testing.T) {
+	requireLibrary(t)
+
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+
+	for _, enabled := range []bool{true, false} {
+		var opts []idmap.Option
+		if enabled {
+			opts = append(opts, idmap.WithDebugCodes())
+		}
+		ctx, err := idmap.NewIDMapContextWithDomain(config, opts...)
+		if err != nil {
+			t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+		}
+		defer ctx.Close()
+
+		handler := &captureHandler{}
+		ctx.SetLogger(slog.New(handler))
+
+		if _, err := ctx.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013"); err != nil {
+			t.Fatalf("SIDToUnixID() failed: %v", err)
+		}
+
+		attrs := handler.attrs("libsss_idmap returned")
+		if !enabled {
+			if attrs != nil {
+				t.Errorf("return code logged without WithDebugCodes: %v", attrs)
+			}
+			continue
+		}
+		if attrs == nil {
+			t.Fatal("no \"libsss_idmap returned\" debug record logged")
+		}
+		if got := attrs["op"].String(); got != "SIDToUnixID" {
+			t.Errorf("op = %q, want %q", got, "SIDToUnixID")
+		}
+		if got := attrs["code"].Int64(); got != int64(idmap.IDMAPSuccess) {
+			t.Errorf("code = %d, want %d", got, idmap.IDMAPSuccess)
+		}
+		if got := attrs["name"].String(); got != idmap.IDMAPSuccess.String() {
+			t.Errorf("name = %q, want %q", got, idmap.IDMAPSuccess.String())
+		}
+	}
+}
+
+func TestDomainHasAlgorithmicMapping_Memoized(t *testing.T) {
+	requireLibrary(t)
+
+	example := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+	other := idmap.DomainConfig{
+		DomainName:      "OTHER",
+		DomainSID:       "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:         idmap.IDRange{Min: 30000, Max: 40000},
+		ExternalMapping: true,
+	}
+
+	ctx, err := idmap.NewIDMapContext(idmap.WithDebugCodes())
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+	if err := ctx.AddDomainsAtomic([]idmap.DomainConfig{example, other}); err != nil {
+		t.Fatalf("AddDomainsAtomic() failed: %v", err)
+	}
+
+	handler := &captureHandler{}
+	ctx.SetLogger(slog.New(handler))
+
+	check := func(wantCalls int) {
+		t.Helper()
+		for range 3 {
+			for _, d := range []idmap.DomainConfig{example, other} {
+				got, err := ctx.DomainHasAlgorithmicMapping(d.DomainSID)
+				if err != nil || got != !d.ExternalMapping {
+					t.Errorf("DomainHasAlgorithmicMapping(%s) = %v, %v, want %v", d.DomainName, got, err, !d.ExternalMapping)
+				}
+			}
+		}
+		if got := handler.countOp("libsss_idmap returned", "DomainHasAlgorithmicMapping"); got != wantCalls {
+			t.Errorf("library called %d times, want %d", got, wantCalls)
+		}
+	}
+
+	check(2)
+
+	// Unknown domains are not remembered
+	for range 2 {
+		if _, err := ctx.DomainHasAlgorithmicMapping("S-1-5-21-1234567890-1234567890-1234567890"); !errors.Is(err, idmap.ErrNotFound) {
+			t.Errorf("DomainHasAlgorithmicMapping() for an unknown domain = %v, want ErrNotFound", err)
+		}
+	}
+	check(4)
+
+	if err := ctx.Reconfigure([]idmap.DomainConfig{example, other}); err != nil {
+		t.Fatalf("Reconfigure() failed: %v", err)
+	}
+	check(6)
+}
+
+func BenchmarkDomainHasAlgorithmicMapping(b *testing.B) {
+	requireLibrary(b)
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	})
+	if err != nil {
+		b.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := ctx.DomainHasAlgorithmicMapping("S-1-5-21-3623811015-3361044348-30300820"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWithErrorHook(t *testing.T) {
+	requireLibrary(t)
+
+	errUnmapped := errors.New("unmapped principal")
+	var gotOp, gotSID string
+	hook := func(code int, op string, sid string) error {
+		if idmap.ErrorCode(code) != idmap.IDMAPNoDomain {
+			return nil
+		}
+		gotOp, gotSID = op, sid
+		return errUnmapped
+	}
+
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(config, idmap.WithErrorHook(hook))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	// Mapped SIDs never reach the hook
+	if _, err := ctx.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013"); err != nil {
+		t.Fatalf("SIDToUnixID() failed: %v", err)
+	}
+
+	sid := "S-1-5-21-1111111111-2222222222-3333333333-1001"
+	_, err = ctx.SIDToUnixID(sid)
+	if !errors.Is(err, errUnmapped) {
+		t.Fatalf("SIDToUnixID(%q) = %v, want hook error", sid, err)
+	}
+	if gotOp != "SIDToUnixID" || gotSID != sid {
+		t.Errorf("hook called with op=%q sid=%q, want op=%q sid=%q", gotOp, gotSID, "SIDToUnixID", sid)
+	}
+}
+
+func TestWithErrorHook_Fallback(t *testing.T) {
+	requireLibrary(t)
+
+	hook := func(code int, op string, sid string) error { return nil }
+
+	ctx, err := idmap.NewIDMapContext(idmap.WithErrorHook(hook))
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	_, err = ctx.SIDToUnixID("S-1-5-21-1111111111-2222222222-3333333333-1001")
+	if !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("SIDToUnixID() = %v, want ErrNotFound when hook returns nil", err)
+	}
+}
+
+func TestWithErrorHook_BuiltinSID(t *testing.T) {
+	requireLibrary(t)
+
+	var gotCode idmap.ErrorCode
+	hook := func(code int, op string, sid string) error {
+		gotCode = idmap.ErrorCode(code)
+		return nil
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, idmap.WithErrorHook(hook))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	_, err = ctx.SIDToUnixID("S-1-5-32-544")
+	if gotCode != idmap.IDMAPBuiltinSID {
+		t.Errorf("hook called with code %v, want %v", gotCode, idmap.IDMAPBuiltinSID)
+	}
+	if !errors.Is(err, idmap.ErrBuiltinSID) {
+		t.Errorf("SIDToUnixID() = %v, want ErrBuiltinSID", err)
+	}
+	if errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("SIDToUnixID() = %v, want it not to match ErrNotFound", err)
+	}
+}
+
+func TestPrimaryGroupGID(t *testing.T) {
+	requireLibrary(t)
+
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(config)
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	for _, userSID := range []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+	} {
+		gid, err := ctx.PrimaryGroupGID(userSID)
+		if err != nil {
+			t.Fatalf("PrimaryGroupGID(%q) failed: %v", userSID, err)
+		}
+		if gid != 10513 {
+			t.Errorf("PrimaryGroupGID(%q) = %d, want 10513", userSID, gid)
+		}
+	}
+
+	if _, err := ctx.PrimaryGroupGID("S-1-5-21-1111111111-2222222222-3333333333-1001"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("PrimaryGroupGID() for unconfigured domain = %v, want ErrNotFound", err)
+	}
+	if _, err := ctx.PrimaryGroupGID("not-a-sid"); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("PrimaryGroupGID() for invalid SID = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestPrimaryGroupGIDFromRID(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+	const userSID = "S-1-5-21-3623811015-3361044348-30300820-1013"
+
+	tests := []struct {
+		name string
+		rid  uint32
+		want uint32
+	}{
+		{name: "Domain Users", rid: 513, want: 10513},
+		{name: "Domain Guests", rid: 514, want: 10514},
+		{name: "Domain Computers", rid: 515, want: 10515},
+		{name: "custom group", rid: 1107, want: 11107},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ctx.PrimaryGroupGIDFromRID(userSID, tt.rid)
+			if err != nil {
+				t.Fatalf("PrimaryGroupGIDFromRID(%q, %d) failed: %v", userSID, tt.rid, err)
+			}
+			if got != tt.want {
+				t.Errorf("PrimaryGroupGIDFromRID(%q, %d) = %d, want %d", userSID, tt.rid, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ctx.PrimaryGroupGIDFromRID("not-a-sid", 513); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("PrimaryGroupGIDFromRID() for invalid SID = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestRIDToUnixID(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	got, err := ctx.RIDToUnixID("S-1-5-21-3623811015-3361044348-30300820", 1013)
+	if err != nil || got != 11013 {
+		t.Errorf("RIDToUnixID() = %d, %v, want 11013", got, err)
+	}
+
+	if _, err := ctx.RIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013", 513); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("RIDToUnixID() with an account SID = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestMapRIDAgainstDefault(t *testing.T) {
+	requireLibrary(t)
+
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(config, idmap.WithDefaultDomain(config.DomainSID))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	for rid, want := range map[uint32]uint32{500: 10500, 513: 10513, 1013: 11013} {
+		if got, err := ctx.MapRIDAgainstDefault(rid); err != nil || got != want {
+			t.Errorf("MapRIDAgainstDefault(%d) = %d, %v, want %d", rid, got, err, want)
+		}
+	}
+
+	plain := newExampleContext(t)
+	if _, err := plain.MapRIDAgainstDefault(1013); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("MapRIDAgainstDefault() without a default domain = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRIDToUnixIDTyped(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	domain, err := idmap.ParseSID("S-1-5-21-3623811015-3361044348-30300820")
+	if err != nil {
+		t.Fatalf("ParseSID() failed: %v", err)
+	}
+
+	for _, rid := range []uint32{0, 500, 1013, 9999} {
+		want, wantErr := ctx.RIDToUnixID(domain.String(), rid)
+		got, err := ctx.RIDToUnixIDTyped(domain, rid)
+		if got != want || (err == nil) != (wantErr == nil) {
+			t.Errorf("RIDToUnixIDTyped(%d) = %d, %v, want %d, %v", rid, got, err, want, wantErr)
+		}
+	}
+
+	account, _ := idmap.ParseSID("S-1-5-21-3623811015-3361044348-30300820-1013")
+	for _, bad := range []*idmap.SID{nil, account, {Revision: 0, Authority: 5}} {
+		if _, err := ctx.RIDToUnixIDTyped(bad, 513); !errors.Is(err, idmap.ErrInvalidSID) {
+			t.Errorf("RIDToUnixIDTyped(%v) = %v, want ErrInvalidSID", bad, err)
+		}
+	}
+}
+
+func BenchmarkRIDToUnixID(b *testing.B) {
+	requireLibrary(b)
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	})
+	if err != nil {
+		b.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	const domainSID = "S-1-5-21-3623811015-3361044348-30300820"
+	domain, _ := idmap.ParseSID(domainSID)
+
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = ctx.RIDToUnixID(domainSID, 1013)
+		}
+	})
+
+	b.Run("typed", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = ctx.RIDToUnixIDTyped(domain, 1013)
+		}
+	})
+}
+
+func TestAddAutoDomain_ExtraSliceInit(t *testing.T) {
+	requireLibrary(t)
+
+	// The first slice of a default context (lower 200000, rangesize 200000)
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 200000, Max: 399999},
+	}
+	const highRID = "S-1-5-21-3623811015-3361044348-30300820-250013"
+
+	t.Run("without extra slices", func(t *testing.T) {
+		ctx, err := idmap.NewIDMapContext()
+		if err != nil {
+			t.Fatalf("NewIDMapContext() failed: %v", err)
+		}
+		defer ctx.Close()
+
+		if err := ctx.AddAutoDomain(config); err != nil {
+			t.Fatalf("AddAutoDomain() failed: %v", err)
+		}
+		if got, err := ctx.SIDToUnixID(highRID); err == nil {
+			t.Errorf("SIDToUnixID(%q) = %d, want an error beyond the first slice", highRID, got)
+		}
+	})
+
+	t.Run("with extra slices", func(t *testing.T) {
+		ctx, err := idmap.NewIDMapContext(idmap.WithExtraSliceInit(1))
+		if err != nil {
+			t.Fatalf("NewIDMapContext() failed: %v", err)
+		}
+		defer ctx.Close()
+
+		if err := ctx.AddAutoDomain(config); err != nil {
+			t.Fatalf("AddAutoDomain() failed: %v", err)
+		}
+
+		if got, err := ctx.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013"); err != nil || got != 201013 {
+			t.Errorf("SIDToUnixID() in the first slice = %d, %v, want 201013", got, err)
+		}
+
+		got, err := ctx.SIDToUnixID(highRID)
+		if err != nil {
+			t.Fatalf("SIDToUnixID(%q) failed: %v", highRID, err)
+		}
+		if got >= config.IDRange.Min && got <= config.IDRange.Max {
+			t.Errorf("SIDToUnixID(%q) = %d, want an ID outside the first slice", highRID, got)
+		}
+		// RID 250013 is offset 50013 into the second slice
+		if got%200000 != 50013 {
+			t.Errorf("SIDToUnixID(%q) = %d, want offset 50013 within its slice", highRID, got)
+		}
+		if err := ctx.CheckSIDUnix(highRID, got); err != nil {
+			t.Errorf("CheckSIDUnix(%q, %d) = %v, want nil", highRID, got, err)
+		}
+	})
+
+	t.Run("AddDomain ignores extra slices", func(t *testing.T) {
+		ctx, err := idmap.NewIDMapContextWithDomain(config, idmap.WithExtraSliceInit(1))
+		if err != nil {
+			t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+		}
+		defer ctx.Close()
+
+		if got, err := ctx.SIDToUnixID(highRID); err == nil {
+			t.Errorf("SIDToUnixID(%q) = %d, want an error beyond the first slice", highRID, got)
+		}
+	})
+}
+
+func TestAddDomainAuto(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext()
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	config, err := ctx.Config()
+	if err != nil {
+		t.Fatalf("Config() failed: %v", err)
+	}
+
+	for _, d := range []struct{ name, sid string }{
+		{"EXAMPLE", "S-1-5-21-3623811015-3361044348-30300820"},
+		{"CONTOSO", "S-1-5-21-1111111111-2222222222-3333333333"},
+	} {
+		if err := ctx.AddDomainAuto(d.name, d.sid); err != nil {
+			t.Fatalf("AddDomainAuto(%s) failed: %v", d.name, err)
+		}
+	}
+
+	domains, err := ctx.ListDomains()
+	if err != nil {
+		t.Fatalf("ListDomains() failed: %v", err)
+	}
+	if len(domains) != 2 {
+		t.Fatalf("ListDomains() returned %d domains, want 2", len(domains))
+	}
+
+	for _, d := range domains {
+		r := d.IDRange
+		if r.Max-r.Min+1 != config.RangeSize || r.Min < config.Lower || r.Max > config.Upper {
+			t.Errorf("%s range %d-%d is not a slice of %d IDs within %d-%d", d.DomainName, r.Min, r.Max, config.RangeSize, config.Lower, config.Upper)
+		}
+
+		sid := d.DomainSID + "-1013"
+		if got, err := ctx.SIDToUnixID(sid); err != nil || got != r.Min+1013 {
+			t.Errorf("SIDToUnixID(%q) = %d, %v, want %d", sid, got, err, r.Min+1013)
+		}
+	}
+
+	a, b := domains[0].IDRange, domains[1].IDRange
+	if a.Min <= b.Max && b.Min <= a.Max {
+		t.Errorf("auto ranges %d-%d and %d-%d overlap", a.Min, a.Max, b.Min, b.Max)
+	}
+
+	if err := ctx.AddDomainAuto("BAD", "not-a-sid"); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("AddDomainAuto() with an invalid SID = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestAddDomainsAtomic(t *testing.T) {
+	requireLibrary(t)
+
+	valid := []idmap.DomainConfig{
+		{
+			DomainName: "DOMAIN1",
+			DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+			IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+		},
+		{
+			DomainName: "DOMAIN2",
+			DomainSID:  "S-1-5-21-1444444444-1555555555-1666666666",
+			IDRange:    idmap.IDRange{Min: 20001, Max: 30000},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		third   idmap.DomainConfig
+		wantErr error
+	}{
+		{
+			name: "invalid range",
+			third: idmap.DomainConfig{
+				DomainName: "DOMAIN3",
+				DomainSID:  "S-1-5-21-1777777777-1888888888-1999999999",
+				IDRange:    idmap.IDRange{Min: 40000, Max: 30001},
+			},
+			wantErr: idmap.ErrInvalidRange,
+		},
+		{
+			name: "invalid SID",
+			third: idmap.DomainConfig{
+				DomainName: "DOMAIN3",
+				DomainSID:  "S-1-5-21-not-a-sid",
+				IDRange:    idmap.IDRange{Min: 30001, Max: 40000},
+			},
+			wantErr: idmap.ErrInvalidSID,
+		},
+		{
+			name: "overlapping range",
+			third: idmap.DomainConfig{
+				DomainName: "DOMAIN3",
+				DomainSID:  "S-1-5-21-1777777777-1888888888-1999999999",
+				IDRange:    idmap.IDRange{Min: 15000, Max: 25000},
+			},
+			wantErr: idmap.ErrInvalidRange,
+		},
+		{
+			name: "duplicate name",
+			third: idmap.DomainConfig{
+				DomainName: "domain1",
+				DomainSID:  "S-1-5-21-1777777777-1888888888-1999999999",
+				IDRange:    idmap.IDRange{Min: 30001, Max: 40000},
+			},
+			wantErr: idmap.ErrInvalidConfig,
+		},
+		{
+			name: "duplicate SID",
+			third: idmap.DomainConfig{
+				DomainName: "DOMAIN3",
+				DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+				IDRange:    idmap.IDRange{Min: 30001, Max: 40000},
+			},
+			wantErr: idmap.ErrInvalidConfig,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := idmap.NewIDMapContext()
+			if err != nil {
+				t.Fatalf("NewIDMapContext() failed: %v", err)
+			}
+			defer ctx.Close()
+
+			configs := append(append([]idmap.DomainConfig{}, valid...), tt.third)
+			if err := ctx.AddDomainsAtomic(configs); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AddDomainsAtomic() = %v, want %v", err, tt.wantErr)
+			}
+
+			// None of the valid domains may have been registered
+			for _, d := range valid {
+				if _, ok := ctx.MatchDomain(d.DomainSID + "-1001"); ok {
+					t.Errorf("domain %s was registered despite validation failure", d.DomainName)
+				}
+				if _, err := ctx.SIDToUnixID(d.DomainSID + "-1001"); !errors.Is(err, idmap.ErrNotFound) {
+					t.Errorf("SIDToUnixID() in %s = %v, want ErrNotFound", d.DomainName, err)
+				}
+			}
+		})
+	}
+
+	t.Run("all valid", func(t *testing.T) {
+		ctx, err := idmap.NewIDMapContext()
+		if err != nil {
+			t.Fatalf("NewIDMapContext() failed: %v", err)
+		}
+		defer ctx.Close()
+
+		if err := ctx.AddDomainsAtomic(valid); err != nil {
+			t.Fatalf("AddDomainsAtomic() failed: %v", err)
+		}
+		if got, err := ctx.SIDToUnixID("S-1-5-21-1444444444-1555555555-1666666666-1001"); err != nil || got != 21002 {
+			t.Errorf("SIDToUnixID() = %d, %v, want 21002", got, err)
+		}
+	})
+}
+
+func TestMatchDomain(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext()
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	domains := []idmap.DomainConfig{
+		{
+			DomainName: "DOMAIN1",
+			DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+			IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+		},
+		{
+			DomainName: "DOMAIN2",
+			DomainSID:  "S-1-5-21-1111111111-2222222222-33333333",
+			IDRange:    idmap.IDRange{Min: 20001, Max: 30000},
+		},
+	}
+	for _, d := range domains {
+		if err := ctx.AddDomain(d); err != nil {
+			t.Fatalf("AddDomain(%s) failed: %v", d.DomainName, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		sid       string
+		wantMatch bool
+		wantName  string
+	}{
+		{name: "first domain", sid: "S-1-5-21-1111111111-2222222222-3333333333-1001", wantMatch: true, wantName: "DOMAIN1"},
+		{name: "near-miss shorter sub-authority", sid: "S-1-5-21-1111111111-2222222222-33333333-1001", wantMatch: true, wantName: "DOMAIN2"},
+		{name: "near-miss longer sub-authority", sid: "S-1-5-21-1111111111-2222222222-333333333-1001", wantMatch: false},
+		{name: "domain SID without RID", sid: "S-1-5-21-1111111111-2222222222-3333333333", wantMatch: false},
+		{name: "unrelated domain", sid: "S-1-5-21-4444444444-5555555555-6666666666-1001", wantMatch: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ctx.MatchDomain(tt.sid)
+			if ok != tt.wantMatch {
+				t.Fatalf("MatchDomain(%q) matched = %v, want %v", tt.sid, ok, tt.wantMatch)
+			}
+			if ok && got.DomainName != tt.wantName {
+				t.Errorf("MatchDomain(%q) = %s, want %s", tt.sid, got.DomainName, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestWithWellKnownMapping(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, idmap.WithWellKnownMapping(map[string]uint32{"S-1-5-32-544": 544}))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	got, err := ctx.SIDToUnixID("S-1-5-32-544")
+	if err != nil || got != 544 {
+		t.Errorf("SIDToUnixID(Administrators) = %d, %v, want 544", got, err)
+	}
+
+	// objectSid of BUILTIN\Administrators
+	bin, _ := hex.DecodeString("01020000000000052000000020020000")
+	got, err = ctx.BinSIDToUnixID(bin)
+	if err != nil || got != 544 {
+		t.Errorf("BinSIDToUnixID(Administrators) = %d, %v, want 544", got, err)
+	}
+
+	if _, err := ctx.SIDToUnixID("S-1-5-32-545"); err == nil {
+		t.Error("SIDToUnixID(Users) succeeded, want the unmapped BUILTIN SID to fail as before")
+	}
+
+	got, err = ctx.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013")
+	if err != nil || got != 11013 {
+		t.Errorf("SIDToUnixID() for a domain SID = %d, %v, want 11013", got, err)
+	}
+}
+
+func TestWithRelaxedRangeValidation(t *testing.T) {
+	requireLibrary(t)
+
+	special := idmap.DomainConfig{
+		DomainName: "SPECIAL",
+		DomainSID:  "S-1-5-21-1-2-3",
+		IDRange:    idmap.IDRange{Min: 50000, Max: 50000},
+	}
+
+	if _, err := idmap.NewIDMapContextWithDomain(special); !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Errorf("NewIDMapContextWithDomain() with min == max = %v, want ErrInvalidRange by default", err)
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(special, idmap.WithRelaxedRangeValidation())
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() with relaxed validation failed: %v", err)
+	}
+	defer ctx.Close()
+
+	got, err := ctx.SIDToUnixID("S-1-5-21-1-2-3-0")
+	if err != nil || got != 50000 {
+		t.Errorf("SIDToUnixID() = %d, %v, want 50000", got, err)
+	}
+
+	// The C library still rejects an inverted range
+	err = ctx.AddDomain(idmap.DomainConfig{
+		DomainName: "INVERTED",
+		DomainSID:  "S-1-5-21-4-5-6",
+		IDRange:    idmap.IDRange{Min: 60000, Max: 59999},
+	})
+	if err == nil {
+		t.Error("AddDomain() with min > max succeeded, want the library to reject it")
+	}
+}
+
+func TestWithUnmappedSIDCollector(t *testing.T) {
+	requireLibrary(t)
+
+	var (
+		mu       sync.Mutex
+		unmapped []string
+	)
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, idmap.WithUnmappedSIDCollector(func(sid string) {
+		mu.Lock()
+		defer mu.Unlock()
+		unmapped = append(unmapped, sid)
+	}))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	input := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-1111111111-2222222222-3333333333-1013",
+		"not-a-sid",
+		"S-1-5-21-1444444444-1555555555-1666666666-500",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+	}
+	sids := make(chan string, len(input))
+	for _, sid := range input {
+		sids <- sid
+	}
+	close(sids)
+	for range idmap.ConvertStream(context.Background(), ctx, sids) {
+	}
+
+	// objectSid of S-1-5-21-1111111111-2222222222-3333333333-1001
+	bin, _ := hex.DecodeString("010500000000000515000000c7353a428e6b748455a1aec6e9030000")
+	ctx.BinSIDToUnixID(bin)
+
+	slices.Sort(unmapped)
+	want := []string{
+		"S-1-5-21-1111111111-2222222222-3333333333-1001",
+		"S-1-5-21-1111111111-2222222222-3333333333-1013",
+		"S-1-5-21-1444444444-1555555555-1666666666-500",
+	}
+	if !slices.Equal(unmapped, want) {
+		t.Errorf("collected %v, want %v", unmapped, want)
+	}
+}
+
+func TestWithSIDAnnotationStripping(t *testing.T) {
+	requireLibrary(t)
+
+	const annotated = "S-1-5-21-3623811015-3361044348-30300820-1013#jsmith"
+
+	strict := newExampleContext(t)
+	if _, err := strict.SIDToUnixID(annotated); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("SIDToUnixID(%q) without stripping = %v, want ErrInvalidSID", annotated, err)
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, idmap.WithSIDAnnotationStripping())
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	for _, sid := range []string{
+		annotated,
+		"S-1-5-21-3623811015-3361044348-30300820-1013 (John Smith)",
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+	} {
+		got, err := ctx.SIDToUnixID(sid)
+		if err != nil || got != 11013 {
+			t.Errorf("SIDToUnixID(%q) = %d, %v, want 11013", sid, got, err)
+		}
+	}
+}
+
+func TestWithPercentDecoding(t *testing.T) {
+	requireLibrary(t)
+
+	// As taken from a query string such as ?sid=S%2D1%2D5...
+	const encoded = "S%2D1%2D5%2D21%2D3623811015%2D3361044348%2D30300820%2D1013"
+
+	strict := newExampleContext(t)
+	if _, err := strict.SIDToUnixID(encoded); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("SIDToUnixID(%q) without decoding = %v, want ErrInvalidSID", encoded, err)
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, idmap.WithPercentDecoding())
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	for _, sid := range []string{encoded, "S-1-5-21-3623811015-3361044348-30300820-1013"} {
+		got, err := ctx.SIDToUnixID(sid)
+		if err != nil || got != 11013 {
+			t.Errorf("SIDToUnixID(%q) = %d, %v, want 11013", sid, got, err)
+		}
+	}
+
+	if _, err := ctx.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013%zz"); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("SIDToUnixID() with a bad escape = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestWithPanicRecovery(t *testing.T) {
+	requireLibrary(t)
+
+	const unknown = "S-1-5-21-1111111111-2222222222-3333333333-1001"
+	panicky := idmap.WithUnmappedSIDCollector(func(string) { panic("collector bug") })
+
+	ctx, err := idmap.NewIDMapContext(panicky, idmap.WithPanicRecovery())
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	if _, err := ctx.SIDToUnixID(unknown); !errors.Is(err, idmap.ErrInternal) {
+		t.Errorf("SIDToUnixID() after a panic = %v, want ErrInternal", err)
+	}
+	blob, _ := hex.DecodeString("010500000000000515000000c7353a428e6b748455a1aec6e9030000")
+	if _, err := ctx.BinSIDToUnixID(blob); !errors.Is(err, idmap.ErrInternal) {
+		t.Errorf("BinSIDToUnixID() after a panic = %v, want ErrInternal", err)
+	}
+
+	// The context stays usable once the panic is recovered
+	if err := ctx.AddDomain(idmap.DomainConfig{
+		DomainName: "CONTOSO",
+		DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:    idmap.IDRange{Min: 100000, Max: 200000},
+	}); err != nil {
+		t.Fatalf("AddDomain() failed: %v", err)
+	}
+	if got, err := ctx.SIDToUnixID(unknown); err != nil || got != 101001 {
+		t.Errorf("SIDToUnixID(%q) = %d, %v, want 101001", unknown, got, err)
+	}
+}
+
+func TestWithPanicRecovery_Disabled(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext(idmap.WithUnmappedSIDCollector(func(string) { panic("collector bug") }))
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("SIDToUnixID() did not panic without WithPanicRecovery")
+		}
+	}()
+	ctx.SIDToUnixID("S-1-5-21-1111111111-2222222222-3333333333-1001")
+}
+
+func TestWithFallbackID(t *testing.T) {
+	requireLibrary(t)
+
+	const nobody = 65534
+
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+
+	ctx, err := idmap.NewIDMapContextWithDomain(config, idmap.WithFallbackID(nobody))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	tests := []struct {
+		name       string
+		sid        string
+		wantUnixID uint32
+	}{
+		{name: "mapped SID unaffected", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", wantUnixID: 11013},
+		{name: "unmapped SID gets fallback", sid: "S-1-5-21-1111111111-2222222222-3333333333-1001", wantUnixID: nobody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ctx.SIDToUnixID(tt.sid)
+			if err != nil {
+				t.Fatalf("SIDToUnixID(%q) failed: %v", tt.sid, err)
+			}
+			if got != tt.wantUnixID {
+				t.Errorf("SIDToUnixID(%q) = %d, want %d", tt.sid, got, tt.wantUnixID)
+			}
+		})
+	}
+
+	// Invalid SIDs still fail
+	if _, err := ctx.SIDToUnixID("not-a-sid"); err == nil {
+		t.Error("SIDToUnixID(\"not-a-sid\") expected error, got nil")
+	}
+}
+
+func TestWithFallbackID_Disabled(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	if _, err := ctx.SIDToUnixID("S-1-5-21-1111111111-2222222222-3333333333-1001"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("SIDToUnixID() = %v, want ErrNotFound without WithFallbackID", err)
+	}
+}
+
+func TestSIDToUnixIDByDomainName(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	got, err := ctx.SIDToUnixIDByDomainName("EXAMPLE", "S-1-5-21-3623811015-3361044348-30300820-1013")
+	if err != nil {
+		t.Fatalf("SIDToUnixIDByDomainName() failed: %v", err)
+	}
+	if got != 11013 {
+		t.Errorf("SIDToUnixIDByDomainName() = %d, want 11013", got)
+	}
+
+	tests := []struct {
+		name       string
+		domainName string
+		sid        string
+	}{
+		{name: "unknown domain name", domainName: "OTHER", sid: "S-1-5-21-3623811015-3361044348-30300820-1013"},
+		{name: "SID from another domain", domainName: "EXAMPLE", sid: "S-1-5-21-1111111111-2222222222-3333333333-1013"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ctx.SIDToUnixIDByDomainName(tt.domainName, tt.sid); !errors.Is(err, idmap.ErrNotFound) {
+				t.Errorf("SIDToUnixIDByDomainName() = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestNewIDMapContextFromAccountSID(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContextFromAccountSID("EXAMPLE", "S-1-5-21-3623811015-3361044348-30300820-500", idmap.IDRange{Min: 10000, Max: 20000})
+	if err != nil {
+		t.Fatalf("NewIDMapContextFromAccountSID() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	domain, ok := ctx.MatchDomain("S-1-5-21-3623811015-3361044348-30300820-1013")
+	if !ok || domain.DomainSID != "S-1-5-21-3623811015-3361044348-30300820" {
+		t.Errorf("MatchDomain() = %+v, %v, want the discovered EXAMPLE domain", domain, ok)
+	}
+
+	got, err := ctx.SIDToUnixIDByDomainName("EXAMPLE", "S-1-5-21-3623811015-3361044348-30300820-1013")
+	if err != nil {
+		t.Fatalf("SIDToUnixIDByDomainName() failed: %v", err)
+	}
+	if got != 11013 {
+		t.Errorf("SIDToUnixIDByDomainName() = %d, want 11013", got)
+	}
+
+	if _, err := idmap.NewIDMapContextFromAccountSID("EXAMPLE", "S-1-5", idmap.IDRange{Min: 10000, Max: 20000}); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("NewIDMapContextFromAccountSID() = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestIDMapContext_Reset(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	if err := ctx.Reset(); err != nil {
+		t.Fatalf("Reset() failed: %v", err)
+	}
+
+	if _, err := ctx.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("SIDToUnixID() after Reset() = %v, want ErrNotFound", err)
+	}
+	if _, ok := ctx.MatchDomain("S-1-5-21-3623811015-3361044348-30300820-1013"); ok {
+		t.Error("MatchDomain() after Reset() found a domain, want none")
+	}
+}
+
+func TestIDMapContext_ScopeToDomain(t *testing.T) {
+	requireLibrary(t)
+
+	const (
+		exampleUser = "S-1-5-21-3623811015-3361044348-30300820-1013"
+		otherUser   = "S-1-5-21-1111111111-2222222222-3333333333-1013"
+	)
+
+	parent, err := idmap.NewIDMapContext(idmap.WithSIDAnnotationStripping())
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer parent.Close()
+	if err := parent.AddDomainsAtomic([]idmap.DomainConfig{
+		{DomainName: "EXAMPLE", DomainSID: "S-1-5-21-3623811015-3361044348-30300820", IDRange: idmap.IDRange{Min: 10000, Max: 20000}},
+		{DomainName: "OTHER", DomainSID: "S-1-5-21-1111111111-2222222222-3333333333", IDRange: idmap.IDRange{Min: 30000, Max: 40000}},
+	}); err != nil {
+		t.Fatalf("AddDomainsAtomic() failed: %v", err)
+	}
+
+	scoped, err := parent.ScopeToDomain("S-1-5-21-1111111111-2222222222-3333333333")
+	if err != nil {
+		t.Fatalf("ScopeToDomain() failed: %v", err)
+	}
+
+	// The parent's annotation stripping carries over
+	if got, err := scoped.SIDToUnixID(otherUser + "#jsmith"); err != nil || got != 31013 {
+		t.Errorf("scoped SIDToUnixID(%q) = %d, %v, want 31013", otherUser, got, err)
+	}
+	if _, err := scoped.SIDToUnixID(exampleUser); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("scoped SIDToUnixID(%q) = %v, want ErrNotFound", exampleUser, err)
+	}
+	if domains, err := scoped.ListDomains(); err != nil || len(domains) != 1 {
+		t.Errorf("scoped ListDomains() = %v, %v, want only OTHER", domains, err)
+	}
+
+	if err := scoped.Close(); err != nil {
+		t.Fatalf("scoped Close() failed: %v", err)
+	}
+	for sid, want := range map[string]uint32{exampleUser: 11013, otherUser: 31013} {
+		if got, err := parent.SIDToUnixID(sid); err != nil || got != want {
+			t.Errorf("parent SIDToUnixID(%q) after closing the scoped context = %d, %v, want %d", sid, got, err, want)
+		}
+	}
+
+	if _, err := parent.ScopeToDomain("S-1-5-21-1234567890-1234567890-1234567890"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("ScopeToDomain() for an unknown domain = %v, want ErrNotFound", err)
+	}
+}
+
+func TestAutoDomain_ExtraSlicesSurvive(t *testing.T) {
+	requireLibrary(t)
+
+	const (
+		domainSID = "S-1-5-21-3623811015-3361044348-30300820"
+		highRID   = domainSID + "-250013"
+	)
+
+	parent, err := idmap.NewIDMapContext(idmap.WithExtraSliceInit(1))
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer parent.Close()
+	if err := parent.AddAutoDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  domainSID,
+		IDRange:    idmap.IDRange{Min: 200000, Max: 399999},
+	}); err != nil {
+		t.Fatalf("AddAutoDomain() failed: %v", err)
+	}
+
+	want, err := parent.SIDToUnixID(highRID)
+	if err != nil {
+		t.Fatalf("SIDToUnixID(%q) failed: %v", highRID, err)
+	}
+
+	scoped, err := parent.ScopeToDomain(domainSID)
+	if err != nil {
+		t.Fatalf("ScopeToDomain() failed: %v", err)
+	}
+	defer scoped.Close()
+	if got, err := scoped.SIDToUnixID(highRID); err != nil || got != want {
+		t.Errorf("scoped SIDToUnixID(%q) = %d, %v, want %d", highRID, got, err, want)
+	}
+
+	domains, err := parent.ListDomains()
+	if err != nil {
+		t.Fatalf("ListDomains() failed: %v", err)
+	}
+	if len(domains) != 1 || !domains[0].AutoSlices {
+		t.Fatalf("ListDomains() = %+v, want one domain with AutoSlices", domains)
+	}
+	if err := parent.Reconfigure(domains); err != nil {
+		t.Fatalf("Reconfigure() failed: %v", err)
+	}
+	if got, err := parent.SIDToUnixID(highRID); err != nil || got != want {
+		t.Errorf("SIDToUnixID(%q) after Reconfigure = %d, %v, want %d", highRID, got, err, want)
+	}
+}
+
+func TestIDMapContext_Reconfigure(t *testing.T) {
+	requireLibrary(t)
+
+	const sid = "S-1-5-21-3623811015-3361044348-30300820-1013"
+
+	ctx := newExampleContext(t)
+
+	moved := idmap.DomainConfig{
 		DomainName: "EXAMPLE",
 		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
-		IDRange: idmap.IDRange{
-			Min: 10000,
-			Max: 20000,
-		},
+		IDRange:    idmap.IDRange{Min: 30000, Max: 40000},
+	}
+	if err := ctx.Reconfigure([]idmap.DomainConfig{moved}); err != nil {
+		t.Fatalf("Reconfigure() failed: %v", err)
+	}
+	if got, err := ctx.SIDToUnixID(sid); err != nil || got != 31013 {
+		t.Errorf("SIDToUnixID() = %d, %v, want 31013", got, err)
 	}
 
-	ctx, err := idmap.NewIDMapContextWithDomain(config)
-	if err != nil {
-		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	invalid := []idmap.DomainConfig{moved, {
+		DomainName: "OTHER",
+		DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:    idmap.IDRange{Min: 35000, Max: 45000},
+	}}
+	if err := ctx.Reconfigure(invalid); !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Errorf("Reconfigure() with overlapping ranges = %v, want ErrInvalidRange", err)
 	}
-	defer ctx.Close()
+	if got, err := ctx.SIDToUnixID(sid); err != nil || got != 31013 {
+		t.Errorf("SIDToUnixID() after failed Reconfigure() = %d, %v, want the previous mapping 31013", got, err)
+	}
+}
 
-	if ctx == nil {
-		t.Fatal("NewIDMapContextWithDomain() returned nil context")
+func TestIDMapContext_ReconfigureConcurrent(t *testing.T) {
+	requireLibrary(t)
+
+	const sid = "S-1-5-21-3623811015-3361044348-30300820-1013"
+
+	ctx := newExampleContext(t)
+
+	configs := [][]idmap.DomainConfig{
+		{{DomainName: "EXAMPLE", DomainSID: "S-1-5-21-3623811015-3361044348-30300820", IDRange: idmap.IDRange{Min: 10000, Max: 20000}}},
+		{{DomainName: "EXAMPLE", DomainSID: "S-1-5-21-3623811015-3361044348-30300820", IDRange: idmap.IDRange{Min: 30000, Max: 40000}}},
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				got, err := ctx.SIDToUnixID(sid)
+				if err != nil || (got != 11013 && got != 31013) {
+					t.Errorf("SIDToUnixID() during reload = %d, %v, want 11013 or 31013", got, err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := range 200 {
+		if err := ctx.Reconfigure(configs[i%2]); err != nil {
+			t.Errorf("Reconfigure() failed: %v", err)
+			break
+		}
 	}
+	close(done)
+	wg.Wait()
 }
 
-func TestAddDomain(t *testing.T) {
-	ctx, err := idmap.NewIDMapContext()
+func TestDomainNameCaseInsensitive(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "Example",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	})
 	if err != nil {
-		t.Fatalf("NewIDMapContext() failed: %v", err)
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
 	}
 	defer ctx.Close()
 
-	config := idmap.DomainConfig{
-		DomainName: "TESTDOMAIN",
-		DomainSID:  "S-1-5-21-1234567890-1234567890-1234567890",
-		IDRange: idmap.IDRange{
-			Min: 10000,
-			Max: 20000,
-		},
+	for _, name := range []string{"example", "EXAMPLE", "Example"} {
+		algorithmic, err := ctx.DomainByNameHasAlgorithmicMapping(name)
+		if err != nil || !algorithmic {
+			t.Errorf("DomainByNameHasAlgorithmicMapping(%q) = %v, %v, want true", name, algorithmic, err)
+		}
+
+		got, err := ctx.SIDToUnixIDByDomainName(name, "S-1-5-21-3623811015-3361044348-30300820-1013")
+		if err != nil || got != 11013 {
+			t.Errorf("SIDToUnixIDByDomainName(%q) = %d, %v, want 11013", name, got, err)
+		}
 	}
 
-	err = ctx.AddDomain(config)
-	if err != nil {
-		t.Errorf("AddDomain() failed: %v", err)
+	domain, ok := ctx.MatchDomain("S-1-5-21-3623811015-3361044348-30300820-1013")
+	if !ok || domain.DomainName != "Example" {
+		t.Errorf("MatchDomain() = %+v, %v, want the original name %q", domain, ok, "Example")
+	}
+
+	err = ctx.AddDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:    idmap.IDRange{Min: 30000, Max: 40000},
+	})
+	if err == nil {
+		t.Error("AddDomain() with a name differing only in case succeeded, want error")
 	}
 }
 
-func TestAddDomain_InvalidRange(t *testing.T) {
+func TestSIDToOffset(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	for _, rid := range []uint32{0, 500, 513, 1013, 9999} {
+		sid := fmt.Sprintf("S-1-5-21-3623811015-3361044348-30300820-%d", rid)
+		got, err := ctx.SIDToOffset(sid)
+		if err != nil {
+			t.Fatalf("SIDToOffset(%q) failed: %v", sid, err)
+		}
+		if got != rid {
+			t.Errorf("SIDToOffset(%q) = %d, want the RID %d", sid, got, rid)
+		}
+	}
+
+	if _, err := ctx.SIDToOffset("S-1-5-21-1111111111-2222222222-3333333333-1013"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("SIDToOffset() for an unknown domain = %v, want ErrNotFound", err)
+	}
+	if _, err := ctx.SIDToOffset("not-a-sid"); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("SIDToOffset() for an invalid SID = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestMaxMappableRID(t *testing.T) {
+	requireLibrary(t)
+
 	ctx, err := idmap.NewIDMapContext()
 	if err != nil {
 		t.Fatalf("NewIDMapContext() failed: %v", err)
 	}
 	defer ctx.Close()
 
+	domains := []idmap.DomainConfig{
+		{DomainName: "EXAMPLE", DomainSID: "S-1-5-21-3623811015-3361044348-30300820", IDRange: idmap.IDRange{Min: 10000, Max: 20000}},
+		{DomainName: "CONTOSO", DomainSID: "S-1-5-21-1111111111-2222222222-3333333333", IDRange: idmap.IDRange{Min: 100000, Max: 200000}},
+	}
+	if err := ctx.AddDomainsAtomic(domains); err != nil {
+		t.Fatalf("AddDomainsAtomic() failed: %v", err)
+	}
+
+	for _, d := range domains {
+		got, err := ctx.MaxMappableRID(d.DomainSID)
+		if err != nil {
+			t.Fatalf("MaxMappableRID(%q) failed: %v", d.DomainSID, err)
+		}
+		if want := d.IDRange.Max - d.IDRange.Min; got != want {
+			t.Errorf("MaxMappableRID(%q) = %d, want %d", d.DomainSID, got, want)
+		}
+
+		if id, err := ctx.RIDToUnixID(d.DomainSID, got); err != nil || id != d.IDRange.Max {
+			t.Errorf("RIDToUnixID(%q, %d) = %d, %v, want %d", d.DomainSID, got, id, err, d.IDRange.Max)
+		}
+		if _, err := ctx.RIDToUnixID(d.DomainSID, got+1); err == nil {
+			t.Errorf("RIDToUnixID(%q, %d) succeeded past the maximum RID", d.DomainSID, got+1)
+		}
+	}
+
+	if _, err := ctx.MaxMappableRID("S-1-5-21-1234567890-1234567890-1234567890"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("MaxMappableRID() for an unknown domain = %v, want ErrNotFound", err)
+	}
+	if _, err := ctx.MaxMappableRID("not-a-sid"); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("MaxMappableRID() for an invalid SID = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestRIDForUnixID(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+	const domainSID = "S-1-5-21-3623811015-3361044348-30300820"
+
 	tests := []struct {
-		name   string
-		config idmap.DomainConfig
+		name      string
+		domainSID string
+		id        uint32
+		want      uint32
+		wantErr   error
 	}{
-		{
-			name: "min equals max",
-			config: idmap.DomainConfig{
-				DomainName: "INVALID1",
-				DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
-				IDRange:    idmap.IDRange{Min: 10000, Max: 10000},
-			},
-		},
-		{
-			name: "min greater than max",
-			config: idmap.DomainConfig{
-				DomainName: "INVALID2",
-				DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
-				IDRange:    idmap.IDRange{Min: 20000, Max: 10000},
-			},
-		},
+		{name: "range min", domainSID: domainSID, id: 10000, want: 0},
+		{name: "inside", domainSID: domainSID, id: 11013, want: 1013},
+		{name: "range max", domainSID: domainSID, id: 20000, want: 10000},
+		{name: "below range", domainSID: domainSID, id: 9999, wantErr: idmap.ErrNotFound},
+		{name: "above range", domainSID: domainSID, id: 20001, wantErr: idmap.ErrNotFound},
+		{name: "unknown domain", domainSID: "S-1-5-21-1234567890-1234567890-1234567890", id: 11013, wantErr: idmap.ErrNotFound},
+		{name: "invalid domain", domainSID: "not-a-sid", id: 11013, wantErr: idmap.ErrInvalidSID},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := ctx.AddDomain(tt.config)
-			if err == nil {
-				t.Error("AddDomain() expected error for invalid range, got nil")
+			got, err := ctx.RIDForUnixID(tt.domainSID, tt.id)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("RIDForUnixID() = %d, %v, want %v", got, err, tt.wantErr)
+				}
+				return
 			}
-			if !errors.Is(err, idmap.ErrInvalidRange) {
-				t.Errorf("AddDomain() expected ErrInvalidRange, got: %v", err)
+			if err != nil || got != tt.want {
+				t.Errorf("RIDForUnixID() = %d, %v, want %d", got, err, tt.want)
+			}
+
+			// The RID maps back to the same ID
+			if id, err := ctx.RIDToUnixID(tt.domainSID, got); err != nil || id != tt.id {
+				t.Errorf("RIDToUnixID(%d) = %d, %v, want %d", got, id, err, tt.id)
 			}
 		})
 	}
 }
 
-func TestSIDToUnixID_WithDomain(t *testing.T) {
-	config := idmap.DomainConfig{
-		DomainName: "EXAMPLE",
-		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
-		IDRange: idmap.IDRange{
-			Min: 10000,
-			Max: 20000,
-		},
-	}
+func TestListDomains(t *testing.T) {
+	requireLibrary(t)
 
-	ctx, err := idmap.NewIDMapContextWithDomain(config)
-	if err != nil {
-		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	ctx := newExampleContext(t)
+
+	other := idmap.DomainConfig{
+		DomainName: "OTHER",
+		DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:    idmap.IDRange{Min: 30000, Max: 40000},
+	}
+	if err := ctx.AddDomain(other); err != nil {
+		t.Fatalf("AddDomain() failed: %v", err)
 	}
-	defer ctx.Close()
 
-	// Test converting a SID from the configured domain
-	sid := "S-1-5-21-3623811015-3361044348-30300820-1013"
-	unixID, err := ctx.SIDToUnixID(sid)
+	domains, err := ctx.ListDomains()
 	if err != nil {
-		t.Fatalf("SIDToUnixID(%q) failed: %v", sid, err)
+		t.Fatalf("ListDomains() failed: %v", err)
+	}
+	if len(domains) != 2 || domains[1] != other {
+		t.Fatalf("ListDomains() = %+v, want EXAMPLE and OTHER", domains)
 	}
 
-	// Verify the ID is within the configured range
-	if unixID < config.IDRange.Min || unixID > config.IDRange.Max {
-		t.Errorf("SIDToUnixID(%q) = %d, want ID in range [%d, %d]",
-			sid, unixID, config.IDRange.Min, config.IDRange.Max)
+	// The C library agrees with the listed range boundaries
+	for _, d := range domains {
+		size := d.IDRange.Max - d.IDRange.Min
+		for rid, want := range map[uint32]uint32{0: d.IDRange.Min, size: d.IDRange.Max} {
+			got, err := ctx.RIDToUnixID(d.DomainSID, rid)
+			if err != nil || got != want {
+				t.Errorf("RIDToUnixID(%s, %d) = %d, %v, want %d", d.DomainName, rid, got, err, want)
+			}
+		}
 	}
 
-	t.Logf("SID %s mapped to Unix ID %d", sid, unixID)
+	// The returned slice is a copy
+	domains[0].DomainName = "CHANGED"
+	if again, _ := ctx.ListDomains(); again[0].DomainName != "EXAMPLE" {
+		t.Errorf("ListDomains() exposed internal state: %+v", again)
+	}
 }
 
 func TestIDMapContext_Close(t *testing.T) {
+	requireLibrary(t)
+
 	ctx, err := idmap.NewIDMapContext()
 	if err != nil {
 		t.Fatalf("NewIDMapContext() failed: %v", err)
@@ -160,6 +1721,8 @@ func TestIDMapContext_Close(t *testing.T) {
 }
 
 func TestIDMapContext_SIDToUnixID_InvalidSID(t *testing.T) {
+	requireLibrary(t)
+
 	tests := []struct {
 		name string
 		sid  string
@@ -199,6 +1762,8 @@ func TestIDMapContext_SIDToUnixID_InvalidSID(t *testing.T) {
 }
 
 func TestSIDToUnixID(t *testing.T) {
+	requireLibrary(t)
+
 	// Deterministic offline tests with known SID to UID/GID mappings
 	// These test cases verify that the same SID always maps to the same Unix ID
 
@@ -317,6 +1882,158 @@ func TestSIDToUnixID(t *testing.T) {
 	}
 }
 
+func TestIDMapContext_BinSIDToUnixID_Truncated(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	const valid = "010500000000000515000000c7f7fed77c7755c8945ace01f5030000"
+	full, _ := hex.DecodeString(valid)
+
+	if got, err := ctx.BinSIDToUnixID(full); err != nil || got != 11013 {
+		t.Fatalf("BinSIDToUnixID() = %d, %v, want 11013", got, err)
+	}
+
+	tests := []struct {
+		name string
+		sid  []byte
+	}{
+		{name: "empty", sid: nil},
+		{name: "partial header", sid: full[:5]},
+		{name: "header only", sid: full[:8]},
+		{name: "last sub-authority cut short", sid: full[:len(full)-1]},
+		{name: "missing last sub-authority", sid: full[:len(full)-4]},
+		{name: "trailing bytes", sid: append(append([]byte{}, full...), 0)},
+		{name: "too many sub-authorities", sid: append([]byte{0x01, 0x10}, full[2:]...)},
+		{name: "revision 0", sid: append([]byte{0x00}, full[1:]...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ctx.BinSIDToUnixID(tt.sid); !errors.Is(err, idmap.ErrInvalidSID) {
+				t.Errorf("BinSIDToUnixID(%x) = %v, want ErrInvalidSID", tt.sid, err)
+			}
+			if _, err := idmap.DecodeSID(tt.sid); !errors.Is(err, idmap.ErrInvalidSID) {
+				t.Errorf("DecodeSID(%x) = %v, want ErrInvalidSID", tt.sid, err)
+			}
+		})
+	}
+}
+
+func TestMapSIDWithRange(t *testing.T) {
+	requireLibrary(t)
+
+	const domainSID = "S-1-5-21-3623811015-3361044348-30300820"
+
+	ctx := newExampleContext(t)
+
+	for _, sid := range []string{
+		domainSID + "-500",
+		domainSID + "-513",
+		domainSID + "-1013",
+	} {
+		want, err := ctx.SIDToUnixID(sid)
+		if err != nil {
+			t.Fatalf("SIDToUnixID(%q) failed: %v", sid, err)
+		}
+
+		got, err := idmap.MapSIDWithRange(sid, domainSID, idmap.IDRange{Min: 10000, Max: 20000})
+		if err != nil {
+			t.Fatalf("MapSIDWithRange(%q) failed: %v", sid, err)
+		}
+		if got != want {
+			t.Errorf("MapSIDWithRange(%q) = %d, want %d as from the stateful context", sid, got, want)
+		}
+	}
+
+	got, err := idmap.MapSIDWithRange(domainSID+"-1013", domainSID, idmap.IDRange{Min: 500000, Max: 699999})
+	if err != nil || got != 501013 {
+		t.Errorf("MapSIDWithRange() with an ad-hoc range = %d, %v, want 501013", got, err)
+	}
+
+	if _, err := idmap.MapSIDWithRange(domainSID+"-1013", domainSID, idmap.IDRange{Min: 20000, Max: 10000}); !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Errorf("MapSIDWithRange() with an inverted range = %v, want ErrInvalidRange", err)
+	}
+	if _, err := idmap.MapSIDWithRange("S-1-5-21-1111111111-2222222222-3333333333-1013", domainSID, idmap.IDRange{Min: 10000, Max: 20000}); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("MapSIDWithRange() for a SID outside the domain = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCheckSIDUnix(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	tests := []struct {
+		name    string
+		sid     string
+		id      uint32
+		wantErr error
+	}{
+		{name: "in range", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", id: 11013},
+		{name: "other ID in range", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", id: 15000},
+		{name: "outside range", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", id: 500, wantErr: idmap.ErrInvalidRange},
+		{name: "unknown domain", sid: "S-1-5-21-1111111111-2222222222-3333333333-1013", id: 11013, wantErr: idmap.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ctx.CheckSIDUnix(tt.sid, tt.id)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("CheckSIDUnix(%q, %d) unexpected error: %v", tt.sid, tt.id, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckSIDUnix(%q, %d) = %v, want %v", tt.sid, tt.id, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterMappable(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, idmap.WithFallbackID(65534))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	sids := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-1111111111-2222222222-3333333333-1013",
+		"not-a-sid",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+		"S-1-5-32-544",
+		"S-1-5-21-3623811015-3361044348-30300820-513",
+	}
+
+	mappable, skipped := ctx.FilterMappable(sids)
+
+	wantMappable := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+		"S-1-5-21-3623811015-3361044348-30300820-513",
+	}
+	wantSkipped := []string{
+		"S-1-5-21-1111111111-2222222222-3333333333-1013",
+		"not-a-sid",
+		"S-1-5-32-544",
+	}
+	if !slices.Equal(mappable, wantMappable) {
+		t.Errorf("FilterMappable() mappable = %v, want %v", mappable, wantMappable)
+	}
+	if !slices.Equal(skipped, wantSkipped) {
+		t.Errorf("FilterMappable() skipped = %v, want %v", skipped, wantSkipped)
+	}
+}
+
 func TestDecodeSID(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -402,3 +2119,105 @@ func TestDecodeSID(t *testing.T) {
 		})
 	}
 }
+
+func TestDecodeSIDWithOrder(t *testing.T) {
+	const want = "S-1-5-21-3623811015-3361044348-30300820-1013"
+
+	tests := []struct {
+		name   string
+		hexSID string
+		order  idmap.SubAuthOrder
+	}{
+		{name: "little-endian", hexSID: "010500000000000515000000c7f7fed77c7755c8945ace01f5030000", order: idmap.SubAuthLittleEndian},
+		{name: "big-endian", hexSID: "010500000000000500000015d7fef7c7c855777c01ce5a94000003f5", order: idmap.SubAuthBigEndian},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sidBytes, _ := hex.DecodeString(tt.hexSID)
+			got, err := idmap.DecodeSIDWithOrder(sidBytes, tt.order)
+			if err != nil {
+				t.Fatalf("DecodeSIDWithOrder() unexpected error: %v", err)
+			}
+			if got != want {
+				t.Errorf("DecodeSIDWithOrder() = %q, want %q", got, want)
+			}
+		})
+	}
+
+	// The default order matches DecodeSID
+	sidBytes, _ := hex.DecodeString(tests[0].hexSID)
+	if got, _ := idmap.DecodeSID(sidBytes); got != want {
+		t.Errorf("DecodeSID() = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeSID_StrictRevision(t *testing.T) {
+	// EXAMPLE user 1013 with the revision byte changed to 2
+	revision2, _ := hex.DecodeString("020500000000000515000000c7f7fed77c7755c8945ace01f5030000")
+	revision1, _ := hex.DecodeString("010500000000000515000000c7f7fed77c7755c8945ace01f5030000")
+
+	if got, err := idmap.DecodeSID(revision2); err != nil || got != "S-2-5-21-3623811015-3361044348-30300820-1013" {
+		t.Errorf("DecodeSID() without strict revision = %q, %v, want the revision 2 SID", got, err)
+	}
+
+	_, err := idmap.DecodeSID(revision2, idmap.WithStrictRevision())
+	if !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Fatalf("DecodeSID() with strict revision = %v, want ErrInvalidSID", err)
+	}
+	if !strings.Contains(err.Error(), "revision 2") {
+		t.Errorf("DecodeSID() error %q does not include the observed revision", err)
+	}
+
+	if got, err := idmap.DecodeSID(revision1, idmap.WithStrictRevision()); err != nil || got != "S-1-5-21-3623811015-3361044348-30300820-1013" {
+		t.Errorf("DecodeSID() with strict revision = %q, %v, want the revision 1 SID", got, err)
+	}
+}
+
+func TestDecodeSID_HexAuthority(t *testing.T) {
+	tests := []struct {
+		name        string
+		hexSID      string
+		wantDecimal string
+		wantHex     string
+	}{
+		{
+			name:        "large authority",
+			hexSID:      "010101000000000001000000",
+			wantDecimal: "S-1-1099511627776-1",
+			wantHex:     "S-1-0x010000000000-1",
+		},
+		{
+			name:        "authority 2^32",
+			hexSID:      "0101000100000000e8030000",
+			wantDecimal: "S-1-4294967296-1000",
+			wantHex:     "S-1-0x000100000000-1000",
+		},
+		{
+			name:        "small authority",
+			hexSID:      "010500000000000515000000c7f7fed77c7755c8945ace01f5030000",
+			wantDecimal: "S-1-5-21-3623811015-3361044348-30300820-1013",
+			wantHex:     "S-1-5-21-3623811015-3361044348-30300820-1013",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob, _ := hex.DecodeString(tt.hexSID)
+
+			if got, err := idmap.DecodeSID(blob); err != nil || got != tt.wantDecimal {
+				t.Errorf("DecodeSID() = %q, %v, want %q", got, err, tt.wantDecimal)
+			}
+
+			got, err := idmap.DecodeSID(blob, idmap.WithHexAuthority())
+			if err != nil || got != tt.wantHex {
+				t.Fatalf("DecodeSID() with hex authority = %q, %v, want %q", got, err, tt.wantHex)
+			}
+
+			// The hex form is still a valid SID that encodes back to the same bytes
+			if encoded, err := idmap.EncodeSID(got); err != nil || !bytes.Equal(encoded, blob) {
+				t.Errorf("EncodeSID(%q) = %x, %v, want %x", got, encoded, err, blob)
+			}
+		})
+	}
+}
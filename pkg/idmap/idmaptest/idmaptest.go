@@ -0,0 +1,64 @@
+// Package idmaptest provides a deterministic idmap.IDMapper for tests of code that
+// consumes the idmap package
+// It is NOT for production use: its formula ignores SSSD's slicing and autorid, so the
+// IDs it returns only agree with libsss_idmap for RIDs within the first slice
+// FakeIDMap itself never calls libsss_idmap, so on hosts without the library, tests that
+// use it run by building with -tags nosssidmap
+package idmaptest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// FakeIDMap maps an account SID of a configured domain to range_min + rid in pure Go
+// RIDs that would land beyond range_max fail with idmap.ErrNotFound
+type FakeIDMap struct {
+	domains []idmap.DomainConfig
+}
+
+var _ idmap.IDMapper = (*FakeIDMap)(nil)
+
+// NewFakeIDMap returns a FakeIDMap for domains
+func NewFakeIDMap(domains ...idmap.DomainConfig) *FakeIDMap {
+	return &FakeIDMap{domains: append([]idmap.DomainConfig(nil), domains...)}
+}
+
+// SIDToUnixID maps sid with the range_min + rid formula
+func (m *FakeIDMap) SIDToUnixID(sid string) (uint32, error) {
+	domainSID, err := idmap.DomainSIDOf(sid)
+	if err != nil {
+		return 0, err
+	}
+
+	rid, err := strconv.ParseUint(sid[len(domainSID)+1:], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", idmap.ErrInvalidSID, sid)
+	}
+
+	for _, d := range m.domains {
+		if !strings.EqualFold(d.DomainSID, domainSID) {
+			continue
+		}
+		id := uint64(d.IDRange.Min) + rid
+		if id > uint64(d.IDRange.Max) {
+			return 0, fmt.Errorf("%w: %s maps to %d, beyond the range maximum %d", idmap.ErrNotFound, sid, id, d.IDRange.Max)
+		}
+		return uint32(id), nil
+	}
+
+	return 0, fmt.Errorf("%w: %s", idmap.ErrNotFound, sid)
+}
+
+// BinSIDToUnixID decodes a binary SID and maps it with the range_min + rid formula
+func (m *FakeIDMap) BinSIDToUnixID(sid []byte) (uint32, error) {
+	strSID, err := idmap.DecodeSID(sid)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.SIDToUnixID(strSID)
+}
@@ -0,0 +1,98 @@
+package idmaptest_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap/idmaptest"
+)
+
+var (
+	example = idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+	contoso = idmap.DomainConfig{
+		DomainName: "CONTOSO",
+		DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:    idmap.IDRange{Min: 100000, Max: 200000},
+	}
+)
+
+func TestFakeIDMap(t *testing.T) {
+	m := idmaptest.NewFakeIDMap(example, contoso)
+
+	tests := []struct {
+		name    string
+		sid     string
+		want    uint32
+		wantErr error
+	}{
+		{name: "EXAMPLE user", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", want: 10000 + 1013},
+		{name: "EXAMPLE top of range", sid: "S-1-5-21-3623811015-3361044348-30300820-10000", want: 20000},
+		{name: "EXAMPLE beyond range", sid: "S-1-5-21-3623811015-3361044348-30300820-10001", wantErr: idmap.ErrNotFound},
+		{name: "CONTOSO administrator", sid: "S-1-5-21-1111111111-2222222222-3333333333-500", want: 100000 + 500},
+		{name: "unknown domain", sid: "S-1-5-21-1234567890-1234567890-1234567890-500", wantErr: idmap.ErrNotFound},
+		{name: "invalid", sid: "not-a-sid", wantErr: idmap.ErrInvalidSID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.SIDToUnixID(tt.sid)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("SIDToUnixID(%q) = %d, %v, want %v", tt.sid, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SIDToUnixID(%q) failed: %v", tt.sid, err)
+			}
+			if got != tt.want {
+				t.Errorf("SIDToUnixID(%q) = %d, want %d", tt.sid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFakeIDMap_BinSIDToUnixID(t *testing.T) {
+	m := idmaptest.NewFakeIDMap(contoso)
+
+	// S-1-5-21-1111111111-2222222222-3333333333-1001
+	blob, _ := hex.DecodeString("010500000000000515000000c7353a428e6b748455a1aec6e9030000")
+	if got, err := m.BinSIDToUnixID(blob); err != nil || got != 101001 {
+		t.Errorf("BinSIDToUnixID() = %d, %v, want 101001", got, err)
+	}
+	if _, err := m.BinSIDToUnixID(blob[:12]); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("BinSIDToUnixID() for a truncated SID = %v, want ErrInvalidSID", err)
+	}
+}
+
+func TestFakeIDMap_MatchesFirstSlice(t *testing.T) {
+	ctx, err := idmap.NewIDMapContextWithDomain(example)
+	if errors.Is(err, idmap.ErrLibraryUnavailable) {
+		t.Skip("cross-check needs libsss_idmap")
+	}
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	m := idmaptest.NewFakeIDMap(example)
+	for _, sid := range []string{
+		"S-1-5-21-3623811015-3361044348-30300820-0",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+	} {
+		want, err := ctx.SIDToUnixID(sid)
+		if err != nil {
+			t.Fatalf("IDMapContext.SIDToUnixID(%q) failed: %v", sid, err)
+		}
+		if got, err := m.SIDToUnixID(sid); err != nil || got != want {
+			t.Errorf("SIDToUnixID(%q) = %d, %v, want %d as libsss_idmap", sid, got, err, want)
+		}
+	}
+}
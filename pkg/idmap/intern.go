@@ -0,0 +1,86 @@
+package idmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// maxSIDStringLen is the length of the longest string SID: "S-255-0x" plus a 12-digit
+// authority, and 15 sub-authorities of up to 10 digits each with their dashes
+const maxSIDStringLen = 8 + 12 + maxSubAuthorities*11
+
+// maxInternedPrefixes bounds the prefix pool of a sidInterner, so that input spanning
+// many distinct domains cannot grow it without limit
+const maxInternedPrefixes = 1024
+
+// appendSID appends the string form of a binary SID that passed checkBinSID to dst,
+// including only its first n sub-authorities
+func appendSID(dst []byte, sid []byte, n int, order SubAuthOrder, o sidOptions) []byte {
+	// Revision level
+	dst = append(dst, "S-"...)
+	dst = strconv.AppendUint(dst, uint64(sid[0]), 10)
+
+	// Process 48-bit authority (Big-Endian)
+	var authority uint64
+	for i := 2; i <= 7; i++ {
+		authority |= uint64(sid[i]) << (8 * uint(5-(i-2)))
+	}
+	dst = append(dst, '-')
+	if o.hexAuthority && authority >= 1<<32 {
+		dst = fmt.Appendf(dst, "0x%012X", authority)
+	} else {
+		dst = strconv.AppendUint(dst, authority, 10)
+	}
+
+	// Process sub-authorities
+	byteOrder := order.byteOrder()
+	offset := binSIDHeaderLen
+	for j := 0; j < n; j++ {
+		dst = append(dst, '-')
+		dst = strconv.AppendUint(dst, uint64(byteOrder.Uint32(sid[offset:offset+4])), 10)
+		offset += 4
+	}
+
+	return dst
+}
+
+// sidInterner decodes batches of binary SIDs, most of which share a handful of domain
+// prefixes: the string form of each prefix is built once and reused, so decoding a SID
+// of a known domain only formats its RID and allocates just the result
+type sidInterner struct {
+	prefixes map[string]string
+	buf      []byte
+}
+
+// newSIDInterner returns an interner with an empty prefix pool
+func newSIDInterner() *sidInterner {
+	return &sidInterner{prefixes: make(map[string]string)}
+}
+
+// decode is DecodeSID drawing on the prefix pool
+func (in *sidInterner) decode(sid []byte) (string, error) {
+	if err := checkBinSID(sid); err != nil {
+		return "", err
+	}
+
+	n := int(sid[1])
+	if n == 0 {
+		return DecodeSID(sid)
+	}
+
+	// The key is the header and every sub-authority but the RID
+	key := sid[:len(sid)-4]
+	prefix, ok := in.prefixes[string(key)]
+	if !ok {
+		prefix = string(appendSID(nil, sid, n-1, SubAuthLittleEndian, sidOptions{}))
+		if len(in.prefixes) < maxInternedPrefixes {
+			in.prefixes[string(key)] = prefix
+		}
+	}
+
+	in.buf = append(in.buf[:0], prefix...)
+	in.buf = append(in.buf, '-')
+	in.buf = strconv.AppendUint(in.buf, uint64(binary.LittleEndian.Uint32(sid[len(sid)-4:])), 10)
+	return string(in.buf), nil
+}
@@ -0,0 +1,75 @@
+package idmap_test
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// prefixHeavyBlobs returns n binary SIDs with distinct RIDs spread over a few domains
+func prefixHeavyBlobs(t testing.TB, n int) [][]byte {
+	t.Helper()
+
+	domains := []string{
+		"S-1-5-21-3623811015-3361044348-30300820",
+		"S-1-5-21-1111111111-2222222222-3333333333",
+		"S-1-5-21-1234567890-1234567890-1234567890",
+	}
+	blobs := make([][]byte, n)
+	for i := range blobs {
+		blob, err := idmap.EncodeSID(fmt.Sprintf("%s-%d", domains[i%len(domains)], 1000+i))
+		if err != nil {
+			t.Fatalf("EncodeSID() failed: %v", err)
+		}
+		blobs[i] = blob
+	}
+	return blobs
+}
+
+func TestDecodeSIDs_MatchesDecodeSID(t *testing.T) {
+	blobs := prefixHeavyBlobs(t, 300)
+	for _, h := range []string{
+		"010100000000000100000000",
+		"0100000000000005",
+		"010101000000000001000000",
+		"01020000000000052000000020020000",
+		"010500000000000515000000",
+	} {
+		blob, _ := hex.DecodeString(h)
+		blobs = append(blobs, blob)
+	}
+	// Distinct domains beyond the prefix pool's capacity
+	for i := range 2000 {
+		blob, _ := idmap.EncodeSID(fmt.Sprintf("S-1-5-21-%d-1-2-500", i))
+		blobs = append(blobs, blob)
+	}
+
+	for i, r := range idmap.DecodeSIDs(blobs) {
+		want, wantErr := idmap.DecodeSID(blobs[i])
+		if r.SID != want || (r.Err == nil) != (wantErr == nil) {
+			t.Errorf("DecodeSIDs()[%d] = %q, %v, want %q, %v", i, r.SID, r.Err, want, wantErr)
+		}
+	}
+}
+
+func BenchmarkDecodeSIDs_PrefixHeavy(b *testing.B) {
+	blobs := prefixHeavyBlobs(b, 10000)
+
+	b.Run("DecodeSID", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			for _, blob := range blobs {
+				_, _ = idmap.DecodeSID(blob)
+			}
+		}
+	})
+
+	b.Run("DecodeSIDs", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			idmap.DecodeSIDs(blobs)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package idmap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LDAPEntry is one entry of an LDAP search result, with attribute values as strings
+type LDAPEntry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// LDAPSearcher runs a subtree search and returns the matching entries with the requested
+// attributes; callers adapt their LDAP client (e.g. go-ldap's Conn.Search) to it, so this
+// package does not depend on one
+type LDAPSearcher interface {
+	Search(baseDN, filter string, attributes []string) ([]LDAPEntry, error)
+}
+
+const (
+	// ipaTrustedRangeFilter selects the ID ranges IPA creates for trusted AD domains
+	ipaTrustedRangeFilter = "(objectClass=ipaTrustedADDomainRange)"
+	// ipaRangeSuffix is appended to the trusted domain's name in the cn of its range
+	ipaRangeSuffix = "_id_range"
+)
+
+// ipaRangeAttributes are the attributes LoadDomainsFromIPARanges reads
+var ipaRangeAttributes = []string{"cn", "ipaNTTrustedDomainSID", "ipaBaseID", "ipaIDRangeSize"}
+
+// LoadDomainsFromIPARanges reads the ID ranges of the AD domains an IPA server trusts from
+// cn=ranges,cn=etc,baseDN, as SSSD does on IPA clients in an IPA-AD trust
+// Each range becomes a domain named after its cn without the "_id_range" suffix, covering
+// ipaIDRangeSize IDs from ipaBaseID
+// Every entry is validated and all failures are reported together, each naming its DN
+func LoadDomainsFromIPARanges(conn LDAPSearcher, baseDN string) ([]DomainConfig, error) {
+	entries, err := conn.Search("cn=ranges,cn=etc,"+baseDN, ipaTrustedRangeFilter, ipaRangeAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search IPA ranges: %w", err)
+	}
+
+	var (
+		configs []DomainConfig
+		errs    []error
+	)
+	for _, entry := range entries {
+		config, err := ipaRangeConfig(entry)
+		if err == nil {
+			err = validateDomainConfig(config, false)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.DN, err))
+			continue
+		}
+		configs = append(configs, config)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return configs, nil
+}
+
+// ipaRangeConfig builds the domain configuration of one ipaTrustedADDomainRange entry
+func ipaRangeConfig(entry LDAPEntry) (DomainConfig, error) {
+	base, err := strconv.ParseUint(entry.attribute("ipaBaseID"), 10, 32)
+	if err != nil {
+		return DomainConfig{}, fmt.Errorf("%w: invalid ipaBaseID %q", ErrInvalidRange, entry.attribute("ipaBaseID"))
+	}
+	size, err := strconv.ParseUint(entry.attribute("ipaIDRangeSize"), 10, 32)
+	if err != nil || size == 0 || base+size-1 > 1<<32-1 {
+		return DomainConfig{}, fmt.Errorf("%w: invalid ipaIDRangeSize %q", ErrInvalidRange, entry.attribute("ipaIDRangeSize"))
+	}
+
+	return DomainConfig{
+		DomainName: strings.TrimSuffix(entry.attribute("cn"), ipaRangeSuffix),
+		DomainSID:  entry.attribute("ipaNTTrustedDomainSID"),
+		IDRange:    IDRange{Min: uint32(base), Max: uint32(base + size - 1)},
+	}, nil
+}
+
+// attribute returns the first value of the named attribute, matched case-insensitively
+// as LDAP attribute names are, or "" if the entry lacks it
+func (e LDAPEntry) attribute(name string) string {
+	for attr, values := range e.Attributes {
+		if strings.EqualFold(attr, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
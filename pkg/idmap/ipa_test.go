@@ -0,0 +1,94 @@
+package idmap_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// fakeLDAP answers every search with fixed entries and records the last request
+type fakeLDAP struct {
+	entries    []idmap.LDAPEntry
+	err        error
+	baseDN     string
+	filter     string
+	attributes []string
+}
+
+func (f *fakeLDAP) Search(baseDN, filter string, attributes []string) ([]idmap.LDAPEntry, error) {
+	f.baseDN, f.filter, f.attributes = baseDN, filter, attributes
+	return f.entries, f.err
+}
+
+func ipaRange(cn, sid, base, size string) idmap.LDAPEntry {
+	return idmap.LDAPEntry{
+		DN: "cn=" + cn + ",cn=ranges,cn=etc,dc=ipa,dc=example,dc=com",
+		Attributes: map[string][]string{
+			"cn":                    {cn},
+			"ipaNTTrustedDomainSID": {sid},
+			"ipaBaseID":             {base},
+			"ipaIDRangeSize":        {size},
+		},
+	}
+}
+
+func TestLoadDomainsFromIPARanges(t *testing.T) {
+	conn := &fakeLDAP{entries: []idmap.LDAPEntry{
+		ipaRange("AD.EXAMPLE.COM_id_range", "S-1-5-21-3623811015-3361044348-30300820", "1868600000", "200000"),
+		ipaRange("OTHER.EXAMPLE.COM_id_range", "S-1-5-21-1111111111-2222222222-3333333333", "1868800000", "200000"),
+	}}
+
+	got, err := idmap.LoadDomainsFromIPARanges(conn, "dc=ipa,dc=example,dc=com")
+	if err != nil {
+		t.Fatalf("LoadDomainsFromIPARanges() failed: %v", err)
+	}
+
+	want := []idmap.DomainConfig{
+		{
+			DomainName: "AD.EXAMPLE.COM",
+			DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+			IDRange:    idmap.IDRange{Min: 1868600000, Max: 1868799999},
+		},
+		{
+			DomainName: "OTHER.EXAMPLE.COM",
+			DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+			IDRange:    idmap.IDRange{Min: 1868800000, Max: 1868999999},
+		},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("LoadDomainsFromIPARanges() = %+v, want %+v", got, want)
+	}
+
+	if conn.baseDN != "cn=ranges,cn=etc,dc=ipa,dc=example,dc=com" {
+		t.Errorf("search base = %q, want the cn=ranges container", conn.baseDN)
+	}
+	if !strings.Contains(conn.filter, "ipaTrustedADDomainRange") {
+		t.Errorf("search filter = %q, want it to select trusted AD ranges", conn.filter)
+	}
+}
+
+func TestLoadDomainsFromIPARanges_Errors(t *testing.T) {
+	conn := &fakeLDAP{entries: []idmap.LDAPEntry{
+		ipaRange("GOOD_id_range", "S-1-5-21-3623811015-3361044348-30300820", "1868600000", "200000"),
+		ipaRange("BADSID_id_range", "S-1-x", "1868800000", "200000"),
+		ipaRange("BADSIZE_id_range", "S-1-5-21-1111111111-2222222222-3333333333", "1869000000", "lots"),
+	}}
+
+	_, err := idmap.LoadDomainsFromIPARanges(conn, "dc=ipa,dc=example,dc=com")
+	if !errors.Is(err, idmap.ErrInvalidSID) || !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Fatalf("LoadDomainsFromIPARanges() = %v, want both ErrInvalidSID and ErrInvalidRange", err)
+	}
+	for _, dn := range []string{"cn=BADSID_id_range", "cn=BADSIZE_id_range"} {
+		if !strings.Contains(err.Error(), dn) {
+			t.Errorf("LoadDomainsFromIPARanges() error %q does not name %s", err, dn)
+		}
+	}
+
+	errSearch := errors.New("connection reset")
+	if _, err := idmap.LoadDomainsFromIPARanges(&fakeLDAP{err: errSearch}, "dc=ipa,dc=example,dc=com"); !errors.Is(err, errSearch) {
+		t.Errorf("LoadDomainsFromIPARanges() with a failing search = %v, want %v", err, errSearch)
+	}
+}
@@ -0,0 +1,94 @@
+package idmap
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Mapping is one domain a SID's Unix ID can be attributed to
+type Mapping struct {
+	SID        string
+	DomainName string
+	DomainSID  string
+	UnixID     uint32
+}
+
+// AllMappings returns every registered domain whose range the Unix ID of sid falls into,
+// to diagnose configurations where an ID is claimed by more than one domain
+// The first element is the mapping libsss_idmap actually uses and normally the only one;
+// domains with external mapping are exempt from the library's overlap check and may
+// share IDs with algorithmically mapped ones
+// SIDs resolved through WithWellKnownMapping or WithFallbackID yield a first element without domain
+func (c *IDMapContext) AllMappings(sid string) ([]Mapping, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	unixID, err := c.sidToUnixID(sid)
+	if err != nil {
+		return nil, err
+	}
+
+	primary := Mapping{SID: sid, UnixID: unixID}
+	if _, wellKnown := c.wellKnownIDs[sid]; !wellKnown {
+		if domain, ok := c.matchDomain(sid); ok {
+			primary.DomainName, primary.DomainSID = domain.DomainName, domain.DomainSID
+		}
+	}
+
+	mappings := []Mapping{primary}
+	for _, d := range c.domains {
+		if d.DomainSID == primary.DomainSID {
+			continue
+		}
+		if unixID >= d.IDRange.Min && unixID <= d.IDRange.Max {
+			mappings = append(mappings, Mapping{SID: sid, DomainName: d.DomainName, DomainSID: d.DomainSID, UnixID: unixID})
+		}
+	}
+
+	return mappings, nil
+}
+
+// reservedIDLimit is the first Unix ID above those distributions reserve for system
+// accounts and groups
+const reservedIDLimit = 1000
+
+// ReservedIDCollisions returns the SIDs of the registered domain domainSID that map to
+// reserved Unix IDs below 1000, as a range misconfigured to start low would hand root's or
+// a system group's ID to AD accounts
+// libsss_idmap maps RID r of a domain to its range minimum plus r, so the collisions are
+// the RIDs from 0 up to the last ID of the range below 1000; only a range starting below
+// 1000 has any
+// It returns ErrNotFound if the domain is unregistered or uses external mapping
+func (c *IDMapContext) ReservedIDCollisions(domainSID string) ([]Mapping, error) {
+	if err := ValidateSID(domainSID); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	i := slices.IndexFunc(c.domains, func(d DomainConfig) bool { return d.DomainSID == domainSID })
+	if i < 0 {
+		return nil, fmt.Errorf("%w: domain %s", ErrNotFound, domainSID)
+	}
+	domain := c.domains[i]
+	if domain.ExternalMapping {
+		return nil, fmt.Errorf("%w: domain %s uses external mapping", ErrNotFound, domain.DomainName)
+	}
+
+	if domain.IDRange.Min >= reservedIDLimit {
+		return nil, nil
+	}
+
+	last := min(domain.IDRange.Max, reservedIDLimit-1)
+	collisions := make([]Mapping, 0, last-domain.IDRange.Min+1)
+	for unixID := domain.IDRange.Min; unixID <= last; unixID++ {
+		sid, err := BuildSID(domainSID, unixID-domain.IDRange.Min)
+		if err != nil {
+			return nil, err
+		}
+		collisions = append(collisions, Mapping{SID: sid, DomainName: domain.DomainName, DomainSID: domainSID, UnixID: unixID})
+	}
+
+	return collisions, nil
+}
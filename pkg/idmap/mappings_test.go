@@ -0,0 +1,133 @@
+package idmap_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestAllMappings(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext()
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	// CONTOSO's IDs come from AD, so libsss_idmap accepts its range overlapping EXAMPLE's
+	for _, d := range []idmap.DomainConfig{
+		{DomainName: "EXAMPLE", DomainSID: "S-1-5-21-3623811015-3361044348-30300820", IDRange: idmap.IDRange{Min: 10000, Max: 20000}},
+		{DomainName: "CONTOSO", DomainSID: "S-1-5-21-1111111111-2222222222-3333333333", IDRange: idmap.IDRange{Min: 15000, Max: 25000}, ExternalMapping: true},
+	} {
+		if err := ctx.AddDomain(d); err != nil {
+			t.Fatalf("AddDomain(%s) failed: %v", d.DomainName, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		sid  string
+		want []idmap.Mapping
+	}{
+		{
+			name: "unambiguous",
+			sid:  "S-1-5-21-3623811015-3361044348-30300820-1013",
+			want: []idmap.Mapping{
+				{SID: "S-1-5-21-3623811015-3361044348-30300820-1013", DomainName: "EXAMPLE", DomainSID: "S-1-5-21-3623811015-3361044348-30300820", UnixID: 11013},
+			},
+		},
+		{
+			name: "inside the overlap",
+			sid:  "S-1-5-21-3623811015-3361044348-30300820-6000",
+			want: []idmap.Mapping{
+				{SID: "S-1-5-21-3623811015-3361044348-30300820-6000", DomainName: "EXAMPLE", DomainSID: "S-1-5-21-3623811015-3361044348-30300820", UnixID: 16000},
+				{SID: "S-1-5-21-3623811015-3361044348-30300820-6000", DomainName: "CONTOSO", DomainSID: "S-1-5-21-1111111111-2222222222-3333333333", UnixID: 16000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ctx.AllMappings(tt.sid)
+			if err != nil {
+				t.Fatalf("AllMappings(%q) failed: %v", tt.sid, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("AllMappings(%q) = %+v, want %+v", tt.sid, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ctx.AllMappings("S-1-5-21-1234567890-1234567890-1234567890-500"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("AllMappings() for an unknown domain = %v, want ErrNotFound", err)
+	}
+}
+
+func TestReservedIDCollisions(t *testing.T) {
+	requireLibrary(t)
+
+	const domainSID = "S-1-5-21-3623811015-3361044348-30300820"
+
+	// A range starting at 900 hands RIDs 0-99 the reserved IDs 900-999
+	low, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  domainSID,
+		IDRange:    idmap.IDRange{Min: 900, Max: 20000},
+	})
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer low.Close()
+
+	got, err := low.ReservedIDCollisions(domainSID)
+	if err != nil {
+		t.Fatalf("ReservedIDCollisions() failed: %v", err)
+	}
+	if len(got) != 100 {
+		t.Fatalf("ReservedIDCollisions() returned %d mappings, want 100", len(got))
+	}
+	wantFirst := idmap.Mapping{SID: domainSID + "-0", DomainName: "EXAMPLE", DomainSID: domainSID, UnixID: 900}
+	wantLast := idmap.Mapping{SID: domainSID + "-99", DomainName: "EXAMPLE", DomainSID: domainSID, UnixID: 999}
+	if got[0] != wantFirst || got[99] != wantLast {
+		t.Errorf("ReservedIDCollisions() = [%+v ... %+v], want [%+v ... %+v]", got[0], got[99], wantFirst, wantLast)
+	}
+
+	// A range entirely below 1000 collides on every ID, and RIDs past it are never mapped
+	small, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  domainSID,
+		IDRange:    idmap.IDRange{Min: 1, Max: 499},
+	})
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer small.Close()
+
+	got, err = small.ReservedIDCollisions(domainSID)
+	if err != nil {
+		t.Fatalf("ReservedIDCollisions() for range 1-499 failed: %v", err)
+	}
+	if len(got) != 499 {
+		t.Fatalf("ReservedIDCollisions() for range 1-499 returned %d mappings, want 499", len(got))
+	}
+	wantLast = idmap.Mapping{SID: domainSID + "-498", DomainName: "EXAMPLE", DomainSID: domainSID, UnixID: 499}
+	if got[498] != wantLast {
+		t.Errorf("ReservedIDCollisions() last = %+v, want %+v", got[498], wantLast)
+	}
+	for _, m := range got {
+		if unixID, err := small.SIDToUnixID(m.SID); err != nil || unixID != m.UnixID {
+			t.Errorf("SIDToUnixID(%q) = %d, %v, want %d", m.SID, unixID, err, m.UnixID)
+		}
+	}
+
+	ctx := newExampleContext(t)
+	if got, err := ctx.ReservedIDCollisions(domainSID); err != nil || len(got) != 0 {
+		t.Errorf("ReservedIDCollisions() for a range from 10000 = %v, %v, want none", got, err)
+	}
+	if _, err := ctx.ReservedIDCollisions("S-1-5-21-1234567890-1234567890-1234567890"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("ReservedIDCollisions() for an unknown domain = %v, want ErrNotFound", err)
+	}
+}
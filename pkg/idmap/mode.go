@@ -0,0 +1,49 @@
+package idmap
+
+import "fmt"
+
+// MappingMode describes how IDs of a domain are assigned
+type MappingMode int
+
+const (
+	// Algorithmic maps RIDs into an explicitly configured range
+	Algorithmic MappingMode = iota
+	// Autorid maps RIDs into slices allocated autorid-style
+	Autorid
+	// External means IDs are managed outside libsss_idmap (e.g. POSIX attributes in AD)
+	External
+)
+
+func (m MappingMode) String() string {
+	switch m {
+	case Algorithmic:
+		return "algorithmic"
+	case Autorid:
+		return "autorid"
+	case External:
+		return "external"
+	default:
+		return fmt.Sprintf("MappingMode(%d)", int(m))
+	}
+}
+
+// MappingMode reports how IDs of a registered domain are assigned by this context
+func (c *IDMapContext) MappingMode(domainSID string) (MappingMode, error) {
+	algorithmic, err := c.DomainHasAlgorithmicMapping(domainSID)
+	if err != nil {
+		return 0, err
+	}
+	if !algorithmic {
+		return External, nil
+	}
+
+	config, err := c.Config()
+	if err != nil {
+		return 0, err
+	}
+	if config.Autorid {
+		return Autorid, nil
+	}
+
+	return Algorithmic, nil
+}
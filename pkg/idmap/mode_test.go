@@ -0,0 +1,79 @@
+package idmap_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestMappingMode(t *testing.T) {
+	requireLibrary(t)
+
+	const domainSID = "S-1-5-21-3623811015-3361044348-30300820"
+
+	tests := []struct {
+		name     string
+		opts     []idmap.Option
+		external bool
+		want     idmap.MappingMode
+	}{
+		{name: "algorithmic", want: idmap.Algorithmic},
+		{name: "autorid", opts: []idmap.Option{idmap.WithAutorid()}, want: idmap.Autorid},
+		{name: "external", external: true, want: idmap.External},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+				DomainName:      "EXAMPLE",
+				DomainSID:       domainSID,
+				IDRange:         idmap.IDRange{Min: 10000, Max: 20000},
+				ExternalMapping: tt.external,
+			}, tt.opts...)
+			if err != nil {
+				t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+			}
+			defer ctx.Close()
+
+			got, err := ctx.MappingMode(domainSID)
+			if err != nil {
+				t.Fatalf("MappingMode() failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("MappingMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMappingMode_UnknownDomain(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	if _, err := ctx.MappingMode("S-1-5-21-1111111111-2222222222-3333333333"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("MappingMode() = %v, want ErrNotFound", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext(idmap.WithAutorid())
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	config, err := ctx.Config()
+	if err != nil {
+		t.Fatalf("Config() failed: %v", err)
+	}
+	if !config.Autorid {
+		t.Error("Config().Autorid = false, want true")
+	}
+	if config.RangeSize == 0 || config.Lower >= config.Upper {
+		t.Errorf("Config() = %+v, want library defaults", config)
+	}
+}
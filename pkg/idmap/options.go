@@ -0,0 +1,115 @@
+package idmap
+
+import "maps"
+
+// Option configures an IDMapContext at construction time
+type Option func(*IDMapContext)
+
+// ErrorHook translates a non-success SSS idmap return code into a caller-defined error
+// op names the operation that failed (e.g. "SIDToUnixID") and sid is the SID involved, if any
+// Returning nil falls back to the default sentinel error mapping
+type ErrorHook func(code int, op string, sid string) error
+
+// WithErrorHook installs a hook consulted before the default error mapping
+func WithErrorHook(hook ErrorHook) Option {
+	return func(c *IDMapContext) {
+		c.errorHook = hook
+	}
+}
+
+// WithFallbackID makes conversions of SIDs from unconfigured domains return id
+// (e.g. the nobody UID) instead of ErrNotFound
+func WithFallbackID(id uint32) Option {
+	return func(c *IDMapContext) {
+		c.fallbackID = id
+		c.hasFallback = true
+	}
+}
+
+// WithAutorid enables SSSD's autorid-compatible slice allocation in the underlying context
+func WithAutorid() Option {
+	return func(c *IDMapContext) {
+		c.autorid = true
+	}
+}
+
+// WithWellKnownMapping resolves the given SIDs (typically well-known or BUILTIN ones such
+// as S-1-5-32-544) to fixed IDs before the algorithmic mapping is consulted
+func WithWellKnownMapping(ids map[string]uint32) Option {
+	return func(c *IDMapContext) {
+		c.wellKnownIDs = maps.Clone(ids)
+	}
+}
+
+// WithRelaxedRangeValidation skips the Go-side min < max check when adding domains, so
+// special domains such as single-ID ranges (min == max) can be registered; the C library
+// still rejects ranges it cannot use
+func WithRelaxedRangeValidation() Option {
+	return func(c *IDMapContext) {
+		c.relaxedRanges = true
+	}
+}
+
+// WithUnmappedSIDCollector calls collect with every SID whose conversion fails because no
+// configured domain matches it, to help find domains missing from the configuration
+// Invalid SIDs are not reported, and neither are SIDs answered by WithFallbackID
+// collect may be called concurrently from parallel conversions
+func WithUnmappedSIDCollector(collect func(sid string)) Option {
+	return func(c *IDMapContext) {
+		c.unmapped = collect
+	}
+}
+
+// WithSIDAnnotationStripping makes string SID conversions tolerate trailing metadata such
+// as "S-1-5-21-...-1013#jsmith" or "S-1-5-21-...-1013 (jsmith)" by removing it first
+// Use StripSIDAnnotation to get at the annotation itself
+func WithSIDAnnotationStripping() Option {
+	return func(c *IDMapContext) {
+		c.stripAnnotations = true
+	}
+}
+
+// WithPercentDecoding makes string SID conversions URL-unescape their input first, for SIDs
+// taken from query parameters or logs as e.g. "S%2D1%2D5%2D21-...-1013"
+// Input that is not validly percent-encoded is rejected with ErrInvalidSID
+func WithPercentDecoding() Option {
+	return func(c *IDMapContext) {
+		c.percentDecoding = true
+	}
+}
+
+// WithPanicRecovery makes AddDomain and the SID conversions recover a Go panic raised while
+// handling a call, such as one from a callback or a bug at the cgo boundary, and return
+// ErrInternal instead of crashing the process
+// It cannot catch faults inside libsss_idmap itself: a C segfault still terminates the process
+func WithPanicRecovery() Option {
+	return func(c *IDMapContext) {
+		c.recoverPanics = true
+	}
+}
+
+// WithExtraSliceInit makes AddAutoDomain pre-allocate n slices beyond a domain's first one
+// (sss_idmap_ctx_set_extra_slice_init), so high RIDs map without autorid allocating slices
+// on demand; domains added with AddDomain are not affected
+func WithExtraSliceInit(n uint32) Option {
+	return func(c *IDMapContext) {
+		c.extraSliceInit = n
+	}
+}
+
+// WithDefaultDomain sets the domain MapRIDAgainstDefault resolves bare RIDs against, for
+// shorthand input such as "1013"; the domain must also be added to the context
+func WithDefaultDomain(domainSID string) Option {
+	return func(c *IDMapContext) {
+		c.defaultDomainSID = domainSID
+	}
+}
+
+// WithDebugCodes logs the return code of every libsss_idmap call at debug level, successes
+// included, to diagnose behavior that differs between library versions
+// Codes from the constructor itself go to slog.Default, as SetLogger can only follow it
+func WithDebugCodes() Option {
+	return func(c *IDMapContext) {
+		c.debugCodes = true
+	}
+}
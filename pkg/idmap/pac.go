@@ -0,0 +1,57 @@
+package idmap
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DecodeSIDArray decodes the SIDs of a PAC-style SID array, such as the ExtraSids of a
+// Kerberos PAC stripped of their attributes, into string SIDs in array order
+// The layout is a uint32 SID count followed, for every SID, by a uint32 sub-authority
+// count (the NDR conformance) and the binary RPC_SID; integers are little-endian as in NDR
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-pac/311aab27-ebdf-47f7-b939-13dc99b15341
+func DecodeSIDArray(blob []byte) ([]string, error) {
+	if len(blob) < 4 {
+		return nil, fmt.Errorf("%w: SID array too short: %d bytes", ErrInvalidSID, len(blob))
+	}
+
+	count := binary.LittleEndian.Uint32(blob)
+	rest := blob[4:]
+
+	// Every entry takes at least its conformance and a SID header
+	if uint64(count)*(4+binSIDHeaderLen) > uint64(len(rest)) {
+		return nil, fmt.Errorf("%w: SID array claims %d SIDs in %d bytes", ErrInvalidSID, count, len(rest))
+	}
+
+	sids := make([]string, 0, count)
+	interner := newSIDInterner()
+	for i := range count {
+		if len(rest) < 4+binSIDHeaderLen {
+			return nil, fmt.Errorf("%w: SID %d truncated", ErrInvalidSID, i)
+		}
+
+		conformance := binary.LittleEndian.Uint32(rest)
+		rest = rest[4:]
+		if conformance != uint32(rest[1]) {
+			return nil, fmt.Errorf("%w: SID %d has %d sub-authorities but conformance %d", ErrInvalidSID, i, rest[1], conformance)
+		}
+
+		n := binSIDHeaderLen + int(rest[1])*4
+		if n > len(rest) {
+			return nil, fmt.Errorf("%w: SID %d truncated", ErrInvalidSID, i)
+		}
+
+		sid, err := interner.decode(rest[:n])
+		if err != nil {
+			return nil, fmt.Errorf("SID %d: %w", i, err)
+		}
+		sids = append(sids, sid)
+		rest = rest[n:]
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes after SID array", ErrInvalidSID, len(rest))
+	}
+
+	return sids, nil
+}
@@ -0,0 +1,66 @@
+package idmap_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// EXAMPLE Domain Users, BUILTIN\Administrators and Everyone
+const exampleSIDArrayHex = "03000000" +
+	"05000000010500000000000515000000c7f7fed77c7755c8945ace0101020000" +
+	"0200000001020000000000052000000020020000" +
+	"01000000010100000000000100000000"
+
+func TestDecodeSIDArray(t *testing.T) {
+	blob, err := hex.DecodeString(exampleSIDArrayHex)
+	if err != nil {
+		t.Fatalf("invalid fixture: %v", err)
+	}
+
+	got, err := idmap.DecodeSIDArray(blob)
+	if err != nil {
+		t.Fatalf("DecodeSIDArray() unexpected error: %v", err)
+	}
+	want := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-513",
+		"S-1-5-32-544",
+		"S-1-1-0",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("DecodeSIDArray() = %q, want %q", got, want)
+	}
+
+	if got, err := idmap.DecodeSIDArray([]byte{0, 0, 0, 0}); err != nil || len(got) != 0 {
+		t.Errorf("DecodeSIDArray() of an empty array = %q, %v, want no SIDs", got, err)
+	}
+}
+
+func TestDecodeSIDArray_Malformed(t *testing.T) {
+	blob, _ := hex.DecodeString(exampleSIDArrayHex)
+
+	conformanceMismatch := slices.Clone(blob)
+	conformanceMismatch[4] = 4
+
+	tests := []struct {
+		name string
+		blob []byte
+	}{
+		{name: "empty", blob: nil},
+		{name: "count exceeds data", blob: []byte{0xff, 0, 0, 0, 1, 0, 0, 0}},
+		{name: "truncated SID", blob: blob[:len(blob)-2]},
+		{name: "trailing bytes", blob: append(slices.Clone(blob), 0)},
+		{name: "conformance mismatch", blob: conformanceMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := idmap.DecodeSIDArray(tt.blob); !errors.Is(err, idmap.ErrInvalidSID) {
+				t.Errorf("DecodeSIDArray() = %q, %v, want ErrInvalidSID", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package idmap
+
+import "fmt"
+
+// EffectiveRanges returns the UID and GID ranges of a registered domain
+// libsss_idmap maps a SID to the same ID whether it names a user or a group, so both are
+// the domain's range; they are returned separately for callers that validate a split
+// UID/GID layout against it
+// It returns ErrNotFound for an unregistered domain
+func (c *IDMapContext) EffectiveRanges(domainSID string) (uidRange, gidRange IDRange, err error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, d := range c.domains {
+		if d.DomainSID == domainSID {
+			return d.IDRange, d.IDRange, nil
+		}
+	}
+
+	return IDRange{}, IDRange{}, fmt.Errorf("%w: no registered domain %s", ErrNotFound, domainSID)
+}
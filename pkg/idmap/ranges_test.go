@@ -0,0 +1,25 @@
+package idmap_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestEffectiveRanges(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	// libsss_idmap never splits a domain's range between UIDs and GIDs
+	want := idmap.IDRange{Min: 10000, Max: 20000}
+	uid, gid, err := ctx.EffectiveRanges("S-1-5-21-3623811015-3361044348-30300820")
+	if err != nil || uid != want || gid != want {
+		t.Errorf("EffectiveRanges() = %v, %v, %v, want %v for both", uid, gid, err, want)
+	}
+
+	if _, _, err := ctx.EffectiveRanges("S-1-5-21-1234567890-1234567890-1234567890"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("EffectiveRanges() for an unregistered domain = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,57 @@
+package idmap
+
+import "fmt"
+
+// UnixIDToSID converts a Unix UID or GID back to the SID it was mapped from
+// It returns ErrNotFound if no registered domain's range contains id, including ranges
+// of domains with external mapping, whose IDs only AD can resolve
+func (c *IDMapContext) UnixIDToSID(id uint32) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.unixIDToSID(id)
+}
+
+// unixIDToSID implements UnixIDToSID; the caller must hold mu
+func (c *IDMapContext) unixIDToSID(id uint32) (string, error) {
+	if c.ctx == nil {
+		return "", fmt.Errorf("%w: context is nil", ErrInternal)
+	}
+
+	sid, code := unixToSID(c.ctx, id)
+	c.debugCode("UnixIDToSID", code)
+	if code != IDMAPSuccess {
+		switch code {
+		case IDMAPNoDomain:
+			return "", c.fail("UnixIDToSID", code, "", fmt.Errorf("%w: no domain range contains %d", ErrNotFound, id))
+		case IDMAPExternal:
+			return "", c.fail("UnixIDToSID", code, "", fmt.Errorf("%w: %d belongs to a domain with external mapping", ErrNotFound, id))
+		default:
+			return "", c.fail("UnixIDToSID", code, "", fmt.Errorf("%w: failed to convert Unix ID %d (code: %d)", ErrInternal, id, code))
+		}
+	}
+
+	return sid, nil
+}
+
+// VerifyRoundTrip maps sid to its Unix ID and back, returning ErrRoundTrip if the result
+// is a different SID; errors of either conversion are returned as they are
+func (c *IDMapContext) VerifyRoundTrip(sid string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	unixID, err := c.sidToUnixID(sid)
+	if err != nil {
+		return err
+	}
+
+	back, err := c.unixIDToSID(unixID)
+	if err != nil {
+		return fmt.Errorf("%s maps to %d: %w", sid, unixID, err)
+	}
+	if back != sid {
+		return fmt.Errorf("%w: %s maps to %d, which maps back to %s", ErrRoundTrip, sid, unixID, back)
+	}
+
+	return nil
+}
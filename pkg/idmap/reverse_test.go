@@ -0,0 +1,66 @@
+package idmap_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestUnixIDToSID(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	tests := []struct {
+		id      uint32
+		want    string
+		wantErr error
+	}{
+		{id: 11013, want: "S-1-5-21-3623811015-3361044348-30300820-1013"},
+		{id: 10000, want: "S-1-5-21-3623811015-3361044348-30300820-0"},
+		{id: 9999, wantErr: idmap.ErrNotFound},
+		{id: 30000, wantErr: idmap.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		got, err := ctx.UnixIDToSID(tt.id)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("UnixIDToSID(%d) = %q, %v, want %v", tt.id, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("UnixIDToSID(%d) = %q, %v, want %q", tt.id, got, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyRoundTrip(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	if err := ctx.VerifyRoundTrip("S-1-5-21-3623811015-3361044348-30300820-1013"); err != nil {
+		t.Errorf("VerifyRoundTrip() = %v, want nil", err)
+	}
+	if err := ctx.VerifyRoundTrip("S-1-5-21-1234567890-1234567890-1234567890-1013"); !errors.Is(err, idmap.ErrNotFound) {
+		t.Errorf("VerifyRoundTrip() for an unknown domain = %v, want ErrNotFound", err)
+	}
+
+	// A well-known mapping resolves forward only, so its ID maps back into EXAMPLE
+	wellKnown, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, idmap.WithWellKnownMapping(map[string]uint32{"S-1-5-32-544": 10512}))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer wellKnown.Close()
+
+	if err := wellKnown.VerifyRoundTrip("S-1-5-32-544"); !errors.Is(err, idmap.ErrRoundTrip) {
+		t.Errorf("VerifyRoundTrip() for a well-known mapping = %v, want ErrRoundTrip", err)
+	}
+}
@@ -0,0 +1,63 @@
+package idmap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SambaRIDMap reproduces Samba's idmap_rid backend for one domain, for sites migrating
+// from Samba that must keep their existing UIDs and GIDs
+// idmap_rid computes id = range_min + (rid - base_rid) and fails beyond range_max; SSSD
+// instead maps each RID into a slice of rangesize IDs and, with autorid, continues into
+// further slices, so the two agree only for base_rid 0 and RIDs within the first slice
+type SambaRIDMap struct {
+	config  DomainConfig
+	baseRID uint32
+}
+
+// NewSambaRIDMap returns an idmap_rid compatible mapper for config's domain and range
+// baseRID corresponds to the idmap config DOMAIN : base_rid setting (0 by default)
+func NewSambaRIDMap(config DomainConfig, baseRID uint32) (*SambaRIDMap, error) {
+	if err := validateDomainConfig(config, false); err != nil {
+		return nil, err
+	}
+
+	return &SambaRIDMap{config: config, baseRID: baseRID}, nil
+}
+
+// SIDToUnixID maps an account SID of the configured domain with Samba's formula
+func (m *SambaRIDMap) SIDToUnixID(sid string) (uint32, error) {
+	domainSID, err := DomainSIDOf(sid)
+	if err != nil {
+		return 0, err
+	}
+	if !strings.EqualFold(domainSID, m.config.DomainSID) {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, sid)
+	}
+
+	rid, err := strconv.ParseUint(sid[len(domainSID)+1:], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidSID, sid)
+	}
+
+	if uint32(rid) < m.baseRID {
+		return 0, fmt.Errorf("%w: RID %d of %s is below base_rid %d", ErrNotFound, rid, sid, m.baseRID)
+	}
+	id := uint64(m.config.IDRange.Min) + rid - uint64(m.baseRID)
+	if id > uint64(m.config.IDRange.Max) {
+		return 0, fmt.Errorf("%w: %s maps to %d, beyond the range maximum %d", ErrNotFound, sid, id, m.config.IDRange.Max)
+	}
+
+	return uint32(id), nil
+}
+
+// BinSIDToUnixID decodes a binary SID and maps it with Samba's formula
+func (m *SambaRIDMap) BinSIDToUnixID(sid []byte) (uint32, error) {
+	strSID, err := DecodeSID(sid)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.SIDToUnixID(strSID)
+}
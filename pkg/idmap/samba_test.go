@@ -0,0 +1,94 @@
+package idmap_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestSambaRIDMap(t *testing.T) {
+	config := idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}
+
+	// Values as produced by: idmap config EXAMPLE : backend = rid, range = 10000-20000,
+	// base_rid = 0 or 1000
+	tests := []struct {
+		name    string
+		baseRID uint32
+		sid     string
+		want    uint32
+		wantErr error
+	}{
+		{name: "administrator", sid: "S-1-5-21-3623811015-3361044348-30300820-500", want: 10500},
+		{name: "user", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", want: 11013},
+		{name: "top of range", sid: "S-1-5-21-3623811015-3361044348-30300820-10000", want: 20000},
+		{name: "beyond range", sid: "S-1-5-21-3623811015-3361044348-30300820-10001", wantErr: idmap.ErrNotFound},
+		{name: "base_rid user", baseRID: 1000, sid: "S-1-5-21-3623811015-3361044348-30300820-1013", want: 10013},
+		{name: "base_rid first RID", baseRID: 1000, sid: "S-1-5-21-3623811015-3361044348-30300820-1000", want: 10000},
+		{name: "below base_rid", baseRID: 1000, sid: "S-1-5-21-3623811015-3361044348-30300820-500", wantErr: idmap.ErrNotFound},
+		{name: "other domain", sid: "S-1-5-21-1111111111-2222222222-3333333333-1013", wantErr: idmap.ErrNotFound},
+		{name: "invalid", sid: "not-a-sid", wantErr: idmap.ErrInvalidSID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := idmap.NewSambaRIDMap(config, tt.baseRID)
+			if err != nil {
+				t.Fatalf("NewSambaRIDMap() failed: %v", err)
+			}
+
+			got, err := m.SIDToUnixID(tt.sid)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("SIDToUnixID(%q) = %d, %v, want %v", tt.sid, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SIDToUnixID(%q) failed: %v", tt.sid, err)
+			}
+			if got != tt.want {
+				t.Errorf("SIDToUnixID(%q) = %d, want %d", tt.sid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSambaRIDMap_MatchesSSSDFirstSlice(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+	m, err := idmap.NewSambaRIDMap(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, 0)
+	if err != nil {
+		t.Fatalf("NewSambaRIDMap() failed: %v", err)
+	}
+
+	bin, _ := hex.DecodeString("010500000000000515000000c7f7fed77c7755c8945ace01f5030000")
+	want, err := ctx.BinSIDToUnixID(bin)
+	if err != nil {
+		t.Fatalf("BinSIDToUnixID() failed: %v", err)
+	}
+	if got, err := m.BinSIDToUnixID(bin); err != nil || got != want {
+		t.Errorf("SambaRIDMap.BinSIDToUnixID() = %d, %v, want %d as SSSD maps it", got, err, want)
+	}
+}
+
+func TestNewSambaRIDMap_Invalid(t *testing.T) {
+	_, err := idmap.NewSambaRIDMap(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 20000, Max: 10000},
+	}, 0)
+	if !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Errorf("NewSambaRIDMap() = %v, want ErrInvalidRange", err)
+	}
+}
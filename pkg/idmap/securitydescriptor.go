@@ -0,0 +1,178 @@
+package idmap
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ACE represents a single access control entry referenced by a DACL
+type ACE struct {
+	Type  uint8
+	Flags uint8
+	Mask  uint32
+	SID   string
+}
+
+const (
+	// sdHeaderLen is the size of a self-relative SECURITY_DESCRIPTOR header
+	sdHeaderLen = 20
+	// aclHeaderLen is the size of an ACL header
+	aclHeaderLen = 8
+	// aceHeaderLen is the size of an ACE header (type, flags, size)
+	aceHeaderLen = 4
+)
+
+// ACE types whose body is an access mask followed by a trustee SID
+var simpleACETypes = map[uint8]bool{
+	0x00: true, // ACCESS_ALLOWED_ACE_TYPE
+	0x01: true, // ACCESS_DENIED_ACE_TYPE
+	0x02: true, // SYSTEM_AUDIT_ACE_TYPE
+	0x03: true, // SYSTEM_ALARM_ACE_TYPE
+	0x09: true, // ACCESS_ALLOWED_CALLBACK_ACE_TYPE
+	0x0A: true, // ACCESS_DENIED_CALLBACK_ACE_TYPE
+	0x0D: true, // SYSTEM_AUDIT_CALLBACK_ACE_TYPE
+	0x11: true, // SYSTEM_MANDATORY_LABEL_ACE_TYPE
+	0x12: true, // SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE
+	0x13: true, // SYSTEM_SCOPED_POLICY_ID_ACE_TYPE
+}
+
+// ACE types whose body is an access mask, object flags and optional GUIDs followed by a trustee SID
+var objectACETypes = map[uint8]bool{
+	0x05: true, // ACCESS_ALLOWED_OBJECT_ACE_TYPE
+	0x06: true, // ACCESS_DENIED_OBJECT_ACE_TYPE
+	0x07: true, // SYSTEM_AUDIT_OBJECT_ACE_TYPE
+	0x08: true, // SYSTEM_ALARM_OBJECT_ACE_TYPE
+	0x0B: true, // ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE
+	0x0C: true, // ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE
+	0x0F: true, // SYSTEM_AUDIT_CALLBACK_OBJECT_ACE_TYPE
+}
+
+// DecodeSecurityDescriptorSIDs extracts the owner, group and DACL SIDs from a
+// binary self-relative security descriptor
+// Owner and group are empty when absent; aces is nil when there is no DACL
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-dtyp/2918391b-75b9-4eeb-83f0-7fdc04a5c6c9
+func DecodeSecurityDescriptorSIDs(blob []byte) (owner, group string, aces []ACE, err error) {
+	if len(blob) < sdHeaderLen {
+		return "", "", nil, fmt.Errorf("security descriptor too short: %d bytes", len(blob))
+	}
+
+	offsetOwner := binary.LittleEndian.Uint32(blob[4:8])
+	offsetGroup := binary.LittleEndian.Uint32(blob[8:12])
+	offsetDacl := binary.LittleEndian.Uint32(blob[16:20])
+
+	if offsetOwner != 0 {
+		owner, err = decodeSIDAt(blob, offsetOwner)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("owner: %w", err)
+		}
+	}
+
+	if offsetGroup != 0 {
+		group, err = decodeSIDAt(blob, offsetGroup)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("group: %w", err)
+		}
+	}
+
+	if offsetDacl != 0 {
+		aces, err = decodeACL(blob, offsetDacl)
+		if err != nil {
+			return "", "", nil, fmt.Errorf("DACL: %w", err)
+		}
+	}
+
+	return owner, group, aces, nil
+}
+
+// decodeSIDAt decodes the binary SID starting at offset, which may be followed by other data
+func decodeSIDAt(blob []byte, offset uint32) (string, error) {
+	if uint64(offset)+8 > uint64(len(blob)) {
+		return "", fmt.Errorf("SID offset %d out of bounds", offset)
+	}
+
+	end := uint64(offset) + 8 + uint64(blob[offset+1])*4
+	if end > uint64(len(blob)) {
+		return "", fmt.Errorf("SID at offset %d exceeds buffer", offset)
+	}
+
+	return DecodeSID(blob[offset:end])
+}
+
+// decodeACL lists the SIDs referenced by the ACEs of the ACL at offset
+func decodeACL(blob []byte, offset uint32) ([]ACE, error) {
+	if uint64(offset)+aclHeaderLen > uint64(len(blob)) {
+		return nil, fmt.Errorf("ACL offset %d out of bounds", offset)
+	}
+
+	acl := blob[offset:]
+	aclSize := int(binary.LittleEndian.Uint16(acl[2:4]))
+	aceCount := int(binary.LittleEndian.Uint16(acl[4:6]))
+	if aclSize < aclHeaderLen || aclSize > len(acl) {
+		return nil, fmt.Errorf("invalid ACL size: %d", aclSize)
+	}
+	acl = acl[:aclSize]
+
+	aces := make([]ACE, 0, aceCount)
+	pos := aclHeaderLen
+	for i := 0; i < aceCount; i++ {
+		if pos+aceHeaderLen > len(acl) {
+			return nil, fmt.Errorf("ACE %d out of bounds", i)
+		}
+
+		aceType := acl[pos]
+		aceFlags := acl[pos+1]
+		aceSize := int(binary.LittleEndian.Uint16(acl[pos+2 : pos+4]))
+		if aceSize < aceHeaderLen || pos+aceSize > len(acl) {
+			return nil, fmt.Errorf("ACE %d has invalid size: %d", i, aceSize)
+		}
+		body := acl[pos+aceHeaderLen : pos+aceSize]
+		pos += aceSize
+
+		sidOffset, ok := aceSIDOffset(aceType, body)
+		if !ok {
+			// Unknown ACE types carry no SID we know how to locate
+			continue
+		}
+
+		if len(body) < sidOffset+4 {
+			return nil, fmt.Errorf("ACE %d too short: %d bytes", i, len(body))
+		}
+
+		sid, err := decodeSIDAt(body, uint32(sidOffset))
+		if err != nil {
+			return nil, fmt.Errorf("ACE %d: %w", i, err)
+		}
+
+		aces = append(aces, ACE{
+			Type:  aceType,
+			Flags: aceFlags,
+			Mask:  binary.LittleEndian.Uint32(body[0:4]),
+			SID:   sid,
+		})
+	}
+
+	return aces, nil
+}
+
+// aceSIDOffset returns where the trustee SID starts within an ACE body
+func aceSIDOffset(aceType uint8, body []byte) (int, bool) {
+	switch {
+	case simpleACETypes[aceType]:
+		return 4, true
+	case objectACETypes[aceType]:
+		if len(body) < 8 {
+			return 8, true
+		}
+		offset := 8
+		objectFlags := binary.LittleEndian.Uint32(body[4:8])
+		if objectFlags&0x1 != 0 { // ACE_OBJECT_TYPE_PRESENT
+			offset += 16
+		}
+		if objectFlags&0x2 != 0 { // ACE_INHERITED_OBJECT_TYPE_PRESENT
+			offset += 16
+		}
+		return offset, true
+	default:
+		return 0, false
+	}
+}
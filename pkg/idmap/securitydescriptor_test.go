@@ -0,0 +1,93 @@
+package idmap_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// O:BAG:SYD:(A;;FA;;;SY)(A;OICI;FA;;;BA)(A;;0x1200a9;;;<EXAMPLE>-513)
+const exampleSDHex = "010004801400000024000000000000003000000001020000000000052000000020020000010100000000000512000000020058000300000000001400ff011f0001010000000000051200000000031800ff011f000102000000000005200000002002000000002400a9001200010500000000000515000000c7f7fed77c7755c8945ace0101020000"
+
+func TestDecodeSecurityDescriptorSIDs(t *testing.T) {
+	blob, err := hex.DecodeString(exampleSDHex)
+	if err != nil {
+		t.Fatalf("invalid fixture: %v", err)
+	}
+
+	owner, group, aces, err := idmap.DecodeSecurityDescriptorSIDs(blob)
+	if err != nil {
+		t.Fatalf("DecodeSecurityDescriptorSIDs() unexpected error: %v", err)
+	}
+
+	if owner != "S-1-5-32-544" {
+		t.Errorf("owner = %q, want %q", owner, "S-1-5-32-544")
+	}
+	if group != "S-1-5-18" {
+		t.Errorf("group = %q, want %q", group, "S-1-5-18")
+	}
+
+	wantACEs := []idmap.ACE{
+		{Type: 0x00, Flags: 0x00, Mask: 0x001f01ff, SID: "S-1-5-18"},
+		{Type: 0x00, Flags: 0x03, Mask: 0x001f01ff, SID: "S-1-5-32-544"},
+		{Type: 0x00, Flags: 0x00, Mask: 0x001200a9, SID: "S-1-5-21-3623811015-3361044348-30300820-513"},
+	}
+	if len(aces) != len(wantACEs) {
+		t.Fatalf("got %d ACEs, want %d", len(aces), len(wantACEs))
+	}
+	for i, want := range wantACEs {
+		if aces[i] != want {
+			t.Errorf("ACE %d = %+v, want %+v", i, aces[i], want)
+		}
+	}
+}
+
+func TestDecodeSecurityDescriptorSIDs_Invalid(t *testing.T) {
+	valid, _ := hex.DecodeString(exampleSDHex)
+
+	tests := []struct {
+		name string
+		blob []byte
+	}{
+		{
+			name: "empty",
+			blob: nil,
+		},
+		{
+			name: "header only with owner offset out of bounds",
+			blob: valid[:20],
+		},
+		{
+			name: "truncated DACL",
+			blob: valid[:len(valid)-10],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := idmap.DecodeSecurityDescriptorSIDs(tt.blob)
+			if err == nil {
+				t.Error("DecodeSecurityDescriptorSIDs() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestDecodeSecurityDescriptorSIDs_NoDACL(t *testing.T) {
+	blob, _ := hex.DecodeString(exampleSDHex)
+	// Clear the DACL offset
+	blob = append([]byte(nil), blob...)
+	copy(blob[16:20], []byte{0, 0, 0, 0})
+
+	owner, group, aces, err := idmap.DecodeSecurityDescriptorSIDs(blob)
+	if err != nil {
+		t.Fatalf("DecodeSecurityDescriptorSIDs() unexpected error: %v", err)
+	}
+	if owner == "" || group == "" {
+		t.Errorf("expected owner and group, got %q and %q", owner, group)
+	}
+	if aces != nil {
+		t.Errorf("expected no ACEs, got %v", aces)
+	}
+}
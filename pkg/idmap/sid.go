@@ -0,0 +1,403 @@
+package idmap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// maxSubAuthorities is the maximum number of sub-authorities a SID may carry
+	maxSubAuthorities = 15
+	// maxAuthority is the largest value of the 48-bit identifier authority
+	maxAuthority = 1<<48 - 1
+	// sidRevision is the only SID revision Windows issues
+	sidRevision = 1
+)
+
+// SIDOption configures how SIDs are parsed and decoded
+type SIDOption func(*sidOptions)
+
+type sidOptions struct {
+	strictRevision    bool
+	hexAuthority      bool
+	maxSubAuthorities int
+}
+
+// newSIDOptions applies opts over the defaults
+func newSIDOptions(opts []SIDOption) sidOptions {
+	o := sidOptions{maxSubAuthorities: maxSubAuthorities}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithStrictRevision rejects binary SIDs whose revision is not 1; any other revision
+// indicates corruption or a format Windows does not produce
+func WithStrictRevision() SIDOption {
+	return func(o *sidOptions) {
+		o.strictRevision = true
+	}
+}
+
+// WithHexAuthority renders identifier authorities of 2^32 and above as 0x-prefixed hex,
+// e.g. S-1-0x010000000000-1, as Microsoft does; smaller authorities stay decimal
+func WithHexAuthority() SIDOption {
+	return func(o *sidOptions) {
+		o.hexAuthority = true
+	}
+}
+
+// WithMaxSubAuthorities rejects SIDs with more than n sub-authorities, as a guard against
+// unexpectedly long SIDs; n is clamped to the 0-15 the SID format allows
+func WithMaxSubAuthorities(n int) SIDOption {
+	return func(o *sidOptions) {
+		o.maxSubAuthorities = min(max(n, 0), maxSubAuthorities)
+	}
+}
+
+// ValidateSID checks that sid is a well-formed string SID (S-R-A-S1-S2-...)
+// without consulting the SSS library; WithMaxSubAuthorities lowers the sub-authority cap
+func ValidateSID(sid string, opts ...SIDOption) error {
+	o := newSIDOptions(opts)
+
+	if err := checkSIDComponents(sid); err != nil {
+		return err
+	}
+
+	parts := strings.Split(sid, "-")
+	if len(parts) < 3 || parts[0] != "S" {
+		return fmt.Errorf("%w: %q", ErrInvalidSID, sid)
+	}
+
+	revision, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || revision == 0 {
+		return fmt.Errorf("%w: invalid revision in %q", ErrInvalidSID, sid)
+	}
+
+	if _, err := parseAuthority(parts[2]); err != nil {
+		return fmt.Errorf("%w: invalid identifier authority in %q", ErrInvalidSID, sid)
+	}
+
+	subAuths := parts[3:]
+	if len(subAuths) > o.maxSubAuthorities {
+		return fmt.Errorf("%w: %d sub-authorities exceeds maximum of %d", ErrInvalidSID, len(subAuths), o.maxSubAuthorities)
+	}
+
+	for _, sub := range subAuths {
+		if _, err := strconv.ParseUint(sub, 10, 32); err != nil {
+			return fmt.Errorf("%w: invalid sub-authority %q in %q", ErrInvalidSID, sub, sid)
+		}
+	}
+
+	return nil
+}
+
+// ValidateSIDs runs ValidateSID over a batch, returning one error per SID in input order,
+// nil where the SID is valid, so callers can reject bad input before converting any of it
+func ValidateSIDs(sids []string, opts ...SIDOption) []error {
+	errs := make([]error, len(sids))
+	for i, sid := range sids {
+		errs[i] = ValidateSID(sid, opts...)
+	}
+	return errs
+}
+
+// checkSIDComponents rejects a string SID with an empty component, as left by a leading,
+// trailing or doubled dash, naming the component that is missing
+// Empty and whitespace-only input is reported as such before it can reach the library
+func checkSIDComponents(sid string) error {
+	if strings.TrimSpace(sid) == "" {
+		return fmt.Errorf("%w: SID is empty", ErrInvalidSID)
+	}
+
+	for i, part := range strings.Split(sid, "-") {
+		if part != "" {
+			continue
+		}
+		var field string
+		switch i {
+		case 0:
+			field = "prefix"
+		case 1:
+			field = "revision"
+		case 2:
+			field = "identifier authority"
+		default:
+			field = fmt.Sprintf("sub-authority %d", i-2)
+		}
+		return fmt.Errorf("%w: empty %s in %q", ErrInvalidSID, field, sid)
+	}
+
+	return nil
+}
+
+// parseAuthority parses a decimal or 0x-prefixed hexadecimal identifier authority
+func parseAuthority(s string) (uint64, error) {
+	var (
+		authority uint64
+		err       error
+	)
+	if hexDigits, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		authority, err = strconv.ParseUint(hexDigits, 16, 48)
+	} else {
+		authority, err = strconv.ParseUint(s, 10, 48)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if authority > maxAuthority {
+		return 0, fmt.Errorf("authority %d out of range", authority)
+	}
+	return authority, nil
+}
+
+// DomainSIDOf returns the domain portion of an account SID, i.e. everything but the trailing RID
+func DomainSIDOf(sid string) (string, error) {
+	if err := ValidateSID(sid); err != nil {
+		return "", err
+	}
+
+	i := strings.LastIndex(sid, "-")
+	domainSID := sid[:i]
+	if strings.Count(domainSID, "-") < 3 {
+		return "", fmt.Errorf("%w: %q has no RID", ErrInvalidSID, sid)
+	}
+
+	return domainSID, nil
+}
+
+// SameDomain reports whether two account SIDs have the same domain portion per DomainSIDOf
+func SameDomain(a, b string) (bool, error) {
+	domainA, err := DomainSIDOf(a)
+	if err != nil {
+		return false, err
+	}
+	domainB, err := DomainSIDOf(b)
+	if err != nil {
+		return false, err
+	}
+	return domainA == domainB, nil
+}
+
+// binSIDHeaderLen is the size of the revision, sub-authority count and authority of a binary SID
+const binSIDHeaderLen = 8
+
+// SubAuthOrder is the byte order of the sub-authorities in a binary SID
+// Standard objectSid values store them little-endian, while the authority is always big-endian
+type SubAuthOrder int
+
+const (
+	// SubAuthLittleEndian is the standard objectSid layout defined by Microsoft
+	SubAuthLittleEndian SubAuthOrder = iota
+	// SubAuthBigEndian decodes sub-authorities that were byte-swapped
+	SubAuthBigEndian
+)
+
+// byteOrder returns the encoding/binary byte order for o
+func (o SubAuthOrder) byteOrder() binary.ByteOrder {
+	if o == SubAuthBigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// checkBinSID verifies that a binary SID is complete: a non-zero revision, at most
+// maxSubAuthorities sub-authorities, and exactly as many bytes as the count implies
+// It catches SIDs truncated by a buffer limit before they reach the SSS library
+func checkBinSID(sid []byte) error {
+	if len(sid) < binSIDHeaderLen {
+		return fmt.Errorf("%w: binary SID too short: %d bytes", ErrInvalidSID, len(sid))
+	}
+
+	if sid[0] == 0 {
+		return fmt.Errorf("%w: invalid binary SID revision 0", ErrInvalidSID)
+	}
+
+	subAuthCount := int(sid[1])
+	if subAuthCount > maxSubAuthorities {
+		return fmt.Errorf("%w: %d sub-authorities exceeds maximum of %d", ErrInvalidSID, subAuthCount, maxSubAuthorities)
+	}
+
+	if expectedLen := binSIDHeaderLen + subAuthCount*4; len(sid) != expectedLen {
+		return fmt.Errorf("%w: invalid binary SID length: expected %d, got %d", ErrInvalidSID, expectedLen, len(sid))
+	}
+
+	return nil
+}
+
+// SID is a parsed security identifier, for callers that handle SIDs as typed values and
+// want to avoid re-parsing strings in hot loops
+type SID struct {
+	Revision       uint8
+	Authority      uint64
+	SubAuthorities []uint32
+}
+
+// ParseSID parses a string SID as accepted by ValidateSID with the same options
+func ParseSID(s string, opts ...SIDOption) (*SID, error) {
+	if err := ValidateSID(s, opts...); err != nil {
+		return nil, err
+	}
+
+	// ValidateSID has checked every component, so the parses below cannot fail
+	parts := strings.Split(s, "-")
+	revision, _ := strconv.ParseUint(parts[1], 10, 8)
+	authority, _ := parseAuthority(parts[2])
+	sid := &SID{
+		Revision:       uint8(revision),
+		Authority:      authority,
+		SubAuthorities: make([]uint32, len(parts)-3),
+	}
+	for i, part := range parts[3:] {
+		sub, _ := strconv.ParseUint(part, 10, 32)
+		sid.SubAuthorities[i] = uint32(sub)
+	}
+
+	return sid, nil
+}
+
+// String returns the S-R-A-S1-S2-... form of s
+func (s *SID) String() string {
+	return string(appendSID(nil, s.appendBinary(nil), len(s.SubAuthorities), SubAuthLittleEndian, sidOptions{}))
+}
+
+// appendBinary appends the binary objectSid form of s to dst
+func (s *SID) appendBinary(dst []byte) []byte {
+	dst = append(dst, s.Revision, byte(len(s.SubAuthorities)))
+	for i := 5; i >= 0; i-- {
+		dst = append(dst, byte(s.Authority>>(8*uint(i))))
+	}
+	for _, sub := range s.SubAuthorities {
+		dst = binary.LittleEndian.AppendUint32(dst, sub)
+	}
+	return dst
+}
+
+// domainSIDPrefix is the prefix of AD domain SIDs, S-1-5-21-X-Y-Z
+const domainSIDPrefix = "S-1-5-21-"
+
+// BuildSID appends rid to domainSID, returning the account SID
+// An AD domain SID (S-1-5-21-X-Y-Z) that already ends in a RID is rejected, which catches
+// callers passing an account SID where a domain SID was expected
+func BuildSID(domainSID string, rid uint32) (string, error) {
+	if err := ValidateSID(domainSID); err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(domainSID, domainSIDPrefix) && strings.Count(domainSID, "-") != 6 {
+		return "", fmt.Errorf("%w: %q is not a domain SID of the form S-1-5-21-X-Y-Z", ErrInvalidSID, domainSID)
+	}
+
+	return domainSID + "-" + strconv.FormatUint(uint64(rid), 10), nil
+}
+
+// StripSIDAnnotation splits a SID from trailing metadata in the forms "SID#annotation" or
+// "SID (annotation)", as found in inventory exports; input without one is returned trimmed
+func StripSIDAnnotation(s string) (sid, annotation string) {
+	s = strings.TrimSpace(s)
+
+	if before, after, ok := strings.Cut(s, "#"); ok {
+		return strings.TrimSpace(before), strings.TrimSpace(after)
+	}
+
+	if strings.HasSuffix(s, ")") {
+		if i := strings.LastIndex(s, " ("); i >= 0 {
+			return strings.TrimSpace(s[:i]), s[i+2 : len(s)-1]
+		}
+	}
+
+	return s, ""
+}
+
+// SIDFromUTF16 decodes a string SID exported by Windows tools as UTF-16 and validates it
+// A byte order mark selects the byte order, defaulting to little-endian without one, and a
+// trailing NUL terminator is ignored
+func SIDFromUTF16(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", fmt.Errorf("%w: odd UTF-16 length %d", ErrInvalidSID, len(b))
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	switch {
+	case len(b) >= 2 && b[0] == 0xff && b[1] == 0xfe:
+		b = b[2:]
+	case len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff:
+		order = binary.BigEndian
+		b = b[2:]
+	}
+
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[2*i:])
+	}
+	if n := len(units); n > 0 && units[n-1] == 0 {
+		units = units[:n-1]
+	}
+
+	sid := string(utf16.Decode(units))
+	if err := ValidateSID(sid); err != nil {
+		return "", err
+	}
+
+	return sid, nil
+}
+
+// SIDFromLDAPValue decodes an objectSid value as go-ldap returns it from
+// Entry.GetAttributeValue: a Go string holding the raw binary SID, not text
+// Use DecodeSID directly on the []byte from Entry.GetRawAttributeValue
+func SIDFromLDAPValue(v string, opts ...SIDOption) (string, error) {
+	return DecodeSID([]byte(v), opts...)
+}
+
+// DecodeResult is the outcome of decoding one binary SID in a batch
+type DecodeResult struct {
+	SID string
+	Err error
+}
+
+// DecodeSIDs decodes a batch of binary SIDs, returning one result per blob in input order
+// A corrupt blob only fails its own result
+func DecodeSIDs(blobs [][]byte) []DecodeResult {
+	results := make([]DecodeResult, len(blobs))
+	interner := newSIDInterner()
+	for i, blob := range blobs {
+		results[i].SID, results[i].Err = interner.decode(blob)
+	}
+	return results
+}
+
+// EncodeSID converts a string SID to its binary objectSid form, the inverse of DecodeSID
+// The authority may be decimal or 0x-prefixed hexadecimal, as ValidateSID accepts
+func EncodeSID(sid string) ([]byte, error) {
+	if err := ValidateSID(sid); err != nil {
+		return nil, err
+	}
+
+	// ValidateSID has checked every component, so the parses below cannot fail
+	parts := strings.Split(sid, "-")
+	revision, _ := strconv.ParseUint(parts[1], 10, 8)
+	authority, _ := parseAuthority(parts[2])
+	subAuths := parts[3:]
+
+	buf := make([]byte, binSIDHeaderLen+4*len(subAuths))
+	buf[0] = byte(revision)
+	buf[1] = byte(len(subAuths))
+
+	// The 48-bit authority is big-endian
+	for i := 0; i < 6; i++ {
+		buf[2+i] = byte(authority >> (8 * uint(5-i)))
+	}
+
+	offset := binSIDHeaderLen
+	for _, s := range subAuths {
+		sub, _ := strconv.ParseUint(s, 10, 32)
+		binary.LittleEndian.PutUint32(buf[offset:], uint32(sub))
+		offset += 4
+	}
+
+	return buf, nil
+}
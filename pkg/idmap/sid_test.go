@@ -0,0 +1,516 @@
+package idmap_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestValidateSID(t *testing.T) {
+	tests := []struct {
+		name    string
+		sid     string
+		wantErr bool
+	}{
+		{name: "domain user", sid: "S-1-5-21-3623811015-3361044348-30300820-1013"},
+		{name: "well-known", sid: "S-1-1-0"},
+		{name: "no sub-authorities", sid: "S-1-5"},
+		{name: "hex authority", sid: "S-1-0x010000000000-1"},
+		{name: "empty", sid: "", wantErr: true},
+		{name: "missing prefix", sid: "1-5-21-1", wantErr: true},
+		{name: "lowercase prefix", sid: "s-1-5-18", wantErr: true},
+		{name: "zero revision", sid: "S-0-5-18", wantErr: true},
+		{name: "authority too large", sid: "S-1-281474976710656-1", wantErr: true},
+		{name: "non-numeric sub-authority", sid: "S-1-5-21-abc", wantErr: true},
+		{name: "sub-authority overflow", sid: "S-1-5-21-4294967296", wantErr: true},
+		{name: "too many sub-authorities", sid: "S-1-5-1-2-3-4-5-6-7-8-9-10-11-12-13-14-15-16", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := idmap.ValidateSID(tt.sid)
+			if tt.wantErr {
+				if !errors.Is(err, idmap.ErrInvalidSID) {
+					t.Errorf("ValidateSID(%q) = %v, want ErrInvalidSID", tt.sid, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ValidateSID(%q) unexpected error: %v", tt.sid, err)
+			}
+		})
+	}
+}
+
+func TestValidateSIDs(t *testing.T) {
+	sids := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"not-a-sid",
+		"S-1-1-0",
+		"",
+		"S-1-5-21--1013",
+		"S-1-5-32-544",
+	}
+	wantInvalid := []bool{false, true, false, true, true, false}
+
+	errs := idmap.ValidateSIDs(sids)
+	if len(errs) != len(sids) {
+		t.Fatalf("ValidateSIDs() returned %d errors, want %d", len(errs), len(sids))
+	}
+	for i, err := range errs {
+		if wantInvalid[i] && !errors.Is(err, idmap.ErrInvalidSID) {
+			t.Errorf("ValidateSIDs()[%d] (%q) = %v, want ErrInvalidSID", i, sids[i], err)
+		}
+		if !wantInvalid[i] && err != nil {
+			t.Errorf("ValidateSIDs()[%d] (%q) = %v, want nil", i, sids[i], err)
+		}
+	}
+}
+
+func TestValidateSID_EmptyComponent(t *testing.T) {
+	requireLibrary(t)
+
+	tests := []struct {
+		name      string
+		sid       string
+		wantField string
+	}{
+		{name: "double dash", sid: "S-1-5-21--1013", wantField: "empty sub-authority 2"},
+		{name: "trailing dash", sid: "S-1-5-21-3623811015-3361044348-30300820-", wantField: "empty sub-authority 5"},
+		{name: "leading dash", sid: "-S-1-5-21-1013", wantField: "empty prefix"},
+		{name: "missing revision", sid: "S--5-18", wantField: "empty revision"},
+		{name: "missing authority", sid: "S-1--18", wantField: "empty identifier authority"},
+	}
+
+	ctx := newExampleContext(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := idmap.ValidateSID(tt.sid)
+			if !errors.Is(err, idmap.ErrInvalidSID) {
+				t.Fatalf("ValidateSID(%q) = %v, want ErrInvalidSID", tt.sid, err)
+			}
+			if !strings.Contains(err.Error(), tt.wantField) {
+				t.Errorf("ValidateSID(%q) = %v, want it to name %q", tt.sid, err, tt.wantField)
+			}
+
+			_, err = ctx.SIDToUnixID(tt.sid)
+			if !errors.Is(err, idmap.ErrInvalidSID) || !strings.Contains(err.Error(), tt.wantField) {
+				t.Errorf("SIDToUnixID(%q) = %v, want ErrInvalidSID naming %q", tt.sid, err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestEmptySID(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	for _, sid := range []string{"", " ", "\t\n"} {
+		checks := map[string]error{
+			"ValidateSID":     idmap.ValidateSID(sid),
+			"CheckSIDUnix":    ctx.CheckSIDUnix(sid, 11013),
+			"VerifyRoundTrip": ctx.VerifyRoundTrip(sid),
+		}
+		_, checks["SIDToUnixID"] = ctx.SIDToUnixID(sid)
+		_, checks["SIDToOffset"] = ctx.SIDToOffset(sid)
+		_, checks["ParseSID"] = idmap.ParseSID(sid)
+
+		for name, err := range checks {
+			if !errors.Is(err, idmap.ErrInvalidSID) || !strings.Contains(err.Error(), "SID is empty") {
+				t.Errorf("%s(%q) = %v, want ErrInvalidSID saying the SID is empty", name, sid, err)
+			}
+			var idmapErr *idmap.IDMapError
+			if errors.As(err, &idmapErr) {
+				t.Errorf("%s(%q) reached the library: %v", name, sid, err)
+			}
+		}
+	}
+}
+
+func TestDomainSIDOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		sid     string
+		want    string
+		wantErr bool
+	}{
+		{name: "domain user", sid: "S-1-5-21-3623811015-3361044348-30300820-1013", want: "S-1-5-21-3623811015-3361044348-30300820"},
+		{name: "builtin group", sid: "S-1-5-32-544", want: "S-1-5-32"},
+		{name: "no RID", sid: "S-1-5", wantErr: true},
+		{name: "authority only sub-authority", sid: "S-1-5-18", wantErr: true},
+		{name: "invalid", sid: "not-a-sid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idmap.DomainSIDOf(tt.sid)
+			if tt.wantErr {
+				if !errors.Is(err, idmap.ErrInvalidSID) {
+					t.Errorf("DomainSIDOf(%q) = %q, %v, want ErrInvalidSID", tt.sid, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DomainSIDOf(%q) unexpected error: %v", tt.sid, err)
+			}
+			if got != tt.want {
+				t.Errorf("DomainSIDOf(%q) = %q, want %q", tt.sid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "same domain", a: "S-1-5-21-3623811015-3361044348-30300820-1013", b: "S-1-5-21-3623811015-3361044348-30300820-500", want: true},
+		{name: "same SID", a: "S-1-5-32-544", b: "S-1-5-32-544", want: true},
+		{name: "different domains", a: "S-1-5-21-3623811015-3361044348-30300820-1013", b: "S-1-5-21-1111111111-2222222222-3333333333-1013", want: false},
+		{name: "builtin and domain", a: "S-1-5-32-544", b: "S-1-5-21-3623811015-3361044348-30300820-544", want: false},
+		{name: "invalid first", a: "not-a-sid", b: "S-1-5-32-544", wantErr: true},
+		{name: "second without RID", a: "S-1-5-32-544", b: "S-1-5-18", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idmap.SameDomain(tt.a, tt.b)
+			if tt.wantErr {
+				if !errors.Is(err, idmap.ErrInvalidSID) {
+					t.Errorf("SameDomain(%q, %q) = %v, %v, want ErrInvalidSID", tt.a, tt.b, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SameDomain(%q, %q) unexpected error: %v", tt.a, tt.b, err)
+			}
+			if got != tt.want {
+				t.Errorf("SameDomain(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSID(t *testing.T) {
+	tests := []struct {
+		name      string
+		domainSID string
+		rid       uint32
+		want      string
+		wantErr   bool
+	}{
+		{name: "user", domainSID: "S-1-5-21-3623811015-3361044348-30300820", rid: 1013, want: "S-1-5-21-3623811015-3361044348-30300820-1013"},
+		{name: "administrator", domainSID: "S-1-5-21-3623811015-3361044348-30300820", rid: 500, want: "S-1-5-21-3623811015-3361044348-30300820-500"},
+		{name: "zero RID", domainSID: "S-1-5-21-3623811015-3361044348-30300820", rid: 0, want: "S-1-5-21-3623811015-3361044348-30300820-0"},
+		{name: "max RID", domainSID: "S-1-5-21-3623811015-3361044348-30300820", rid: 4294967295, want: "S-1-5-21-3623811015-3361044348-30300820-4294967295"},
+		{name: "builtin domain", domainSID: "S-1-5-32", rid: 544, want: "S-1-5-32-544"},
+		{name: "domain SID already has a RID", domainSID: "S-1-5-21-3623811015-3361044348-30300820-1013", rid: 513, wantErr: true},
+		{name: "truncated domain SID", domainSID: "S-1-5-21-3623811015", rid: 513, wantErr: true},
+		{name: "invalid", domainSID: "not-a-sid", rid: 513, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idmap.BuildSID(tt.domainSID, tt.rid)
+			if tt.wantErr {
+				if !errors.Is(err, idmap.ErrInvalidSID) {
+					t.Errorf("BuildSID(%q, %d) = %q, %v, want ErrInvalidSID", tt.domainSID, tt.rid, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildSID(%q, %d) unexpected error: %v", tt.domainSID, tt.rid, err)
+			}
+			if got != tt.want {
+				t.Errorf("BuildSID(%q, %d) = %q, want %q", tt.domainSID, tt.rid, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripSIDAnnotation(t *testing.T) {
+	tests := []struct {
+		in             string
+		wantSID        string
+		wantAnnotation string
+	}{
+		{in: "S-1-5-21-3623811015-3361044348-30300820-1013", wantSID: "S-1-5-21-3623811015-3361044348-30300820-1013"},
+		{in: "S-1-5-21-3623811015-3361044348-30300820-1013#jsmith", wantSID: "S-1-5-21-3623811015-3361044348-30300820-1013", wantAnnotation: "jsmith"},
+		{in: "S-1-5-21-3623811015-3361044348-30300820-1013 # jsmith ", wantSID: "S-1-5-21-3623811015-3361044348-30300820-1013", wantAnnotation: "jsmith"},
+		{in: "S-1-5-21-3623811015-3361044348-30300820-1013 (John Smith)", wantSID: "S-1-5-21-3623811015-3361044348-30300820-1013", wantAnnotation: "John Smith"},
+		{in: "  S-1-5-18\n", wantSID: "S-1-5-18"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			sid, annotation := idmap.StripSIDAnnotation(tt.in)
+			if sid != tt.wantSID || annotation != tt.wantAnnotation {
+				t.Errorf("StripSIDAnnotation(%q) = %q, %q, want %q, %q", tt.in, sid, annotation, tt.wantSID, tt.wantAnnotation)
+			}
+		})
+	}
+}
+
+func TestSIDFromUTF16(t *testing.T) {
+	const sid = "S-1-5-21-3623811015-3361044348-30300820-1013"
+
+	utf16LE := func(s string) []byte {
+		var b []byte
+		for _, r := range s {
+			b = append(b, byte(r), 0)
+		}
+		return b
+	}
+	utf16BE := func(s string) []byte {
+		var b []byte
+		for _, r := range s {
+			b = append(b, 0, byte(r))
+		}
+		return b
+	}
+
+	tests := []struct {
+		name    string
+		in      []byte
+		wantErr bool
+	}{
+		{name: "little-endian without BOM", in: utf16LE(sid)},
+		{name: "little-endian with BOM", in: append([]byte{0xff, 0xfe}, utf16LE(sid)...)},
+		{name: "big-endian with BOM", in: append([]byte{0xfe, 0xff}, utf16BE(sid)...)},
+		{name: "NUL terminated", in: append(utf16LE(sid), 0, 0)},
+		{name: "odd length", in: utf16LE(sid)[1:], wantErr: true},
+		{name: "big-endian without BOM", in: utf16BE(sid), wantErr: true},
+		{name: "not a SID", in: utf16LE("hello"), wantErr: true},
+		{name: "empty", in: nil, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idmap.SIDFromUTF16(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, idmap.ErrInvalidSID) {
+					t.Errorf("SIDFromUTF16() = %q, %v, want ErrInvalidSID", got, err)
+				}
+				return
+			}
+			if err != nil || got != sid {
+				t.Errorf("SIDFromUTF16() = %q, %v, want %q", got, err, sid)
+			}
+		})
+	}
+}
+
+func TestDecodeSIDs(t *testing.T) {
+	hexBlobs := []string{
+		"010500000000000515000000c7f7fed77c7755c8945ace01f4010000",
+		"010500000000000515000000", // header claims 5 sub-authorities, data missing
+		"010100000000000100000000",
+	}
+	blobs := make([][]byte, len(hexBlobs))
+	for i, h := range hexBlobs {
+		blobs[i], _ = hex.DecodeString(h)
+	}
+
+	results := idmap.DecodeSIDs(blobs)
+	if len(results) != len(blobs) {
+		t.Fatalf("DecodeSIDs() returned %d results, want %d", len(results), len(blobs))
+	}
+
+	if results[0].Err != nil || results[0].SID != "S-1-5-21-3623811015-3361044348-30300820-500" {
+		t.Errorf("results[0] = %+v, want EXAMPLE administrator", results[0])
+	}
+	if results[1].Err == nil {
+		t.Errorf("results[1] = %+v, want error for corrupt blob", results[1])
+	}
+	if results[2].Err != nil || results[2].SID != "S-1-1-0" {
+		t.Errorf("results[2] = %+v, want Everyone", results[2])
+	}
+}
+
+func BenchmarkDecodeSIDs(b *testing.B) {
+	blob, _ := hex.DecodeString("010500000000000515000000c7f7fed77c7755c8945ace01f5030000")
+	blobs := make([][]byte, 1000)
+	for i := range blobs {
+		blobs[i] = blob
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		idmap.DecodeSIDs(blobs)
+	}
+}
+
+func TestEncodeSID(t *testing.T) {
+	tests := []struct {
+		sid     string
+		wantHex string
+		wantErr bool
+	}{
+		{sid: "S-1-5-21-3623811015-3361044348-30300820-500", wantHex: "010500000000000515000000c7f7fed77c7755c8945ace01f4010000"},
+		{sid: "S-1-1-0", wantHex: "010100000000000100000000"},
+		{sid: "S-1-5-32-544", wantHex: "01020000000000052000000020020000"},
+		{sid: "S-1-0x5-18", wantHex: "010100000000000512000000"},
+		{sid: "S-1-5", wantHex: "0100000000000005"},
+		{sid: "S-1-5-21-4444444444", wantErr: true},
+		{sid: "not-a-sid", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sid, func(t *testing.T) {
+			got, err := idmap.EncodeSID(tt.sid)
+			if tt.wantErr {
+				if !errors.Is(err, idmap.ErrInvalidSID) {
+					t.Errorf("EncodeSID() error = %v, want ErrInvalidSID", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EncodeSID() error = %v", err)
+			}
+			if gotHex := hex.EncodeToString(got); gotHex != tt.wantHex {
+				t.Errorf("EncodeSID() = %s, want %s", gotHex, tt.wantHex)
+			}
+		})
+	}
+}
+
+func FuzzDecodeSID(f *testing.F) {
+	for _, h := range []string{
+		"010500000000000515000000c7f7fed77c7755c8945ace01f5030000",
+		"010500000000000515000000c7f7fed77c7755c8945ace01f4010000",
+		"01050000000000051500000025ec493a619500b06dc9700a2fe80500",
+		"01020000000000052000000020020000",
+		"010100000000000100000000",
+		"010100000000000512000000",
+		"010500000000000515000000",
+	} {
+		blob, _ := hex.DecodeString(h)
+		f.Add(blob)
+	}
+
+	f.Fuzz(func(t *testing.T, blob []byte) {
+		sid, err := idmap.DecodeSID(blob)
+		if err != nil {
+			return
+		}
+
+		encoded, err := idmap.EncodeSID(sid)
+		if err != nil {
+			t.Fatalf("EncodeSID(%q) error = %v", sid, err)
+		}
+		if !bytes.Equal(encoded, blob) {
+			t.Errorf("EncodeSID(DecodeSID(%x)) = %x", blob, encoded)
+		}
+	})
+}
+
+func TestParseSID(t *testing.T) {
+	tests := []struct {
+		s    string
+		want idmap.SID
+	}{
+		{s: "S-1-5-21-3623811015-3361044348-30300820-1013", want: idmap.SID{Revision: 1, Authority: 5, SubAuthorities: []uint32{21, 3623811015, 3361044348, 30300820, 1013}}},
+		{s: "S-1-1-0", want: idmap.SID{Revision: 1, Authority: 1, SubAuthorities: []uint32{0}}},
+		{s: "S-1-5", want: idmap.SID{Revision: 1, Authority: 5, SubAuthorities: []uint32{}}},
+		{s: "S-1-0x010000000000-1", want: idmap.SID{Revision: 1, Authority: 1 << 40, SubAuthorities: []uint32{1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := idmap.ParseSID(tt.s)
+			if err != nil {
+				t.Fatalf("ParseSID() error = %v", err)
+			}
+			if got.Revision != tt.want.Revision || got.Authority != tt.want.Authority || !slices.Equal(got.SubAuthorities, tt.want.SubAuthorities) {
+				t.Errorf("ParseSID() = %+v, want %+v", got, tt.want)
+			}
+			if want, _ := idmap.DecodeSID(mustEncodeSID(t, tt.s)); got.String() != want {
+				t.Errorf("String() = %q, want %q", got.String(), want)
+			}
+		})
+	}
+
+	if _, err := idmap.ParseSID("S-1-5-21--1013"); !errors.Is(err, idmap.ErrInvalidSID) {
+		t.Errorf("ParseSID() = %v, want ErrInvalidSID", err)
+	}
+}
+
+// mustEncodeSID is EncodeSID for fixtures known to be valid
+func mustEncodeSID(t *testing.T, sid string) []byte {
+	t.Helper()
+
+	b, err := idmap.EncodeSID(sid)
+	if err != nil {
+		t.Fatalf("EncodeSID(%q) failed: %v", sid, err)
+	}
+	return b
+}
+
+func TestWithMaxSubAuthorities(t *testing.T) {
+	sid15 := "S-1-5-1-2-3-4-5-6-7-8-9-10-11-12-13-14-15"
+	sid16 := sid15 + "-16"
+	user := "S-1-5-21-3623811015-3361044348-30300820-1013"
+
+	tests := []struct {
+		name    string
+		sid     string
+		opts    []idmap.SIDOption
+		wantErr bool
+	}{
+		{name: "15 by default", sid: sid15},
+		{name: "16 by default", sid: sid16, wantErr: true},
+		{name: "15 with cap above the format limit", sid: sid15, opts: []idmap.SIDOption{idmap.WithMaxSubAuthorities(20)}},
+		{name: "16 with cap above the format limit", sid: sid16, opts: []idmap.SIDOption{idmap.WithMaxSubAuthorities(20)}, wantErr: true},
+		{name: "5 with cap 5", sid: user, opts: []idmap.SIDOption{idmap.WithMaxSubAuthorities(5)}},
+		{name: "5 with cap 4", sid: user, opts: []idmap.SIDOption{idmap.WithMaxSubAuthorities(4)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := map[string]error{
+				"ValidateSID": idmap.ValidateSID(tt.sid, tt.opts...),
+			}
+			_, errs["ParseSID"] = idmap.ParseSID(tt.sid, tt.opts...)
+
+			// Only SIDs the format allows can be encoded for DecodeSID
+			if encoded, err := idmap.EncodeSID(tt.sid); err == nil {
+				_, errs["DecodeSID"] = idmap.DecodeSID(encoded, tt.opts...)
+			}
+
+			for name, err := range errs {
+				if tt.wantErr && !errors.Is(err, idmap.ErrInvalidSID) {
+					t.Errorf("%s(%q) = %v, want ErrInvalidSID", name, tt.sid, err)
+				}
+				if !tt.wantErr && err != nil {
+					t.Errorf("%s(%q) unexpected error: %v", name, tt.sid, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSIDFromLDAPValue(t *testing.T) {
+	// go-ldap hands objectSid back as a string of the raw bytes
+	raw := string(mustEncodeSID(t, "S-1-5-21-3623811015-3361044348-30300820-1013"))
+
+	got, err := idmap.SIDFromLDAPValue(raw)
+	if err != nil || got != "S-1-5-21-3623811015-3361044348-30300820-1013" {
+		t.Errorf("SIDFromLDAPValue() = %q, %v, want the EXAMPLE user 1013 SID", got, err)
+	}
+
+	for _, bad := range []string{"", "S-1-5-21-3623811015-3361044348-30300820-1013", raw[:len(raw)-1]} {
+		if got, err := idmap.SIDFromLDAPValue(bad); !errors.Is(err, idmap.ErrInvalidSID) {
+			t.Errorf("SIDFromLDAPValue(%q) = %q, %v, want ErrInvalidSID", bad, got, err)
+		}
+	}
+}
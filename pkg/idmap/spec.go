@@ -0,0 +1,68 @@
+package idmap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseDomainSpec parses a single-string domain configuration of the form
+// NAME:SID:MIN-MAX, or SID:MIN-MAX in which case the SID doubles as the name
+// The range may also be written MIN:MAX as ParseIDRange accepts
+func ParseDomainSpec(s string) (DomainConfig, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), ":", 3)
+
+	var config DomainConfig
+	var rangeSpec string
+	switch {
+	case len(parts) == 2:
+		config.DomainName, config.DomainSID, rangeSpec = parts[0], parts[0], parts[1]
+	case len(parts) == 3 && ValidateSID(parts[1]) != nil && ValidateSID(parts[0]) == nil:
+		// SID:MIN:MAX
+		config.DomainName, config.DomainSID, rangeSpec = parts[0], parts[0], parts[1]+":"+parts[2]
+	case len(parts) == 3:
+		config.DomainName, config.DomainSID, rangeSpec = parts[0], parts[1], parts[2]
+	default:
+		return DomainConfig{}, fmt.Errorf("domain spec %q: want NAME:SID:MIN-MAX or SID:MIN-MAX", s)
+	}
+
+	if config.DomainName == "" {
+		return DomainConfig{}, fmt.Errorf("domain spec %q: %w: domain name is empty", s, ErrInvalidConfig)
+	}
+
+	if err := ValidateSID(config.DomainSID); err != nil {
+		return DomainConfig{}, fmt.Errorf("domain spec %q: SID: %w", s, err)
+	}
+
+	idRange, err := ParseIDRange(rangeSpec)
+	if err != nil {
+		return DomainConfig{}, fmt.Errorf("domain spec %q: range: %w", s, err)
+	}
+	config.IDRange = idRange
+
+	return config, nil
+}
+
+// ParseIDRange parses a range of Unix IDs written as MIN-MAX or MIN:MAX, such as
+// "10000-20000"; min must be less than max
+func ParseIDRange(s string) (IDRange, error) {
+	sep := strings.IndexAny(s, "-:")
+	if sep < 0 {
+		return IDRange{}, fmt.Errorf("%w: %q is not MIN-MAX or MIN:MAX", ErrInvalidRange, s)
+	}
+	minStr, maxStr := s[:sep], s[sep+1:]
+
+	lo, err := strconv.ParseUint(minStr, 10, 32)
+	if err != nil {
+		return IDRange{}, fmt.Errorf("%w: invalid min %q", ErrInvalidRange, minStr)
+	}
+	hi, err := strconv.ParseUint(maxStr, 10, 32)
+	if err != nil {
+		return IDRange{}, fmt.Errorf("%w: invalid max %q", ErrInvalidRange, maxStr)
+	}
+	if lo >= hi {
+		return IDRange{}, fmt.Errorf("%w: min (%d) must be less than max (%d)", ErrInvalidRange, lo, hi)
+	}
+
+	return IDRange{Min: uint32(lo), Max: uint32(hi)}, nil
+}
@@ -0,0 +1,146 @@
+package idmap_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestParseDomainSpec(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want idmap.DomainConfig
+	}{
+		{
+			name: "name, SID and range",
+			spec: "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-20000",
+			want: idmap.DomainConfig{
+				DomainName: "EXAMPLE",
+				DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+				IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+			},
+		},
+		{
+			name: "SID and range",
+			spec: "S-1-5-21-3623811015-3361044348-30300820:10000-20000",
+			want: idmap.DomainConfig{
+				DomainName: "S-1-5-21-3623811015-3361044348-30300820",
+				DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+				IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+			},
+		},
+		{
+			name: "name, SID and colon range",
+			spec: "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000:20000",
+			want: idmap.DomainConfig{
+				DomainName: "EXAMPLE",
+				DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+				IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+			},
+		},
+		{
+			name: "SID and colon range",
+			spec: "S-1-5-21-3623811015-3361044348-30300820:10000:20000",
+			want: idmap.DomainConfig{
+				DomainName: "S-1-5-21-3623811015-3361044348-30300820",
+				DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+				IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+			},
+		},
+		{
+			name: "surrounding whitespace",
+			spec: "  EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:200000-399999\n",
+			want: idmap.DomainConfig{
+				DomainName: "EXAMPLE",
+				DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+				IDRange:    idmap.IDRange{Min: 200000, Max: 399999},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idmap.ParseDomainSpec(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseDomainSpec(%q) failed: %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDomainSpec(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDomainSpec_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		spec      string
+		wantErr   error
+		wantField string
+	}{
+		{name: "empty", spec: ""},
+		{name: "too many fields", spec: "A:B:C:10000-20000"},
+		{name: "too many range fields", spec: "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000:20000:30000", wantErr: idmap.ErrInvalidRange, wantField: "range"},
+		{name: "empty name", spec: ":S-1-5-21-3623811015-3361044348-30300820:10000-20000", wantErr: idmap.ErrInvalidConfig},
+		{name: "bad SID", spec: "EXAMPLE:S-1-x:10000-20000", wantErr: idmap.ErrInvalidSID, wantField: "SID"},
+		{name: "range without dash", spec: "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000", wantErr: idmap.ErrInvalidRange, wantField: "range"},
+		{name: "non-numeric max", spec: "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:10000-lots", wantErr: idmap.ErrInvalidRange, wantField: "max"},
+		{name: "min above max", spec: "EXAMPLE:S-1-5-21-3623811015-3361044348-30300820:20000-10000", wantErr: idmap.ErrInvalidRange, wantField: "range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := idmap.ParseDomainSpec(tt.spec)
+			if err == nil {
+				t.Fatalf("ParseDomainSpec(%q) expected error, got nil", tt.spec)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseDomainSpec(%q) = %v, want %v", tt.spec, err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantField) {
+				t.Errorf("ParseDomainSpec(%q) error %q does not name field %q", tt.spec, err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestParseIDRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    idmap.IDRange
+		wantErr bool
+	}{
+		{name: "dash", s: "10000-20000", want: idmap.IDRange{Min: 10000, Max: 20000}},
+		{name: "colon", s: "10000:20000", want: idmap.IDRange{Min: 10000, Max: 20000}},
+		{name: "zero min", s: "0-1", want: idmap.IDRange{Min: 0, Max: 1}},
+		{name: "max uint32", s: "1:4294967295", want: idmap.IDRange{Min: 1, Max: 4294967295}},
+		{name: "empty", s: "", wantErr: true},
+		{name: "no separator", s: "10000", wantErr: true},
+		{name: "missing min", s: "-20000", wantErr: true},
+		{name: "missing max", s: "10000:", wantErr: true},
+		{name: "non-numeric", s: "ten-twenty", wantErr: true},
+		{name: "overflow", s: "10000-4294967296", wantErr: true},
+		{name: "min equals max", s: "10000-10000", wantErr: true},
+		{name: "min above max", s: "20000:10000", wantErr: true},
+		{name: "mixed separators", s: "10000-20000:30000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idmap.ParseIDRange(tt.s)
+			if tt.wantErr {
+				if !errors.Is(err, idmap.ErrInvalidRange) {
+					t.Errorf("ParseIDRange(%q) = %v, %v, want ErrInvalidRange", tt.s, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseIDRange(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+			}
+		})
+	}
+}
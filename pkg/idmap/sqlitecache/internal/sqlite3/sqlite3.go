@@ -0,0 +1,178 @@
+//go:build sqlite3 && cgo
+
+// Package sqlite3 is a minimal database/sql driver over the system libsqlite3, registered
+// as "sqlite3", so the sqlitecache tests can run against real database files without
+// adding a driver module to go.mod
+// It supports what Cache issues: statements without transactions, binding strings and
+// integers and reading integer and text columns
+package sqlite3
+
+/*
+#cgo pkg-config: sqlite3
+#include <stdlib.h>
+#include <sqlite3.h>
+
+// bind_text copies s, as Go may free it before the statement runs
+static int bind_text(sqlite3_stmt *stmt, int i, const char *s, int n) {
+	return sqlite3_bind_text(stmt, i, s, n, SQLITE_TRANSIENT);
+}
+*/
+import "C"
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+func init() {
+	sql.Register("sqlite3", sqliteDriver{})
+}
+
+type sqliteDriver struct{}
+
+// Open opens or creates the database file name
+func (sqliteDriver) Open(name string) (driver.Conn, error) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	var db *C.sqlite3
+	rc := C.sqlite3_open_v2(cName, &db, C.SQLITE_OPEN_READWRITE|C.SQLITE_OPEN_CREATE, nil)
+	if rc != C.SQLITE_OK {
+		err := fmt.Errorf("sqlite3: open %s: %s", name, C.GoString(C.sqlite3_errstr(rc)))
+		C.sqlite3_close_v2(db)
+		return nil, err
+	}
+	return &conn{db: db}, nil
+}
+
+type conn struct {
+	db *C.sqlite3
+}
+
+// lastError returns the error of the most recent failed call on c
+func (c *conn) lastError(op string) error {
+	return fmt.Errorf("sqlite3: %s: %s", op, C.GoString(C.sqlite3_errmsg(c.db)))
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+
+	var s *C.sqlite3_stmt
+	if C.sqlite3_prepare_v2(c.db, cQuery, -1, &s, nil) != C.SQLITE_OK {
+		return nil, c.lastError("prepare")
+	}
+	return &stmt{c: c, s: s}, nil
+}
+
+func (c *conn) Close() error {
+	if C.sqlite3_close_v2(c.db) != C.SQLITE_OK {
+		return c.lastError("close")
+	}
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("sqlite3: transactions not supported")
+}
+
+type stmt struct {
+	c *conn
+	s *C.sqlite3_stmt
+}
+
+func (s *stmt) Close() error {
+	C.sqlite3_finalize(s.s)
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return int(C.sqlite3_bind_parameter_count(s.s))
+}
+
+// bind resets the statement and binds args to its parameters
+func (s *stmt) bind(args []driver.Value) error {
+	C.sqlite3_reset(s.s)
+	C.sqlite3_clear_bindings(s.s)
+	for i, arg := range args {
+		var rc C.int
+		switch v := arg.(type) {
+		case int64:
+			rc = C.sqlite3_bind_int64(s.s, C.int(i+1), C.sqlite3_int64(v))
+		case string:
+			cs := C.CString(v)
+			rc = C.bind_text(s.s, C.int(i+1), cs, C.int(len(v)))
+			C.free(unsafe.Pointer(cs))
+		default:
+			return fmt.Errorf("sqlite3: unsupported argument type %T", arg)
+		}
+		if rc != C.SQLITE_OK {
+			return s.c.lastError("bind")
+		}
+	}
+	return nil
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.bind(args); err != nil {
+		return nil, err
+	}
+	for {
+		switch C.sqlite3_step(s.s) {
+		case C.SQLITE_DONE:
+			return driver.RowsAffected(C.sqlite3_changes(s.c.db)), nil
+		case C.SQLITE_ROW:
+		default:
+			return nil, s.c.lastError("exec")
+		}
+	}
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.bind(args); err != nil {
+		return nil, err
+	}
+	return &rows{s: s}, nil
+}
+
+type rows struct {
+	s *stmt
+}
+
+func (r *rows) Columns() []string {
+	cols := make([]string, C.sqlite3_column_count(r.s.s))
+	for i := range cols {
+		cols[i] = C.GoString(C.sqlite3_column_name(r.s.s, C.int(i)))
+	}
+	return cols
+}
+
+func (r *rows) Close() error {
+	C.sqlite3_reset(r.s.s)
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	switch C.sqlite3_step(r.s.s) {
+	case C.SQLITE_DONE:
+		return io.EOF
+	case C.SQLITE_ROW:
+	default:
+		return r.s.c.lastError("query")
+	}
+
+	for i := range dest {
+		switch C.sqlite3_column_type(r.s.s, C.int(i)) {
+		case C.SQLITE_INTEGER:
+			dest[i] = int64(C.sqlite3_column_int64(r.s.s, C.int(i)))
+		case C.SQLITE_NULL:
+			dest[i] = nil
+		default:
+			dest[i] = C.GoString((*C.char)(unsafe.Pointer(C.sqlite3_column_text(r.s.s, C.int(i)))))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build sqlite3 && cgo
+
+package sqlitecache_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/ngharo/sss_idmap_ad2unix/pkg/idmap/sqlitecache/internal/sqlite3"
+)
+
+func TestCache_SecondRunReadsSQLiteFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mappings.db")
+	testSecondRunReadsFile(t, "sqlite3", file)
+
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatalf("sql.Open() failed: %v", err)
+	}
+	defer db.Close()
+
+	// Both runs' rows are in the file, under their own configuration
+	var rows, configs int
+	if err := db.QueryRow(`SELECT COUNT(*), COUNT(DISTINCT config) FROM mappings`).Scan(&rows, &configs); err != nil {
+		t.Fatalf("reading the mappings table failed: %v", err)
+	}
+	if rows != 4 || configs != 2 {
+		t.Errorf("mappings table has %d rows under %d configurations, want 4 under 2", rows, configs)
+	}
+}
@@ -0,0 +1,99 @@
+// Package sqlitecache persists idmap conversions in a SQLite database, so incremental jobs
+// that re-run skip the SIDs they have already mapped
+// It takes a *sql.DB instead of importing a driver, keeping SQLite out of the idmap module:
+// open the file with the SQLite driver of your choice (e.g. modernc.org/sqlite or
+// github.com/mattn/go-sqlite3) and pass it to New
+package sqlitecache
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// schema creates the mappings table if the file does not have it yet
+// Rows are keyed by the fingerprint of the configuration that produced them as well as the
+// SID, not by the SID alone: one file may serve jobs with different ranges, and each must
+// only read back the IDs of its own configuration
+const schema = `CREATE TABLE IF NOT EXISTS mappings (config TEXT NOT NULL, sid TEXT NOT NULL, unix_id INTEGER NOT NULL, PRIMARY KEY (config, sid))`
+
+// Cache is an idmap.IDMapper decorator that reads conversions from the mappings table and
+// stores the ones it has to compute
+// Only successful conversions are stored: a SID that fails may map once the configuration
+// is fixed, so it is retried on the next run
+// Binary SIDs are stored under their string form, sharing rows with string lookups
+type Cache struct {
+	db     *sql.DB
+	mapper idmap.IDMapper
+	config string
+}
+
+var _ idmap.IDMapper = (*Cache)(nil)
+
+// New wraps mapper with a cache stored in db, creating the mappings table if needed
+// config identifies the configuration mapper converts with, normally Fingerprint of it:
+// only rows stored under the same config are used, so changing a domain's range or the
+// context settings starts an empty cache rather than returning the IDs of the old one
+// Rows of other configurations stay in the table until deleted
+func New(db *sql.DB, mapper idmap.IDMapper, config string) (*Cache, error) {
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("failed to create mappings table: %w", err)
+	}
+	return &Cache{db: db, mapper: mapper, config: config}, nil
+}
+
+// Fingerprint identifies the mappings of a context with settings and domains, e.g. from
+// IDMapContext.Config and ListDomains; any change that can move an ID changes it
+// Domain order and the case of domain names do not matter
+func Fingerprint(settings idmap.ContextConfig, domains []idmap.DomainConfig) string {
+	domains = slices.Clone(domains)
+	slices.SortFunc(domains, func(a, b idmap.DomainConfig) int { return cmp.Compare(a.DomainSID, b.DomainSID) })
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%t %d %d %d\n", settings.Autorid, settings.Lower, settings.Upper, settings.RangeSize)
+	for _, d := range domains {
+		fmt.Fprintf(h, "%s %s %d %d %t %t\n", strings.ToUpper(d.DomainName), d.DomainSID,
+			d.IDRange.Min, d.IDRange.Max, d.ExternalMapping, d.AutoSlices)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SIDToUnixID returns the stored ID of sid, or converts it with the wrapped mapper and
+// stores the result
+// Database failures are reported as idmap.ErrInternal
+func (c *Cache) SIDToUnixID(sid string) (uint32, error) {
+	var stored int64
+	err := c.db.QueryRow(`SELECT unix_id FROM mappings WHERE config = ? AND sid = ?`, c.config, sid).Scan(&stored)
+	if err == nil {
+		return uint32(stored), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: failed to read cached mapping of %s: %w", idmap.ErrInternal, sid, err)
+	}
+
+	unixID, err := c.mapper.SIDToUnixID(sid)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := c.db.Exec(`INSERT OR REPLACE INTO mappings (config, sid, unix_id) VALUES (?, ?, ?)`, c.config, sid, int64(unixID)); err != nil {
+		return 0, fmt.Errorf("%w: failed to store mapping of %s: %w", idmap.ErrInternal, sid, err)
+	}
+	return unixID, nil
+}
+
+// BinSIDToUnixID decodes a binary SID and looks it up as SIDToUnixID does
+func (c *Cache) BinSIDToUnixID(sid []byte) (uint32, error) {
+	s, err := idmap.DecodeSID(sid)
+	if err != nil {
+		return 0, err
+	}
+	return c.SIDToUnixID(s)
+}
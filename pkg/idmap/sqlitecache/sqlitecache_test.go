@@ -0,0 +1,238 @@
+package sqlitecache_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap/idmaptest"
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap/sqlitecache"
+)
+
+// fakeSQLite is a database/sql driver that understands the three statements Cache issues,
+// storing each DSN's mappings table in memory as if it were a file, keyed by config and SID
+type fakeSQLite struct {
+	mu    sync.Mutex
+	files map[string]map[string]int64
+}
+
+var fakeDriver = &fakeSQLite{files: make(map[string]map[string]int64)}
+
+func init() {
+	sql.Register("fakesqlite", fakeDriver)
+}
+
+func (d *fakeSQLite) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.files[name] == nil {
+		d.files[name] = make(map[string]int64)
+	}
+	return &fakeConn{d: d, table: d.files[name]}, nil
+}
+
+type fakeConn struct {
+	d     *fakeSQLite
+	table map[string]int64
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("transactions not supported") }
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return strings.Count(s.query, "?") }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.c.d.mu.Lock()
+	defer s.c.d.mu.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+	case strings.HasPrefix(s.query, "INSERT"):
+		s.c.table[args[0].(string)+" "+args[1].(string)] = args[2].(int64)
+	default:
+		return nil, errors.New("unsupported statement: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.c.d.mu.Lock()
+	defer s.c.d.mu.Unlock()
+	if !strings.HasPrefix(s.query, "SELECT") {
+		return nil, errors.New("unsupported query: " + s.query)
+	}
+	rows := &fakeRows{}
+	if id, ok := s.c.table[args[0].(string)+" "+args[1].(string)]; ok {
+		rows.ids = []int64{id}
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	ids []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"unix_id"} }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.ids) == 0 {
+		return io.EOF
+	}
+	dest[0], r.ids = r.ids[0], r.ids[1:]
+	return nil
+}
+
+// countingMapper counts the conversions that reach the wrapped mapper
+type countingMapper struct {
+	idmap.IDMapper
+	calls int
+}
+
+func (m *countingMapper) SIDToUnixID(sid string) (uint32, error) {
+	m.calls++
+	return m.IDMapper.SIDToUnixID(sid)
+}
+
+var example = idmap.DomainConfig{
+	DomainName: "EXAMPLE",
+	DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+	IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+}
+
+// run converts sids through a Cache stored in file, opened with driverName, with the
+// domain config, as one run of a job would
+func run(t *testing.T, driverName, file string, config idmap.DomainConfig, sids []string) (ids []uint32, calls int) {
+	t.Helper()
+
+	db, err := sql.Open(driverName, file)
+	if err != nil {
+		t.Fatalf("sql.Open() failed: %v", err)
+	}
+	defer db.Close()
+
+	mapper := &countingMapper{IDMapper: idmaptest.NewFakeIDMap(config)}
+	cache, err := sqlitecache.New(db, mapper, sqlitecache.Fingerprint(idmap.DefaultSSSDOptions(), []idmap.DomainConfig{config}))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	for _, sid := range sids {
+		id, err := cache.SIDToUnixID(sid)
+		if err != nil {
+			t.Fatalf("SIDToUnixID(%q) failed: %v", sid, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, mapper.calls
+}
+
+func TestCache_SecondRunReadsFile(t *testing.T) {
+	testSecondRunReadsFile(t, "fakesqlite", t.Name()+".db")
+}
+
+// testSecondRunReadsFile runs a job twice on file and once more after a range change
+func testSecondRunReadsFile(t *testing.T, driverName, file string) {
+	sids := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+	}
+
+	first, calls := run(t, driverName, file, example, sids)
+	if calls != 2 {
+		t.Errorf("first run called the mapper %d times, want 2", calls)
+	}
+	if first[0] != 11013 || first[1] != 10500 {
+		t.Errorf("first run = %v, want [11013 10500]", first)
+	}
+
+	second, calls := run(t, driverName, file, example, sids)
+	if calls != 0 {
+		t.Errorf("second run called the mapper %d times, want 0", calls)
+	}
+	if second[0] != first[0] || second[1] != first[1] {
+		t.Errorf("second run = %v, want %v", second, first)
+	}
+
+	// A run with a changed range must not see the IDs stored under the old one
+	moved := example
+	moved.IDRange = idmap.IDRange{Min: 30000, Max: 40000}
+	third, calls := run(t, driverName, file, moved, sids)
+	if calls != 2 {
+		t.Errorf("run after a range change called the mapper %d times, want 2", calls)
+	}
+	if third[0] != 31013 || third[1] != 30500 {
+		t.Errorf("run after a range change = %v, want [31013 30500]", third)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	other := idmap.DomainConfig{
+		DomainName: "OTHER",
+		DomainSID:  "S-1-5-21-1111111111-2222222222-3333333333",
+		IDRange:    idmap.IDRange{Min: 30000, Max: 40000},
+	}
+	settings := idmap.DefaultSSSDOptions()
+	base := sqlitecache.Fingerprint(settings, []idmap.DomainConfig{example, other})
+
+	lower := example
+	lower.DomainName = "example"
+	if got := sqlitecache.Fingerprint(settings, []idmap.DomainConfig{other, lower}); got != base {
+		t.Errorf("Fingerprint() changed with domain order or name case: %s, want %s", got, base)
+	}
+
+	widened := example
+	widened.IDRange.Max = 25000
+	resized := settings
+	resized.RangeSize = 100000
+	for name, got := range map[string]string{
+		"range":      sqlitecache.Fingerprint(settings, []idmap.DomainConfig{widened, other}),
+		"settings":   sqlitecache.Fingerprint(resized, []idmap.DomainConfig{example, other}),
+		"domain set": sqlitecache.Fingerprint(settings, []idmap.DomainConfig{example}),
+	} {
+		if got == base {
+			t.Errorf("Fingerprint() unchanged after a %s change", name)
+		}
+	}
+}
+
+func TestCache_FailuresNotStored(t *testing.T) {
+	db, err := sql.Open("fakesqlite", t.Name()+".db")
+	if err != nil {
+		t.Fatalf("sql.Open() failed: %v", err)
+	}
+	defer db.Close()
+
+	mapper := &countingMapper{IDMapper: idmaptest.NewFakeIDMap(example)}
+	cache, err := sqlitecache.New(db, mapper, sqlitecache.Fingerprint(idmap.DefaultSSSDOptions(), []idmap.DomainConfig{example}))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	const unknown = "S-1-5-21-1234567890-1234567890-1234567890-1013"
+	for range 2 {
+		if _, err := cache.SIDToUnixID(unknown); !errors.Is(err, idmap.ErrNotFound) {
+			t.Errorf("SIDToUnixID(%q) = %v, want ErrNotFound", unknown, err)
+		}
+	}
+	if mapper.calls != 2 {
+		t.Errorf("mapper called %d times, want 2 since failures are retried", mapper.calls)
+	}
+}
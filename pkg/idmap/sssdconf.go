@@ -0,0 +1,230 @@
+package idmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SSSD's ID mapping defaults, which are also those of a fresh libsss_idmap context
+const (
+	// DefaultRangeMin is the default ldap_idmap_range_min, the lower bound of all slices
+	DefaultRangeMin = 200000
+	// DefaultRangeMax is the default ldap_idmap_range_max, the first ID past all slices
+	DefaultRangeMax = 2000200000
+	// DefaultRangeSize is the default ldap_idmap_range_size, the number of IDs per slice
+	DefaultRangeSize = 200000
+)
+
+// DefaultSSSDOptions returns the ID mapping settings SSSD uses when sssd.conf sets none,
+// for callers reproducing its behavior
+func DefaultSSSDOptions() ContextConfig {
+	return ContextConfig{
+		Autorid:   false,
+		Lower:     DefaultRangeMin,
+		Upper:     DefaultRangeMax,
+		RangeSize: DefaultRangeSize,
+	}
+}
+
+// SSSDConfDomain is an ID-mapped [domain/NAME] section of an sssd.conf
+// DomainSID is only set when the section pins ldap_idmap_default_domain_sid;
+// otherwise SSSD learns it from AD at runtime
+type SSSDConfDomain struct {
+	DomainConfig
+	// Pool spans every slice SSSD may assign the section's domains, from
+	// ldap_idmap_range_min to just before ldap_idmap_range_max; only the domain of
+	// ldap_idmap_default_domain_sid is sure to get the first one, IDRange, while the others,
+	// trusted domains included, are hashed to any slice in it
+	Pool IDRange
+	// Section is the section name, e.g. "domain/example.com"
+	Section string
+	// Line is the line number of the section header
+	Line int
+}
+
+// sssdSection accumulates the settings of one section while parsing
+type sssdSection struct {
+	name    string
+	line    int
+	options map[string]string
+	lines   map[string]int
+}
+
+// ParseSSSDConf returns the [domain/...] sections of an sssd.conf that use ID mapping,
+// i.e. id_provider = ad or ldap_id_mapping = true, with their idmap range settings
+// The IDRange is the first slice of ldap_idmap_range_size IDs from ldap_idmap_range_min,
+// which SSSD gives the domain of ldap_idmap_default_domain_sid; ldap_idmap_range_max is
+// the first ID SSSD may not use, so the slice ends before it
+// Unset settings take SSSD's defaults
+func ParseSSSDConf(r io.Reader) ([]SSSDConfDomain, error) {
+	var (
+		sections []*sssdSection
+		current  *sssdSection
+	)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: unterminated section header %q", lineNum, line)
+			}
+			current = &sssdSection{
+				name:    strings.TrimSpace(strings.Trim(line, "[]")),
+				line:    lineNum,
+				options: make(map[string]string),
+				lines:   make(map[string]int),
+			}
+			sections = append(sections, current)
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", lineNum, line)
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: option outside of a section", lineNum)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		current.options[key] = strings.TrimSpace(value)
+		current.lines[key] = lineNum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sssd.conf: %w", err)
+	}
+
+	var domains []SSSDConfDomain
+	for _, section := range sections {
+		name, ok := strings.CutPrefix(section.name, "domain/")
+		if !ok || !section.idMapped() {
+			continue
+		}
+
+		domain := SSSDConfDomain{
+			DomainConfig: DomainConfig{
+				DomainName: name,
+				DomainSID:  section.options["ldap_idmap_default_domain_sid"],
+			},
+			Section: section.name,
+			Line:    section.line,
+		}
+
+		rangeMin, err := section.uint32Option("ldap_idmap_range_min", DefaultRangeMin)
+		if err != nil {
+			return nil, err
+		}
+		rangeMax, err := section.uint32Option("ldap_idmap_range_max", DefaultRangeMax)
+		if err != nil {
+			return nil, err
+		}
+		rangeSize, err := section.uint32Option("ldap_idmap_range_size", DefaultRangeSize)
+		if err != nil {
+			return nil, err
+		}
+		if rangeMin >= rangeMax {
+			return nil, fmt.Errorf("line %d: [%s]: %w: min (%d) must be less than max (%d)",
+				section.line, section.name, ErrInvalidRange, rangeMin, rangeMax)
+		}
+		if rangeSize == 0 {
+			return nil, fmt.Errorf("line %d: [%s]: %w: ldap_idmap_range_size is 0",
+				section.lines["ldap_idmap_range_size"], section.name, ErrInvalidRange)
+		}
+
+		domain.IDRange = IDRange{Min: rangeMin, Max: uint32(min(uint64(rangeMin)+uint64(rangeSize), uint64(rangeMax)) - 1)}
+		domain.Pool = IDRange{Min: rangeMin, Max: rangeMax - 1}
+		domains = append(domains, domain)
+	}
+
+	return domains, nil
+}
+
+// idMapped reports whether the section maps IDs from SIDs rather than reading POSIX attributes
+func (s *sssdSection) idMapped() bool {
+	if v, ok := s.options["ldap_id_mapping"]; ok {
+		return strings.EqualFold(v, "true")
+	}
+	return s.options["id_provider"] == "ad"
+}
+
+// uint32Option returns the numeric value of key, or def if it is not set
+func (s *sssdSection) uint32Option(key string, def uint32) (uint32, error) {
+	v, ok := s.options[key]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("line %d: [%s]: %w: invalid %s %q", s.lines[key], s.name, ErrInvalidRange, key, v)
+	}
+	return uint32(n), nil
+}
+
+// LoadDomainsFromSSSDConf reads the ID-mapped domains and their ranges from an sssd.conf
+func LoadDomainsFromSSSDConf(path string) ([]DomainConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sections, err := ParseSSSDConf(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	configs := make([]DomainConfig, len(sections))
+	for i, section := range sections {
+		configs[i] = section.DomainConfig
+	}
+	return configs, nil
+}
+
+// ExportSSSDConf writes a [domain/NAME] section with the idmap settings of every domain
+// from ListDomains, in a form LoadDomainsFromSSSDConf reads back
+// Each range becomes a single slice: ldap_idmap_range_size is its length and
+// ldap_idmap_range_max the first ID after it
+// Domains with external mapping are written with ldap_id_mapping = False, which the
+// loader skips as they have no idmap range
+// A range ending at math.MaxUint32 has no ldap_idmap_range_max and is rejected with
+// ErrInvalidRange before anything is written
+func (c *IDMapContext) ExportSSSDConf(w io.Writer) error {
+	domains, err := c.ListDomains()
+	if err != nil {
+		return err
+	}
+	for _, d := range domains {
+		if d.IDRange.Max == math.MaxUint32 {
+			return fmt.Errorf("%w: domain %s: range max %d leaves no ldap_idmap_range_max after it",
+				ErrInvalidRange, d.DomainName, d.IDRange.Max)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, d := range domains {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintf(bw, "[domain/%s]\n", d.DomainName)
+		fmt.Fprintln(bw, "id_provider = ad")
+		if d.ExternalMapping {
+			fmt.Fprintln(bw, "ldap_id_mapping = False")
+		}
+		fmt.Fprintf(bw, "ldap_idmap_default_domain_sid = %s\n", d.DomainSID)
+		fmt.Fprintf(bw, "ldap_idmap_range_min = %d\n", d.IDRange.Min)
+		fmt.Fprintf(bw, "ldap_idmap_range_max = %d\n", d.IDRange.Max+1)
+		fmt.Fprintf(bw, "ldap_idmap_range_size = %d\n", d.IDRange.Max-d.IDRange.Min+1)
+	}
+	return bw.Flush()
+}
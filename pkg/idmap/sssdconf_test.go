@@ -0,0 +1,228 @@
+package idmap_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestParseSSSDConf(t *testing.T) {
+	want := []idmap.DomainConfig{
+		{
+			DomainName: "example.com",
+			IDRange:    idmap.IDRange{Min: 200000, Max: 399999},
+		},
+		{
+			// The default slice is capped just below ldap_idmap_range_max
+			DomainName: "corp.example.com",
+			DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+			IDRange:    idmap.IDRange{Min: 10000, Max: 19999},
+		},
+		{
+			DomainName: "mapped.example.com",
+			IDRange:    idmap.IDRange{Min: 100000, Max: 299999},
+		},
+	}
+
+	got, err := idmap.LoadDomainsFromSSSDConf("testdata/sssd.conf")
+	if err != nil {
+		t.Fatalf("LoadDomainsFromSSSDConf() failed: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("LoadDomainsFromSSSDConf() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseSSSDConf_RangeSize(t *testing.T) {
+	conf := "[domain/a]\nid_provider = ad\nldap_idmap_range_min = 100000\nldap_idmap_range_max = 2000100000\nldap_idmap_range_size = 50000\n"
+
+	domains, err := idmap.ParseSSSDConf(strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("ParseSSSDConf() failed: %v", err)
+	}
+	want := idmap.IDRange{Min: 100000, Max: 149999}
+	if len(domains) != 1 || domains[0].IDRange != want {
+		t.Errorf("ParseSSSDConf() = %+v, want one domain with range %+v", domains, want)
+	}
+	wantPool := idmap.IDRange{Min: 100000, Max: 2000099999}
+	if len(domains) == 1 && domains[0].Pool != wantPool {
+		t.Errorf("ParseSSSDConf() pool = %+v, want %+v", domains[0].Pool, wantPool)
+	}
+}
+
+func TestParseSSSDConf_Location(t *testing.T) {
+	conf := "[sssd]\ndomains = a, b\n\n[domain/a]\nid_provider = ad\n\n[domain/b]\nid_provider = ad\n"
+
+	domains, err := idmap.ParseSSSDConf(strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("ParseSSSDConf() failed: %v", err)
+	}
+	if len(domains) != 2 {
+		t.Fatalf("ParseSSSDConf() returned %d domains, want 2", len(domains))
+	}
+	if domains[0].Section != "domain/a" || domains[0].Line != 4 {
+		t.Errorf("domain 0 at [%s] line %d, want [domain/a] line 4", domains[0].Section, domains[0].Line)
+	}
+	if domains[1].Section != "domain/b" || domains[1].Line != 7 {
+		t.Errorf("domain 1 at [%s] line %d, want [domain/b] line 7", domains[1].Section, domains[1].Line)
+	}
+}
+
+func TestParseSSSDConf_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     string
+		wantErr  error
+		wantLine string
+	}{
+		{
+			name:     "non-numeric bound",
+			conf:     "[domain/a]\nid_provider = ad\nldap_idmap_range_min = lots\n",
+			wantErr:  idmap.ErrInvalidRange,
+			wantLine: "line 3",
+		},
+		{
+			name:     "inverted range",
+			conf:     "[domain/a]\nid_provider = ad\nldap_idmap_range_min = 20000\nldap_idmap_range_max = 10000\n",
+			wantErr:  idmap.ErrInvalidRange,
+			wantLine: "line 1",
+		},
+		{
+			name:     "zero range size",
+			conf:     "[domain/a]\nid_provider = ad\nldap_idmap_range_size = 0\n",
+			wantErr:  idmap.ErrInvalidRange,
+			wantLine: "line 3",
+		},
+		{
+			name:     "option outside a section",
+			conf:     "id_provider = ad\n",
+			wantLine: "line 1",
+		},
+		{
+			name:     "not key = value",
+			conf:     "[domain/a]\nid_provider\n",
+			wantLine: "line 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := idmap.ParseSSSDConf(strings.NewReader(tt.conf))
+			if err == nil {
+				t.Fatal("ParseSSSDConf() expected error, got nil")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseSSSDConf() = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantLine) {
+				t.Errorf("ParseSSSDConf() error %q does not mention %q", err, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestDefaultSSSDOptions(t *testing.T) {
+	requireLibrary(t)
+
+	got := idmap.DefaultSSSDOptions()
+	want := idmap.ContextConfig{
+		Lower:     idmap.DefaultRangeMin,
+		Upper:     idmap.DefaultRangeMax,
+		RangeSize: idmap.DefaultRangeSize,
+	}
+	if got != want {
+		t.Errorf("DefaultSSSDOptions() = %+v, want %+v", got, want)
+	}
+	if idmap.DefaultRangeSize != 200000 || idmap.DefaultRangeMin != 200000 || idmap.DefaultRangeMax != 2000200000 {
+		t.Errorf("defaults = %d, %d-%d, want SSSD's 200000, 200000-2000200000", idmap.DefaultRangeSize, idmap.DefaultRangeMin, idmap.DefaultRangeMax)
+	}
+
+	// A fresh libsss_idmap context uses the same defaults
+	ctx, err := idmap.NewIDMapContext()
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	if config, err := ctx.Config(); err != nil || config != got {
+		t.Errorf("Config() = %+v, %v, want %+v", config, err, got)
+	}
+}
+
+func TestExportSSSDConf_RoundTrip(t *testing.T) {
+	requireLibrary(t)
+
+	domains := []idmap.DomainConfig{
+		{DomainName: "example.com", DomainSID: "S-1-5-21-3623811015-3361044348-30300820", IDRange: idmap.IDRange{Min: 10000, Max: 20000}},
+		{DomainName: "corp.example.com", DomainSID: "S-1-5-21-1111111111-2222222222-3333333333", IDRange: idmap.IDRange{Min: 200000, Max: 399999}},
+		{DomainName: "top.example.com", DomainSID: "S-1-5-21-2444444444-555555555-666666666", IDRange: idmap.IDRange{Min: 4294767295, Max: 4294967294}},
+	}
+
+	ctx, err := idmap.NewIDMapContext()
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+	if err := ctx.AddDomainsAtomic(domains); err != nil {
+		t.Fatalf("AddDomainsAtomic() failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ctx.ExportSSSDConf(&buf); err != nil {
+		t.Fatalf("ExportSSSDConf() failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "sssd.conf")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := idmap.LoadDomainsFromSSSDConf(path)
+	if err != nil {
+		t.Fatalf("LoadDomainsFromSSSDConf() failed on exported config: %v\n%s", err, buf.String())
+	}
+	if !slices.Equal(got, domains) {
+		t.Errorf("round trip = %+v, want %+v\n%s", got, domains, buf.String())
+	}
+	for _, line := range []string{
+		"ldap_idmap_range_max = 20001\n", "ldap_idmap_range_size = 10001\n",
+		"ldap_idmap_range_max = 4294967295\n", "ldap_idmap_range_size = 200000\n",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("ExportSSSDConf() output lacks %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestExportSSSDConf_RangeEndsAtMaxUint32(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContext()
+	if err != nil {
+		t.Fatalf("NewIDMapContext() failed: %v", err)
+	}
+	defer ctx.Close()
+	err = ctx.AddDomain(idmap.DomainConfig{
+		DomainName: "example.com",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 4294767296, Max: math.MaxUint32},
+	})
+	if err != nil {
+		t.Fatalf("AddDomain() failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ctx.ExportSSSDConf(&buf); !errors.Is(err, idmap.ErrInvalidRange) {
+		t.Errorf("ExportSSSDConf() error = %v, want %v", err, idmap.ErrInvalidRange)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("ExportSSSDConf() wrote %q, want nothing", buf.String())
+	}
+}
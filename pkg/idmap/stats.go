@@ -0,0 +1,77 @@
+package idmap
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of the conversions performed by an IDMapContext
+type Stats struct {
+	// Conversions counts every string and binary SID conversion attempted
+	Conversions uint64
+	// Fallbacks counts conversions answered with the WithFallbackID value
+	Fallbacks  uint64
+	InvalidSID uint64
+	NotFound   uint64
+	// OtherErrors counts internal errors and errors returned by an ErrorHook
+	OtherErrors uint64
+}
+
+// Errors returns the total number of failed conversions
+func (s Stats) Errors() uint64 {
+	return s.InvalidSID + s.NotFound + s.OtherErrors
+}
+
+// conversionStats holds the atomic counters behind Stats
+type conversionStats struct {
+	conversions atomic.Uint64
+	fallbacks   atomic.Uint64
+	invalidSID  atomic.Uint64
+	notFound    atomic.Uint64
+	otherErrors atomic.Uint64
+}
+
+// record tallies the outcome of one conversion
+func (s *conversionStats) record(err error) {
+	s.conversions.Add(1)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrInvalidSID):
+		s.invalidSID.Add(1)
+	case errors.Is(err, ErrNotFound):
+		s.notFound.Add(1)
+	default:
+		s.otherErrors.Add(1)
+	}
+}
+
+// snapshot returns the current counter values
+func (s *conversionStats) snapshot() Stats {
+	return Stats{
+		Conversions: s.conversions.Load(),
+		Fallbacks:   s.fallbacks.Load(),
+		InvalidSID:  s.invalidSID.Load(),
+		NotFound:    s.notFound.Load(),
+		OtherErrors: s.otherErrors.Load(),
+	}
+}
+
+// Stats returns the conversion counters accumulated since the context was created
+func (c *IDMapContext) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// CacheStats is a snapshot of a CachingIDMap's hits and misses
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// HitRate returns the fraction of lookups served from the cache, or 0 before any lookup
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
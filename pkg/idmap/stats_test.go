@@ -0,0 +1,75 @@
+package idmap_test
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestIDMapContext_Stats(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	bin, _ := hex.DecodeString("010500000000000515000000c7f7fed77c7755c8945ace01f5030000")
+
+	ctx.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013")
+	ctx.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-500")
+	ctx.BinSIDToUnixID(bin)
+	ctx.SIDToUnixID("not-a-sid")
+	ctx.BinSIDToUnixID(bin[:10])
+	ctx.SIDToUnixID("S-1-5-21-1111111111-2222222222-3333333333-1013")
+
+	want := idmap.Stats{Conversions: 6, InvalidSID: 2, NotFound: 1}
+	got := ctx.Stats()
+	if got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+	if got.Errors() != 3 {
+		t.Errorf("Stats().Errors() = %d, want 3", got.Errors())
+	}
+}
+
+func TestIDMapContext_Stats_Fallback(t *testing.T) {
+	requireLibrary(t)
+
+	ctx, err := idmap.NewIDMapContextWithDomain(idmap.DomainConfig{
+		DomainName: "EXAMPLE",
+		DomainSID:  "S-1-5-21-3623811015-3361044348-30300820",
+		IDRange:    idmap.IDRange{Min: 10000, Max: 20000},
+	}, idmap.WithFallbackID(65534))
+	if err != nil {
+		t.Fatalf("NewIDMapContextWithDomain() failed: %v", err)
+	}
+	defer ctx.Close()
+
+	ctx.SIDToUnixID("S-1-5-21-1111111111-2222222222-3333333333-1013")
+
+	if got, want := ctx.Stats(), (idmap.Stats{Conversions: 1, Fallbacks: 1}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCachingIDMap_Stats(t *testing.T) {
+	requireLibrary(t)
+
+	cache := idmap.NewCachingIDMap(newExampleContext(t))
+
+	if rate := cache.Stats().HitRate(); rate != 0 {
+		t.Errorf("HitRate() before any lookup = %v, want 0", rate)
+	}
+
+	for range 3 {
+		cache.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-1013")
+	}
+	cache.SIDToUnixID("S-1-5-21-3623811015-3361044348-30300820-500")
+
+	got := cache.Stats()
+	if got != (idmap.CacheStats{Hits: 2, Misses: 2}) {
+		t.Errorf("Stats() = %+v, want 2 hits and 2 misses", got)
+	}
+	if rate := got.HitRate(); rate != 0.5 {
+		t.Errorf("HitRate() = %v, want 0.5", rate)
+	}
+}
@@ -0,0 +1,137 @@
+package idmap
+
+import (
+	"context"
+	"runtime"
+)
+
+// StreamResult is the outcome of converting one SID read from a stream
+type StreamResult struct {
+	SID    string
+	UnixID uint32
+	Err    error
+}
+
+// streamConfig holds the ConvertStream settings
+type streamConfig struct {
+	workers    int
+	bufferSize int
+}
+
+// StreamOption configures ConvertStream
+type StreamOption func(*streamConfig)
+
+// WithWorkers sets how many conversions run concurrently; the default is GOMAXPROCS
+func WithWorkers(n int) StreamOption {
+	return func(c *streamConfig) {
+		if n > 0 {
+			c.workers = n
+		}
+	}
+}
+
+// WithBufferSize sets how many results may be in flight or waiting to be read;
+// the default is the worker count
+func WithBufferSize(n int) StreamOption {
+	return func(c *streamConfig) {
+		if n > 0 {
+			c.bufferSize = n
+		}
+	}
+}
+
+// streamJob is a SID handed to a worker along with the slot its result goes into
+type streamJob struct {
+	sid  string
+	slot chan StreamResult
+}
+
+// ConvertStream converts SIDs read from sids and delivers the results in input order
+// At most a bounded number of SIDs are held at once, so memory stays constant however
+// long the stream is; a slow reader of the results slows down reading from sids
+// The result channel is closed once sids is closed and drained, or ctx is done
+// On cancellation no further SIDs are read, but the conversions already handed to workers
+// finish and their results are delivered, followed by a final result whose Err is
+// ctx.Err(); the reader must keep draining the channel until it is closed
+func ConvertStream(ctx context.Context, mapper IDMapper, sids <-chan string, opts ...StreamOption) <-chan StreamResult {
+	cfg := streamConfig{workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.bufferSize == 0 {
+		cfg.bufferSize = cfg.workers
+	}
+
+	results := make(chan StreamResult, cfg.bufferSize)
+	// pending holds one slot per SID in flight, in input order; its capacity bounds memory
+	pending := make(chan chan StreamResult, cfg.bufferSize)
+	jobs := make(chan streamJob)
+	// cancelErr is set before pending is closed if reading stopped because ctx was done
+	var cancelErr error
+
+	for range cfg.workers {
+		go func() {
+			for job := range jobs {
+				unixID, err := mapper.SIDToUnixID(job.sid)
+				job.slot <- StreamResult{SID: job.sid, UnixID: unixID, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(pending)
+
+		for {
+			var (
+				sid string
+				ok  bool
+			)
+			select {
+			case <-ctx.Done():
+				cancelErr = ctx.Err()
+				return
+			case sid, ok = <-sids:
+				if !ok {
+					return
+				}
+			}
+
+			slot := make(chan StreamResult, 1)
+			select {
+			case <-ctx.Done():
+				cancelErr = ctx.Err()
+				return
+			case pending <- slot:
+			}
+			select {
+			case <-ctx.Done():
+				// No worker took the SID, so its slot will never be filled
+				close(slot)
+				cancelErr = ctx.Err()
+				return
+			case jobs <- streamJob{sid: sid, slot: slot}:
+			}
+		}
+	}()
+
+	go func() {
+		defer close(results)
+
+		for slot := range pending {
+			r, ok := <-slot
+			if !ok {
+				break
+			}
+			results <- r
+		}
+		// Drain pending so the reader's close happens before cancelErr is read
+		for range pending {
+		}
+		if cancelErr != nil {
+			results <- StreamResult{Err: cancelErr}
+		}
+	}()
+
+	return results
+}
@@ -0,0 +1,196 @@
+package idmap_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+// ridMapper maps S-1-5-21-1-2-3-<rid> to rid without the SSS library
+type ridMapper struct{}
+
+func (ridMapper) SIDToUnixID(sid string) (uint32, error) {
+	var rid uint32
+	if _, err := fmt.Sscanf(sid, "S-1-5-21-1-2-3-%d", &rid); err != nil {
+		return 0, idmap.ErrInvalidSID
+	}
+	return rid, nil
+}
+
+func (ridMapper) BinSIDToUnixID([]byte) (uint32, error) {
+	return 0, idmap.ErrInvalidSID
+}
+
+// feed sends n SIDs on the returned channel, counting how many have been handed over
+func feed(n int, sent *atomic.Int64) <-chan string {
+	sids := make(chan string)
+	go func() {
+		defer close(sids)
+		for i := range n {
+			sids <- fmt.Sprintf("S-1-5-21-1-2-3-%d", i)
+			if sent != nil {
+				sent.Add(1)
+			}
+		}
+	}()
+	return sids
+}
+
+func TestConvertStream(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	input := []string{
+		"S-1-5-21-3623811015-3361044348-30300820-1013",
+		"not-a-sid",
+		"S-1-5-21-3623811015-3361044348-30300820-500",
+		"S-1-5-21-1111111111-2222222222-3333333333-1001",
+		"S-1-5-21-3623811015-3361044348-30300820-513",
+	}
+	want := []struct {
+		unixID uint32
+		err    error
+	}{
+		{unixID: 11013},
+		{err: idmap.ErrInvalidSID},
+		{unixID: 10500},
+		{err: idmap.ErrNotFound},
+		{unixID: 10513},
+	}
+
+	sids := make(chan string, len(input))
+	for _, sid := range input {
+		sids <- sid
+	}
+	close(sids)
+
+	var got []idmap.StreamResult
+	for r := range idmap.ConvertStream(context.Background(), ctx, sids, idmap.WithWorkers(4), idmap.WithBufferSize(2)) {
+		got = append(got, r)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("ConvertStream() returned %d results, want %d", len(got), len(want))
+	}
+	for i, r := range got {
+		if r.SID != input[i] {
+			t.Errorf("result %d SID = %q, want %q (input order)", i, r.SID, input[i])
+		}
+		if want[i].err != nil {
+			if !errors.Is(r.Err, want[i].err) {
+				t.Errorf("result %d error = %v, want %v", i, r.Err, want[i].err)
+			}
+			continue
+		}
+		if r.Err != nil || r.UnixID != want[i].unixID {
+			t.Errorf("result %d = %d, %v, want %d", i, r.UnixID, r.Err, want[i].unixID)
+		}
+	}
+}
+
+func TestConvertStream_BoundedMemory(t *testing.T) {
+	const (
+		n          = 200000
+		bufferSize = 1
+	)
+
+	var sent atomic.Int64
+	results := idmap.ConvertStream(context.Background(), ridMapper{}, feed(n, &sent), idmap.WithWorkers(4), idmap.WithBufferSize(bufferSize))
+
+	// One SID in the dispatcher, the pending slots, one in the collector and the result buffer
+	maxInFlight := int64(2*bufferSize + 2)
+
+	received := int64(0)
+	for r := range results {
+		if r.Err != nil || int64(r.UnixID) != received {
+			t.Fatalf("result %d = %d, %v, want %d", received, r.UnixID, r.Err, received)
+		}
+		received++
+		if inFlight := sent.Load() - received; inFlight > maxInFlight {
+			t.Fatalf("%d SIDs in flight after %d results, want at most %d", inFlight, received, maxInFlight)
+		}
+	}
+	if received != n {
+		t.Fatalf("ConvertStream() returned %d results, want %d", received, n)
+	}
+}
+
+func TestConvertStream_AllocationsPerSIDConstant(t *testing.T) {
+	allocsPerSID := func(n int) float64 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		for range idmap.ConvertStream(context.Background(), ridMapper{}, feed(n, nil), idmap.WithWorkers(2), idmap.WithBufferSize(1)) {
+		}
+		runtime.ReadMemStats(&after)
+		return float64(after.Mallocs-before.Mallocs) / float64(n)
+	}
+
+	small, large := allocsPerSID(1000), allocsPerSID(100000)
+	if large > small*1.5 {
+		t.Errorf("allocations per SID grew from %.2f to %.2f with input size", small, large)
+	}
+}
+
+func TestConvertStream_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sids := make(chan string)
+	results := idmap.ConvertStream(ctx, ridMapper{}, sids)
+
+	cancel()
+	for range results {
+	}
+}
+
+// gateMapper is a ridMapper whose conversions signal started and then wait for release
+type gateMapper struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (g gateMapper) SIDToUnixID(sid string) (uint32, error) {
+	g.started <- struct{}{}
+	<-g.release
+	return ridMapper{}.SIDToUnixID(sid)
+}
+
+func (gateMapper) BinSIDToUnixID([]byte) (uint32, error) {
+	return 0, idmap.ErrInvalidSID
+}
+
+func TestConvertStream_CancelDrainsInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mapper := gateMapper{started: make(chan struct{}), release: make(chan struct{})}
+	results := idmap.ConvertStream(ctx, mapper, feed(10, nil), idmap.WithWorkers(2))
+
+	// Cancel while both workers hold a SID, then let them finish
+	<-mapper.started
+	<-mapper.started
+	cancel()
+	close(mapper.release)
+
+	var got []idmap.StreamResult
+	for r := range results {
+		got = append(got, r)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("ConvertStream() delivered %d results after cancellation, want 3: %+v", len(got), got)
+	}
+	for i, r := range got[:2] {
+		if r.Err != nil || r.UnixID != uint32(i) {
+			t.Errorf("result %d = %+v, want the in-flight conversion of RID %d", i, r, i)
+		}
+	}
+	if last := got[2]; !errors.Is(last.Err, context.Canceled) || last.SID != "" {
+		t.Errorf("final result = %+v, want Err context.Canceled", last)
+	}
+}
@@ -0,0 +1,65 @@
+package idmap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateDomainConfig checks a single domain configuration without consulting the SSS library
+// With relaxedRanges the range bounds are left for the library to judge
+func validateDomainConfig(config DomainConfig, relaxedRanges bool) error {
+	if config.DomainName == "" {
+		return fmt.Errorf("%w: domain name is empty", ErrInvalidConfig)
+	}
+
+	if !relaxedRanges && config.IDRange.Min >= config.IDRange.Max {
+		return fmt.Errorf("%w: min (%d) must be less than max (%d)", ErrInvalidRange, config.IDRange.Min, config.IDRange.Max)
+	}
+
+	if err := ValidateSID(config.DomainSID); err != nil {
+		return fmt.Errorf("domain %s: %w", config.DomainName, err)
+	}
+
+	return nil
+}
+
+// rangesOverlap reports whether two ID ranges share at least one ID
+func rangesOverlap(a, b IDRange) bool {
+	return a.Min <= b.Max && b.Min <= a.Max
+}
+
+// Overlap is a pair of domains whose ID ranges share at least one ID
+type Overlap struct {
+	A, B DomainConfig
+}
+
+// FindOverlaps returns every pair of configs with overlapping ID ranges, in input order
+func FindOverlaps(configs []DomainConfig) []Overlap {
+	var overlaps []Overlap
+	for i, a := range configs {
+		for _, b := range configs[i+1:] {
+			if rangesOverlap(a.IDRange, b.IDRange) {
+				overlaps = append(overlaps, Overlap{A: a, B: b})
+			}
+		}
+	}
+	return overlaps
+}
+
+// checkDomainConflict reports whether two domain configurations cannot coexist in one context
+func checkDomainConflict(a, b DomainConfig) error {
+	if rangesOverlap(a.IDRange, b.IDRange) {
+		return fmt.Errorf("%w: range %d-%d of domain %s overlaps range %d-%d of domain %s",
+			ErrInvalidRange, a.IDRange.Min, a.IDRange.Max, a.DomainName, b.IDRange.Min, b.IDRange.Max, b.DomainName)
+	}
+
+	if strings.EqualFold(a.DomainName, b.DomainName) {
+		return fmt.Errorf("%w: domain %s is configured more than once", ErrInvalidConfig, a.DomainName)
+	}
+
+	if strings.EqualFold(a.DomainSID, b.DomainSID) {
+		return fmt.Errorf("%w: domain SID %s is used by both %s and %s", ErrInvalidConfig, a.DomainSID, a.DomainName, b.DomainName)
+	}
+
+	return nil
+}
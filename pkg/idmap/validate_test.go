@@ -0,0 +1,42 @@
+package idmap_test
+
+import (
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestFindOverlaps(t *testing.T) {
+	a := idmap.DomainConfig{DomainName: "A", IDRange: idmap.IDRange{Min: 10000, Max: 20000}}
+	b := idmap.DomainConfig{DomainName: "B", IDRange: idmap.IDRange{Min: 20000, Max: 30000}}
+	c := idmap.DomainConfig{DomainName: "C", IDRange: idmap.IDRange{Min: 30001, Max: 40000}}
+	d := idmap.DomainConfig{DomainName: "D", IDRange: idmap.IDRange{Min: 15000, Max: 35000}}
+
+	tests := []struct {
+		name    string
+		configs []idmap.DomainConfig
+		want    []idmap.Overlap
+	}{
+		{name: "none", configs: []idmap.DomainConfig{a, c}},
+		{name: "shared boundary", configs: []idmap.DomainConfig{a, b, c}, want: []idmap.Overlap{{A: a, B: b}}},
+		{
+			name:    "one range spanning several",
+			configs: []idmap.DomainConfig{a, c, d},
+			want:    []idmap.Overlap{{A: a, B: d}, {A: c, B: d}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idmap.FindOverlaps(tt.configs)
+			if len(got) != len(tt.want) {
+				t.Fatalf("FindOverlaps() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("FindOverlaps()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package idmap
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// wellKnownSIDs maps well-known SIDs to their display names
+// https://learn.microsoft.com/en-us/windows-server/identity/ad-ds/manage/understand-security-identifiers
+var wellKnownSIDs = map[string]string{
+	"S-1-0-0":      "Nobody",
+	"S-1-1-0":      "Everyone",
+	"S-1-2-0":      "Local",
+	"S-1-2-1":      "Console Logon",
+	"S-1-3-0":      "Creator Owner",
+	"S-1-3-1":      "Creator Group",
+	"S-1-3-2":      "Creator Owner Server",
+	"S-1-3-3":      "Creator Group Server",
+	"S-1-3-4":      "Owner Rights",
+	"S-1-5-1":      "Dialup",
+	"S-1-5-2":      "Network",
+	"S-1-5-3":      "Batch",
+	"S-1-5-4":      "Interactive",
+	"S-1-5-6":      "Service",
+	"S-1-5-7":      "Anonymous Logon",
+	"S-1-5-8":      "Proxy",
+	"S-1-5-9":      "Enterprise Domain Controllers",
+	"S-1-5-10":     "Principal Self",
+	"S-1-5-11":     "Authenticated Users",
+	"S-1-5-12":     "Restricted Code",
+	"S-1-5-13":     "Terminal Server Users",
+	"S-1-5-14":     "Remote Interactive Logon",
+	"S-1-5-15":     "This Organization",
+	"S-1-5-17":     "IUSR",
+	"S-1-5-18":     "Local System",
+	"S-1-5-19":     "Local Service",
+	"S-1-5-20":     "Network Service",
+	"S-1-5-32-544": "Administrators",
+	"S-1-5-32-545": "Users",
+	"S-1-5-32-546": "Guests",
+	"S-1-5-32-547": "Power Users",
+	"S-1-5-32-548": "Account Operators",
+	"S-1-5-32-549": "Server Operators",
+	"S-1-5-32-550": "Print Operators",
+	"S-1-5-32-551": "Backup Operators",
+	"S-1-5-32-552": "Replicator",
+	"S-1-5-32-554": "Pre-Windows 2000 Compatible Access",
+	"S-1-5-32-555": "Remote Desktop Users",
+	"S-1-5-32-556": "Network Configuration Operators",
+	"S-1-5-32-558": "Performance Monitor Users",
+	"S-1-5-32-559": "Performance Log Users",
+	"S-1-5-32-568": "IIS_IUSRS",
+	"S-1-5-32-573": "Event Log Readers",
+	"S-1-5-32-580": "Remote Management Users",
+	"S-1-5-64-10":  "NTLM Authentication",
+	"S-1-5-64-14":  "SChannel Authentication",
+	"S-1-5-64-21":  "Digest Authentication",
+	"S-1-5-1000":   "Other Organization",
+	"S-1-15-2-1":   "All Application Packages",
+	"S-1-16-0":     "Untrusted Mandatory Level",
+	"S-1-16-4096":  "Low Mandatory Level",
+	"S-1-16-8192":  "Medium Mandatory Level",
+	"S-1-16-8448":  "Medium Plus Mandatory Level",
+	"S-1-16-12288": "High Mandatory Level",
+	"S-1-16-16384": "System Mandatory Level",
+	"S-1-16-20480": "Protected Process Mandatory Level",
+	"S-1-16-28672": "Secure Process Mandatory Level",
+}
+
+// sddlAliases maps well-known SIDs to their two-letter SDDL abbreviations
+// Domain-relative aliases such as DA are left out: they resolve against the domain of the
+// machine reading the SDDL, which the SID alone does not identify
+// https://learn.microsoft.com/en-us/windows/win32/secauthz/sid-strings
+var sddlAliases = map[string]string{
+	"S-1-1-0":      "WD",
+	"S-1-3-0":      "CO",
+	"S-1-3-1":      "CG",
+	"S-1-3-4":      "OW",
+	"S-1-5-2":      "NU",
+	"S-1-5-4":      "IU",
+	"S-1-5-6":      "SU",
+	"S-1-5-7":      "AN",
+	"S-1-5-9":      "ED",
+	"S-1-5-10":     "PS",
+	"S-1-5-11":     "AU",
+	"S-1-5-12":     "RC",
+	"S-1-5-18":     "SY",
+	"S-1-5-19":     "LS",
+	"S-1-5-20":     "NS",
+	"S-1-5-32-544": "BA",
+	"S-1-5-32-545": "BU",
+	"S-1-5-32-546": "BG",
+	"S-1-5-32-547": "PU",
+	"S-1-5-32-548": "AO",
+	"S-1-5-32-549": "SO",
+	"S-1-5-32-550": "PO",
+	"S-1-5-32-551": "BO",
+	"S-1-5-32-552": "RE",
+	"S-1-5-32-554": "RU",
+	"S-1-5-32-555": "RD",
+	"S-1-5-32-556": "NO",
+	"S-1-5-32-558": "MU",
+	"S-1-5-32-559": "LU",
+	"S-1-5-32-568": "IS",
+	"S-1-5-32-573": "ER",
+	"S-1-5-32-580": "RM",
+	"S-1-15-2-1":   "AC",
+	"S-1-16-4096":  "LW",
+	"S-1-16-8192":  "ME",
+	"S-1-16-8448":  "MP",
+	"S-1-16-12288": "HI",
+	"S-1-16-16384": "SI",
+}
+
+// mandatoryLabelAuthority is the big-endian identifier authority of the S-1-16 integrity labels
+var mandatoryLabelAuthority = []byte{0, 0, 0, 0, 0, 16}
+
+// WellKnownSIDs returns a copy of the well-known SID to name table
+func WellKnownSIDs() map[string]string {
+	return maps.Clone(wellKnownSIDs)
+}
+
+// IsWellKnownSID reports whether sid is one of the well-known SIDs returned by WellKnownSIDs
+func IsWellKnownSID(sid string) bool {
+	_, ok := wellKnownSIDs[sid]
+	return ok
+}
+
+// SDDLAlias returns the SDDL abbreviation of a well-known SID, e.g. BA for
+// S-1-5-32-544, or sid itself and false if it has none
+func SDDLAlias(sid string) (string, bool) {
+	if alias, ok := sddlAliases[sid]; ok {
+		return alias, true
+	}
+	return sid, false
+}
+
+// IsMandatoryLabelSID reports whether sid is an S-1-16 mandatory integrity label such as
+// S-1-16-12288 (High); labels appear in SACLs but never identify an account, so
+// SIDToUnixID rejects them with ErrNotMappable
+func IsMandatoryLabelSID(sid string) bool {
+	return strings.HasPrefix(sid, "S-1-16-") && ValidateSID(sid) == nil
+}
+
+// WellKnownGroup is the RID of a group AD creates in every domain
+type WellKnownGroup uint32
+
+// RIDs of the well-known domain groups
+// https://learn.microsoft.com/en-us/windows-server/identity/ad-ds/manage/understand-security-identifiers
+const (
+	DomainAdmins               WellKnownGroup = 512
+	DomainUsers                WellKnownGroup = 513
+	DomainGuests               WellKnownGroup = 514
+	DomainComputers            WellKnownGroup = 515
+	DomainControllers          WellKnownGroup = 516
+	CertPublishers             WellKnownGroup = 517
+	SchemaAdmins               WellKnownGroup = 518
+	EnterpriseAdmins           WellKnownGroup = 519
+	GroupPolicyCreatorOwners   WellKnownGroup = 520
+	ReadOnlyDomainControllers  WellKnownGroup = 521
+	CloneableDomainControllers WellKnownGroup = 522
+	ProtectedUsers             WellKnownGroup = 525
+	KeyAdmins                  WellKnownGroup = 526
+	EnterpriseKeyAdmins        WellKnownGroup = 527
+)
+
+// wellKnownGroupNames maps each WellKnownGroup to its display name
+var wellKnownGroupNames = map[WellKnownGroup]string{
+	DomainAdmins:               "Domain Admins",
+	DomainUsers:                "Domain Users",
+	DomainGuests:               "Domain Guests",
+	DomainComputers:            "Domain Computers",
+	DomainControllers:          "Domain Controllers",
+	CertPublishers:             "Cert Publishers",
+	SchemaAdmins:               "Schema Admins",
+	EnterpriseAdmins:           "Enterprise Admins",
+	GroupPolicyCreatorOwners:   "Group Policy Creator Owners",
+	ReadOnlyDomainControllers:  "Read-only Domain Controllers",
+	CloneableDomainControllers: "Cloneable Domain Controllers",
+	ProtectedUsers:             "Protected Users",
+	KeyAdmins:                  "Key Admins",
+	EnterpriseKeyAdmins:        "Enterprise Key Admins",
+}
+
+func (g WellKnownGroup) String() string {
+	if name, ok := wellKnownGroupNames[g]; ok {
+		return name
+	}
+	return fmt.Sprintf("WellKnownGroup(%d)", uint32(g))
+}
+
+// WellKnownDomainGroupSID returns the SID of group in the AD domain domainSID, e.g.
+// S-1-5-21-X-Y-Z-512 for DomainAdmins
+func WellKnownDomainGroupSID(domainSID string, group WellKnownGroup) (string, error) {
+	if _, ok := wellKnownGroupNames[group]; !ok {
+		return "", fmt.Errorf("%w: %d is not a well-known domain group RID", ErrInvalidSID, uint32(group))
+	}
+	if !strings.HasPrefix(domainSID, domainSIDPrefix) {
+		return "", fmt.Errorf("%w: %q is not an AD domain SID", ErrInvalidSID, domainSID)
+	}
+
+	return BuildSID(domainSID, uint32(group))
+}
@@ -0,0 +1,165 @@
+package idmap_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestWellKnownSIDs(t *testing.T) {
+	sids := idmap.WellKnownSIDs()
+
+	want := map[string]string{
+		"S-1-1-0":      "Everyone",
+		"S-1-5-18":     "Local System",
+		"S-1-5-11":     "Authenticated Users",
+		"S-1-5-32-544": "Administrators",
+	}
+	for sid, name := range want {
+		if got, ok := sids[sid]; !ok || got != name {
+			t.Errorf("WellKnownSIDs()[%q] = %q, %v, want %q", sid, got, ok, name)
+		}
+	}
+
+	for sid := range sids {
+		if err := idmap.ValidateSID(sid); err != nil {
+			t.Errorf("ValidateSID(%q) failed: %v", sid, err)
+		}
+		if !idmap.IsWellKnownSID(sid) {
+			t.Errorf("IsWellKnownSID(%q) = false, want true", sid)
+		}
+	}
+
+	// Mutating the returned map must not affect the package table
+	delete(sids, "S-1-1-0")
+	if !idmap.IsWellKnownSID("S-1-1-0") {
+		t.Error("IsWellKnownSID(\"S-1-1-0\") = false after mutating WellKnownSIDs() result")
+	}
+}
+
+func TestIsWellKnownSID(t *testing.T) {
+	if idmap.IsWellKnownSID("S-1-5-21-3623811015-3361044348-30300820-1013") {
+		t.Error("IsWellKnownSID() = true for a domain account SID")
+	}
+}
+
+func TestMandatoryLabelSIDs(t *testing.T) {
+	requireLibrary(t)
+
+	ctx := newExampleContext(t)
+
+	tests := []struct {
+		sid      string
+		wantName string
+	}{
+		{sid: "S-1-16-4096", wantName: "Low Mandatory Level"},
+		{sid: "S-1-16-8192", wantName: "Medium Mandatory Level"},
+		{sid: "S-1-16-12288", wantName: "High Mandatory Level"},
+		{sid: "S-1-16-16384", wantName: "System Mandatory Level"},
+		{sid: "S-1-16-1234"},
+	}
+
+	names := idmap.WellKnownSIDs()
+	for _, tt := range tests {
+		t.Run(tt.sid, func(t *testing.T) {
+			if !idmap.IsMandatoryLabelSID(tt.sid) {
+				t.Errorf("IsMandatoryLabelSID(%q) = false, want true", tt.sid)
+			}
+			if got := names[tt.sid]; got != tt.wantName {
+				t.Errorf("WellKnownSIDs()[%q] = %q, want %q", tt.sid, got, tt.wantName)
+			}
+
+			if _, err := ctx.SIDToUnixID(tt.sid); !errors.Is(err, idmap.ErrNotMappable) {
+				t.Errorf("SIDToUnixID(%q) = %v, want ErrNotMappable", tt.sid, err)
+			}
+
+			bin, err := idmap.EncodeSID(tt.sid)
+			if err != nil {
+				t.Fatalf("EncodeSID(%q) failed: %v", tt.sid, err)
+			}
+			if _, err := ctx.BinSIDToUnixID(bin); !errors.Is(err, idmap.ErrNotMappable) {
+				t.Errorf("BinSIDToUnixID(%x) = %v, want ErrNotMappable", bin, err)
+			}
+		})
+	}
+
+	for _, sid := range []string{"S-1-5-18", "S-1-16", "S-1-16-x", "S-1-5-21-3623811015-3361044348-30300820-16"} {
+		if idmap.IsMandatoryLabelSID(sid) {
+			t.Errorf("IsMandatoryLabelSID(%q) = true, want false", sid)
+		}
+	}
+}
+
+func TestWellKnownDomainGroupSID(t *testing.T) {
+	const domainSID = "S-1-5-21-3623811015-3361044348-30300820"
+
+	tests := []struct {
+		name      string
+		domainSID string
+		group     idmap.WellKnownGroup
+		want      string
+		wantErr   bool
+	}{
+		{name: "domain admins", domainSID: domainSID, group: idmap.DomainAdmins, want: domainSID + "-512"},
+		{name: "domain users", domainSID: domainSID, group: idmap.DomainUsers, want: domainSID + "-513"},
+		{name: "domain guests", domainSID: domainSID, group: idmap.DomainGuests, want: domainSID + "-514"},
+		{name: "protected users", domainSID: domainSID, group: idmap.ProtectedUsers, want: domainSID + "-525"},
+		{name: "unknown group", domainSID: domainSID, group: 1013, wantErr: true},
+		{name: "account SID", domainSID: domainSID + "-1013", group: idmap.DomainAdmins, wantErr: true},
+		{name: "builtin domain", domainSID: "S-1-5-32", group: idmap.DomainAdmins, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idmap.WellKnownDomainGroupSID(tt.domainSID, tt.group)
+			if tt.wantErr {
+				if !errors.Is(err, idmap.ErrInvalidSID) {
+					t.Errorf("WellKnownDomainGroupSID(%q, %v) = %q, %v, want ErrInvalidSID", tt.domainSID, tt.group, got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WellKnownDomainGroupSID(%q, %v) unexpected error: %v", tt.domainSID, tt.group, err)
+			}
+			if got != tt.want {
+				t.Errorf("WellKnownDomainGroupSID(%q, %v) = %q, want %q", tt.domainSID, tt.group, got, tt.want)
+			}
+		})
+	}
+
+	if got := idmap.DomainAdmins.String(); got != "Domain Admins" {
+		t.Errorf("DomainAdmins.String() = %q, want %q", got, "Domain Admins")
+	}
+}
+
+func TestSDDLAlias(t *testing.T) {
+	tests := []struct {
+		sid    string
+		want   string
+		wantOK bool
+	}{
+		{sid: "S-1-5-32-544", want: "BA", wantOK: true},
+		{sid: "S-1-1-0", want: "WD", wantOK: true},
+		{sid: "S-1-5-18", want: "SY", wantOK: true},
+		{sid: "S-1-5-11", want: "AU", wantOK: true},
+		{sid: "S-1-16-12288", want: "HI", wantOK: true},
+		{sid: "S-1-5-21-3623811015-3361044348-30300820-512", want: "S-1-5-21-3623811015-3361044348-30300820-512"},
+		{sid: "S-1-5-21-3623811015-3361044348-30300820-1013", want: "S-1-5-21-3623811015-3361044348-30300820-1013"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sid, func(t *testing.T) {
+			got, ok := idmap.SDDLAlias(tt.sid)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("SDDLAlias(%q) = %q, %v, want %q, %v", tt.sid, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	for sid, alias := range idmap.SDDLAliases {
+		if !idmap.IsWellKnownSID(sid) {
+			t.Errorf("SDDL alias %s is for %s, which is not in WellKnownSIDs", alias, sid)
+		}
+	}
+}
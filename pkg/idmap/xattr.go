@@ -0,0 +1,70 @@
+package idmap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// ntfsACLXattr is the extended attribute through which ntfs-3g exposes a file's
+// self-relative security descriptor
+const ntfsACLXattr = "system.ntfs_acl"
+
+// ExtractSIDsFromXattr returns the owner, group and DACL SIDs of an NTFS ACL extended
+// attribute as exposed by ntfs-3g, in that order and without duplicates
+// value may be the raw attribute or the text getfattr prints with -e hex ("0x...") or
+// -e base64 ("0s..."), as found in attribute dumps on backup media
+func ExtractSIDsFromXattr(name string, value []byte) ([]string, error) {
+	if name != ntfsACLXattr {
+		return nil, fmt.Errorf("unsupported extended attribute %q, want %s", name, ntfsACLXattr)
+	}
+
+	blob, err := decodeXattrValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	owner, group, aces, err := DecodeSecurityDescriptorSIDs(blob)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	var sids []string
+	seen := make(map[string]bool)
+	add := func(sid string) {
+		if sid != "" && !seen[sid] {
+			seen[sid] = true
+			sids = append(sids, sid)
+		}
+	}
+	add(owner)
+	add(group)
+	for _, ace := range aces {
+		add(ace.SID)
+	}
+
+	return sids, nil
+}
+
+// decodeXattrValue undoes the text encodings of getfattr; a raw security descriptor
+// never starts with "0x" or "0s" since its first byte is the revision 1
+func decodeXattrValue(value []byte) ([]byte, error) {
+	text := bytes.TrimSpace(value)
+	switch {
+	case bytes.HasPrefix(text, []byte("0x")):
+		blob, err := hex.DecodeString(string(text[2:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex value: %w", err)
+		}
+		return blob, nil
+	case bytes.HasPrefix(text, []byte("0s")):
+		blob, err := base64.StdEncoding.DecodeString(string(text[2:]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 value: %w", err)
+		}
+		return blob, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,62 @@
+package idmap_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"testing"
+
+	"github.com/ngharo/sss_idmap_ad2unix/pkg/idmap"
+)
+
+func TestExtractSIDsFromXattr(t *testing.T) {
+	raw, _ := hex.DecodeString(exampleSDHex)
+	want := []string{
+		"S-1-5-32-544",
+		"S-1-5-18",
+		"S-1-5-21-3623811015-3361044348-30300820-513",
+	}
+
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "raw", value: raw},
+		{name: "getfattr hex", value: []byte("0x" + exampleSDHex + "\n")},
+		{name: "getfattr base64", value: []byte("0s" + base64.StdEncoding.EncodeToString(raw))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := idmap.ExtractSIDsFromXattr("system.ntfs_acl", tt.value)
+			if err != nil {
+				t.Fatalf("ExtractSIDsFromXattr() error = %v", err)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("ExtractSIDsFromXattr() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestExtractSIDsFromXattr_Invalid(t *testing.T) {
+	raw, _ := hex.DecodeString(exampleSDHex)
+
+	tests := []struct {
+		name  string
+		xattr string
+		value []byte
+	}{
+		{name: "other attribute", xattr: "system.ntfs_attrib", value: raw},
+		{name: "truncated", xattr: "system.ntfs_acl", value: raw[:20]},
+		{name: "bad hex", xattr: "system.ntfs_acl", value: []byte("0xzz")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := idmap.ExtractSIDsFromXattr(tt.xattr, tt.value); err == nil {
+				t.Errorf("ExtractSIDsFromXattr() = %q, want error", got)
+			}
+		})
+	}
+}